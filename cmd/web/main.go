@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -8,10 +9,13 @@ import (
 	"os/signal"
 	"syscall"
 
+	"tv-server/internal/handler"
+	"tv-server/internal/logic/m3u"
 	"tv-server/internal/model"
 	"tv-server/internal/router"
 	"tv-server/utils/cache"
 	"tv-server/utils/core"
+	"tv-server/utils/httpclient"
 )
 
 func main() {
@@ -27,6 +31,16 @@ func main() {
 	// 获取配置
 	cfg := core.GetConfig()
 
+	// 设置出站代理
+	if err := httpclient.Configure(cfg.Proxy); err != nil {
+		log.Fatalf("代理配置无效: %v", err)
+	}
+
+	// 设置验证组播地址使用的网卡
+	if err := m3u.SetMulticastInterface(cfg.Multicast.Interface); err != nil {
+		log.Fatalf("组播配置无效: %v", err)
+	}
+
 	// 初始化数据库连接
 	if err := model.InitDB(cfg.DB.Type); err != nil {
 		log.Fatalf("初始化数据库失败: %v", err)
@@ -41,6 +55,12 @@ func main() {
 	// 初始化路由
 	r := router.NewRouter()
 
+	// 启动后台定时验证和验证记录的汇总清理
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler.StartScheduler(ctx)
+	handler.StartHealthRetention(ctx)
+
 	// 启动服务器
 	go func() {
 		addr := fmt.Sprintf(":%d", cfg.Server.Port)
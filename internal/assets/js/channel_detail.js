@@ -140,6 +140,7 @@ class ChannelDetail {
 
         // 立即更新一次延迟
         this.updatePlayerLatency(url);
+        this.loadStreamHealth(url);
         
         // 设置定期更新
         this.latencyUpdateInterval = setInterval(() => {
@@ -332,6 +333,7 @@ class ChannelDetail {
                 if (data.code === 200) {
                     if (data.data && data.data.length > 0) {
                         this.renderChannelInfo(data.data[0]);
+                        this.loadChannelHealth();
                         this.renderStreamList(data.data);
                         
                         // 确保播放器已初始化
@@ -362,6 +364,145 @@ class ChannelDetail {
         }
     }
 
+    // 获取可用性统计，params 为 url 或 channelName
+    fetchHealth(params) {
+        return fetch(`/api/stream/health?${new URLSearchParams(params)}`)
+            .then(response => response.json())
+            .then(data => {
+                if (data.code !== 200) {
+                    throw new Error(data.message || '获取可用性失败');
+                }
+                return data.data;
+            });
+    }
+
+    // 格式化可用性统计
+    formatHealth(summary) {
+        if (!summary || summary.checks === 0) return '暂无验证记录';
+        const parts = [`可用率 ${summary.uptime.toFixed(1)}%（${summary.successes}/${summary.checks}）`];
+        if (summary.avgLatency) parts.push(`平均耗时 ${summary.avgLatency} ms`);
+        if (summary.lastFailure) {
+            const failure = summary.lastFailure;
+            parts.push(`最近失败 ${new Date(failure.time * 1000).toLocaleString()}`
+                + (failure.errorClass ? `（${failure.errorClass}）` : ''));
+        }
+        return parts.join('，');
+    }
+
+    // 显示整个频道分组的可用性
+    loadChannelHealth() {
+        const container = document.getElementById('channelHealth');
+        if (!container) return;
+        this.fetchHealth({ channelName: this.channelName })
+            .then(health => {
+                container.textContent = `频道：${this.formatHealth(health.summary)}`;
+            })
+            .catch(error => console.error('获取频道可用性失败:', error));
+    }
+
+    // 显示当前播放地址的可用性和图表
+    loadStreamHealth(url) {
+        const container = document.getElementById('streamHealth');
+        if (!container) return;
+        this.fetchHealth({ url })
+            .then(health => {
+                container.textContent = `当前源：${this.formatHealth(health.summary)}`;
+                this.renderHealthChart(health);
+            })
+            .catch(error => console.error('获取播放源可用性失败:', error));
+    }
+
+    // 按时间段绘制可用率柱状图，柱高为可用率，没有验证记录的时间段留空
+    renderHealthChart(health) {
+        const svg = document.getElementById('healthChart');
+        if (!svg) return;
+        const width = 960, height = 80;
+        // 时间段按 span 对齐，第一个时间段可能早于 since
+        const start = health.since - health.since % health.span;
+        const count = Math.max(1, Math.ceil((Date.now() / 1000 - start) / health.span));
+        const barWidth = width / count;
+        svg.setAttribute('viewBox', `0 0 ${width} ${height}`);
+        svg.innerHTML = (health.series || []).map(point => {
+            const index = Math.floor((point.time - start) / health.span);
+            if (index < 0 || index >= count || point.checks === 0) return '';
+            const uptime = point.successes / point.checks;
+            const barHeight = Math.max(2, uptime * height);
+            const color = uptime >= 0.9 ? '#198754' : uptime >= 0.5 ? '#ffc107' : '#dc3545';
+            const title = `${new Date(point.time * 1000).toLocaleString()} 可用率 ${(uptime * 100).toFixed(0)}%`
+                + (point.latency ? `，平均耗时 ${point.latency} ms` : '');
+            return `<rect x="${index * barWidth}" y="${height - barHeight}" width="${Math.max(1, barWidth - 1)}"`
+                + ` height="${barHeight}" fill="${color}"><title>${title}</title></rect>`;
+        }).join('');
+    }
+
+    // 渲染已归档的播放源，默认折叠
+    renderArchivedList(streams) {
+        const archived = streams.flatMap(stream => (stream.archivedUrl || []).map(url => ({
+            name: stream.streamName || '未知频道',
+            url,
+            archive: stream.urlInfo?.[url]?.archive
+        })));
+        if (archived.length === 0) return '';
+
+        const reasons = { consecutive_failures: '连续失败', no_success: '长期失效', manual: '手动归档' };
+        const escape = text => String(text).replace(/[&<>"']/g, c => `&#${c.charCodeAt(0)};`);
+        return `
+            <details class="archived-streams">
+                <summary class="text-muted small">已归档的直播源（${archived.length}）</summary>
+                ${archived.map(item => `
+                    <div class="archived-item small">
+                        <div class="archived-info">
+                            <div>${escape(item.name)}</div>
+                            <div class="text-muted text-break">${escape(item.url)}</div>
+                            ${item.archive ? `<div class="text-muted">${reasons[item.archive.reason] || item.archive.reason}
+                                · ${new Date(item.archive.archivedAt * 1000).toLocaleString()}</div>` : ''}
+                        </div>
+                        <button class="btn btn-sm btn-outline-primary restore-btn" data-url="${escape(item.url)}">恢复</button>
+                    </div>
+                `).join('')}
+            </details>
+        `;
+    }
+
+    bindRestoreButtons(container) {
+        container.querySelectorAll('.restore-btn').forEach(btn => {
+            btn.addEventListener('click', () => this.setArchived(btn.dataset.url, false));
+        });
+    }
+
+    // 归档或恢复播放源后重新加载列表
+    setArchived(url, archive) {
+        if (!url) return;
+        if (archive && !confirm('归档后该源不再出现在列表和播放列表中，确定归档？')) return;
+        fetch(archive ? '/api/stream/archive' : '/api/stream/restore', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ urls: [url] })
+        })
+            .then(response => response.json())
+            .then(data => {
+                if (data.code !== 200) {
+                    throw new Error(data.message || '操作失败');
+                }
+                this.loadChannelInfo();
+            })
+            .catch(error => alert(error.message || '操作失败，请稍后重试'));
+    }
+
+    // 格式化最近一次验证得到的画质信息
+    formatProbe(probe) {
+        if (!probe || !probe.valid) return '';
+        const parts = [];
+        if (probe.resolution) parts.push(probe.resolution);
+        const codecs = [...(probe.videoCodecs || []), ...(probe.audioCodecs || [])];
+        if (codecs.length > 0) parts.push(codecs.join('/'));
+        if (probe.container) parts.push(probe.container.toUpperCase());
+        if (probe.bandwidth) parts.push(`${Math.round(probe.bandwidth / 1000)} kbps`);
+        if (probe.throughput) parts.push(`下载 ${probe.throughput} kbps`);
+        if (parts.length === 0) return '';
+        return `<div class="stream-quality text-muted small">${parts.join(' · ')}</div>`;
+    }
+
     // 渲染流列表
     renderStreamList(streams) {
         const streamList = document.getElementById('streamList');
@@ -382,7 +523,9 @@ class ChannelDetail {
         });
 
         if (expandedStreams.length === 0) {
-            streamList.innerHTML = '<div class="text-center py-4"><p class="text-muted">暂无可用直播源</p></div>';
+            streamList.innerHTML = '<div class="text-center py-4"><p class="text-muted">暂无可用直播源</p></div>'
+                + this.renderArchivedList(streams);
+            this.bindRestoreButtons(streamList);
             return;
         }
 
@@ -400,11 +543,15 @@ class ChannelDetail {
                             <button class="favorite-btn" title="收藏频道">
                                 <i class="bi bi-heart"></i>
                             </button>
+                            <button class="archive-btn" title="归档此源">
+                                <i class="bi bi-archive"></i>
+                            </button>
                         </div>
                         <div class="stream-footer">
                             <div class="stream-time">
                                 更新时间: ${stream.updatedAt ? new Date(stream.updatedAt * 1000).toLocaleString() : '未知'}
                             </div>
+                            ${this.formatProbe(stream.urlInfo?.[stream.singleUrl]?.probe)}
                             <div class="stream-latency" data-url="${stream.singleUrl}">
                                 <span class="badge bg-secondary">延迟测试中...</span>
                             </div>
@@ -412,11 +559,17 @@ class ChannelDetail {
                     </div>
                 </div>
             </div>
-        `).join('');
+        `).join('') + this.renderArchivedList(streams);
 
         // 添加点击事件
         streamList.querySelectorAll('.list-group-item').forEach(item => {
             item.addEventListener('click', (e) => {
+                if (e.target.closest('.archive-btn')) {
+                    e.preventDefault();
+                    e.stopPropagation();
+                    this.setArchived(item.dataset.url, true);
+                    return;
+                }
                 if (e.target.closest('.favorite-btn')) {
                     e.preventDefault();
                     e.stopPropagation();
@@ -436,6 +589,8 @@ class ChannelDetail {
             });
         });
 
+        this.bindRestoreButtons(streamList);
+
         // 测试延迟
         if (expandedStreams.length > 0) {
             this.testStreamLatencies(expandedStreams);
@@ -236,28 +236,15 @@ class ChannelManager {
         verifyBtn.disabled = true;
         verifyBtn.textContent = '验证中...';
 
-        // 开始轮询进度
-        let progressInterval = setInterval(() => {
-            fetch('/api/process')
-                .then(response => response.json())
-                .then(result => {
-                    if (result.code === 200 && result.data) {
-                        const progress = result.data.process;
-                        progressBar.style.width = `${progress}%`;
-                        progressText.textContent = `${progress.toFixed(1)}%`;
-                        
-                        // 如果进度达到100%，停止轮询
-                        if (progress >= 100) {
-                            clearInterval(progressInterval);
-                        }
-                    }
-                })
-                .catch(error => {
-                    console.error('获取进度失败:', error);
-                });
-        }, 1000); // 每秒更新一次进度
-
-        // 发送验证请求
+        // 任务创建后可以取消
+        const cancelBtn = document.createElement('button');
+        cancelBtn.type = 'button';
+        cancelBtn.className = 'btn btn-sm btn-outline-danger mb-3';
+        cancelBtn.textContent = '取消验证';
+        cancelBtn.disabled = true;
+        progressArea.after(cancelBtn);
+
+        // 创建验证任务，再轮询任务状态直到结束
         fetch('/api/channel/validate', {
             method: 'POST',
             headers: {
@@ -270,24 +257,46 @@ class ChannelManager {
         })
         .then(response => response.json())
         .then(result => {
+            if (!result.success) {
+                throw new Error(result.message || '创建验证任务失败');
+            }
+            cancelBtn.disabled = false;
+            cancelBtn.onclick = () => {
+                cancelBtn.disabled = true;
+                cancelJob(result.jobId);
+            };
+            return watchJob(result.jobId, event => {
+                const status = event.status;
+                progressBar.style.width = `${status.progress}%`;
+                progressText.textContent = `${status.progress.toFixed(1)}%`
+                    + (status.state === 'running' ? ` 剩余约 ${formatETA(status.eta)}` : '');
+            });
+        })
+        .then(status => {
             // 创建结果显示区域
             const resultDiv = document.createElement('div');
-            resultDiv.className = `alert ${result.success ? 'alert-success' : 'alert-danger'} mt-3`;
+            const success = status.state === 'done';
+            resultDiv.className = `alert ${success ? 'alert-success' : 'alert-danger'} mt-3`;
             
-            if (result.success) {
+            if (success) {
+                const stats = status.summary;
                 resultDiv.innerHTML = `
-                    原始链接：${result.stats.total} 个<br>
-                    验证通过：${result.stats.unique} 个<br>
-                    有效链接：${result.stats.valid} 个<br>`;
+                    原始链接：${stats.total} 个<br>
+                    验证通过：${stats.unique} 个<br>
+                    有效链接：${stats.valid} 个<br>
+                    未验证（协议不支持探测）：${stats.unverified || 0} 个<br>`;
 
-                if (result.stats.valid > 0) {
+                if (stats.valid > 0) {
                     resultDiv.innerHTML += `
                         您可以通过以下地址访问合并后的 M3U 文件：
-                        <a href="${result.m3uLink}" target="_blank">${result.m3uLink}</a>
+                        <a href="${stats.m3uLink}" target="_blank">${stats.m3uLink}</a><br>
+                        TXT 格式：<a href="${stats.txtLink}" target="_blank">${stats.txtLink}</a>
                     `;
                 }
+            } else if (status.state === 'cancelled') {
+                resultDiv.textContent = `验证已取消，已完成 ${status.processed} 个链接的探测结果已保存，播放列表未更新`;
             } else {
-                resultDiv.textContent = result.message || '验证失败';
+                resultDiv.textContent = status.error || '验证失败';
             }
             
             modalBody.appendChild(resultDiv);
@@ -302,8 +311,8 @@ class ChannelManager {
         .finally(() => {
             verifyBtn.disabled = false;
             verifyBtn.textContent = '验证';
-            clearInterval(progressInterval);
             progressArea.remove();
+            cancelBtn.remove();
         });
     }
 
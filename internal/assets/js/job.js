@@ -0,0 +1,114 @@
+// 验证任务的进度订阅，供首页和频道页共用
+
+// 任务是否已结束
+function isJobFinished(status) {
+    return ['done', 'failed', 'cancelled'].includes(status.state);
+}
+
+// 订阅验证任务的事件，优先使用 SSE，不支持或连接失败时改用 WebSocket，仍失败时轮询任务状态
+// 每收到一个事件调用 onEvent，任务结束后返回最终状态
+function watchJob(jobId, onEvent) {
+    const id = encodeURIComponent(jobId);
+
+    const viaSSE = () => new Promise((resolve, reject) => {
+        if (!window.EventSource) {
+            reject(new Error('浏览器不支持 SSE'));
+            return;
+        }
+        const source = new EventSource(`/api/job/events?id=${id}`);
+        const handle = e => {
+            const event = JSON.parse(e.data);
+            onEvent(event);
+            if (event.type === 'status' && isJobFinished(event.status)) {
+                source.close();
+                resolve(event.status);
+            }
+        };
+        source.addEventListener('status', handle);
+        source.addEventListener('result', handle);
+        source.onerror = () => {
+            source.close();
+            reject(new Error('SSE 连接失败'));
+        };
+    });
+
+    const viaWebSocket = () => new Promise((resolve, reject) => {
+        if (!window.WebSocket) {
+            reject(new Error('浏览器不支持 WebSocket'));
+            return;
+        }
+        const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
+        const socket = new WebSocket(`${protocol}//${location.host}/api/job/ws?id=${id}`);
+        let finished = false;
+        socket.onmessage = e => {
+            const event = JSON.parse(e.data);
+            onEvent(event);
+            if (event.type === 'status' && isJobFinished(event.status)) {
+                finished = true;
+                socket.close();
+                resolve(event.status);
+            }
+        };
+        socket.onclose = () => {
+            if (!finished) reject(new Error('WebSocket 连接断开'));
+        };
+    });
+
+    const viaPolling = () => new Promise((resolve, reject) => {
+        const poll = () => {
+            fetch(`/api/job/status?id=${id}`)
+                .then(response => response.json())
+                .then(result => {
+                    if (result.code !== 200) {
+                        throw new Error(result.message || '获取任务状态失败');
+                    }
+                    const status = result.data;
+                    onEvent({ type: 'status', status });
+                    if (isJobFinished(status)) {
+                        resolve(status);
+                    } else {
+                        setTimeout(poll, 1000);
+                    }
+                })
+                .catch(reject);
+        };
+        poll();
+    });
+
+    return viaSSE()
+        .catch(error => {
+            console.warn(`${error.message}，改用 WebSocket`);
+            return viaWebSocket();
+        })
+        .catch(error => {
+            console.warn(`${error.message}，改为轮询任务状态`);
+            return viaPolling();
+        });
+}
+
+// 取消验证任务，已完成的探测结果会被保存
+function cancelJob(jobId) {
+    return fetch('/api/job/cancel', {
+        method: 'POST',
+        headers: {
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ id: jobId })
+    })
+    .then(response => response.json())
+    .then(result => {
+        if (result.code !== 200) {
+            console.warn('取消任务失败:', result.message);
+        }
+    })
+    .catch(error => console.error('取消任务失败:', error));
+}
+
+// 将剩余秒数格式化为可读的时间
+function formatETA(seconds) {
+    if (seconds < 0) return '估算中';
+    if (seconds < 60) return `${seconds} 秒`;
+    const minutes = Math.floor(seconds / 60);
+    if (minutes < 60) return `${minutes} 分 ${seconds % 60} 秒`;
+    return `${Math.floor(minutes / 60)} 小时 ${minutes % 60} 分`;
+}
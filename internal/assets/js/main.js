@@ -175,13 +175,127 @@ document.addEventListener('DOMContentLoaded', function() {
         }
     }
 
-    // 验证并提交
+    // 当前预览的来源和分组，开始验证时使用
+    let preview = null;
+
+    // 预览所有来源，按分组汇总后让用户选择要验证和导入的分组
     function validateM3U() {
         const validUrls = validateAllInputs();
         const uploadToken = document.getElementById('uploadLabel').dataset.token;
 
         if (validUrls.length === 0 && !uploadToken) return;
 
+        const validateBtnText = document.getElementById('validateBtnText');
+        const validateSpinner = document.getElementById('validateSpinner');
+        document.getElementById('result').innerHTML = '';
+        validateBtn.disabled = true;
+        validateBtnText.textContent = '解析中...';
+        validateSpinner.classList.remove('d-none');
+
+        const requests = validUrls.map(url => ({ url }));
+        if (uploadToken) requests.unshift({ token: uploadToken });
+        Promise.all(requests.map(req => fetch('/api/preview', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(req)
+        })
+        .then(response => response.json())
+        .then(data => {
+            if (data.code !== 200) {
+                throw new Error(`解析 ${req.url || '上传的文件'} 失败：${data.message || '未知错误'}`);
+            }
+            return data.data;
+        })))
+        .then(results => {
+            preview = { urls: validUrls, token: uploadToken || '', groups: mergePreviewGroups(results) };
+            renderPreview(results, preview.groups);
+        })
+        .catch(error => {
+            showResult('error', error.message || '解析播放列表失败');
+        })
+        .finally(() => {
+            validateBtn.disabled = false;
+            validateBtnText.textContent = '验证';
+            validateSpinner.classList.add('d-none');
+        });
+    }
+
+    // 合并多个来源中同名分组的统计，保持首次出现的顺序
+    function mergePreviewGroups(results) {
+        const groups = new Map();
+        results.forEach(result => (result.groups || []).forEach(g => {
+            const group = groups.get(g.name) || { name: g.name, count: 0, duplicates: 0, exists: 0 };
+            group.count += g.count;
+            group.duplicates += g.duplicates;
+            group.exists += g.exists;
+            groups.set(g.name, group);
+        }));
+        return [...groups.values()];
+    }
+
+    // 显示预览的分组列表，默认全部选中
+    function renderPreview(results, groups) {
+        const total = results.reduce((sum, r) => sum + r.total, 0);
+        const exists = results.reduce((sum, r) => sum + r.exists, 0);
+        const warnings = results.reduce((sum, r) => sum + r.warningCount, 0);
+        document.getElementById('previewSummary').textContent =
+            `共 ${total} 个条目，${groups.length} 个分组，数据库中已有 ${exists} 个，解析警告 ${warnings} 条`;
+
+        const container = document.getElementById('previewGroups');
+        container.textContent = '';
+        groups.forEach((group, i) => {
+            const item = document.createElement('div');
+            item.className = 'form-check';
+            const input = document.createElement('input');
+            input.className = 'form-check-input';
+            input.type = 'checkbox';
+            input.id = `previewGroup${i}`;
+            input.value = group.name;
+            input.checked = true;
+            const label = document.createElement('label');
+            label.className = 'form-check-label flex-fill ms-1';
+            label.htmlFor = input.id;
+            label.textContent = group.name;
+            const count = document.createElement('span');
+            count.className = 'group-count';
+            count.textContent = `${group.count} 个` + (group.exists ? `，已有 ${group.exists}` : '');
+            item.append(input, label, count);
+            container.appendChild(item);
+        });
+        document.getElementById('previewToggleAll').textContent = '全不选';
+        document.getElementById('startValidateBtn').disabled = groups.length === 0;
+        document.getElementById('previewPanel').classList.remove('d-none');
+    }
+
+    function closePreview() {
+        preview = null;
+        document.getElementById('previewPanel').classList.add('d-none');
+    }
+
+    // 按预览中的选择创建验证任务，全部选中时不传分组
+    function startValidation() {
+        if (!preview) return;
+        const boxes = [...document.querySelectorAll('#previewGroups input')];
+        const checked = boxes.filter(box => box.checked).map(box => box.value);
+        if (checked.length === 0) {
+            showResult('error', '请至少选择一个分组');
+            return;
+        }
+        const request = {
+            urls: preview.urls,
+            token: preview.token,
+            selection: {
+                groups: checked.length === boxes.length ? [] : checked,
+                skipExisting: document.getElementById('skipExisting').checked
+            },
+            import: document.getElementById('importEnabled').checked
+        };
+        closePreview();
+        runValidation(request);
+    }
+
+    // 创建验证任务并显示进度
+    function runValidation(request) {
         const validateBtn = document.getElementById('validateBtn');
         const validateBtnText = document.getElementById('validateBtnText');
         const validateSpinner = document.getElementById('validateSpinner');
@@ -191,6 +305,7 @@ document.addEventListener('DOMContentLoaded', function() {
 
         // 清空之前的结果
         document.getElementById('result').innerHTML = '';
+        document.getElementById('failedHosts').innerHTML = '';
 
         // 显示进度区域
         progressArea.classList.remove('d-none');
@@ -203,76 +318,125 @@ document.addEventListener('DOMContentLoaded', function() {
         validateSpinner.classList.remove('d-none');
 
         // 获取延迟设置
-        const latency = parseInt(document.getElementById('latencyRange').value);
-
-        // 开始轮询进度
-        let progressInterval = setInterval(() => {
-            fetch('/api/process')
-                .then(response => response.json())
-                .then(data => {
-                    if (data.success) {
-                        const progress = data.process;
-                        progressBar.style.width = `${progress}%`;
-                        progressText.textContent = `${progress.toFixed(1)}%`;
-                        
-                        // 如果进度达到100%，停止轮询
-                        if (progress >= 100) {
-                            clearInterval(progressInterval);
-                        }
-                    }
-                })
-                .catch(error => {
-                    console.error('获取进度失败:', error);
-                });
-        }, 1000); // 每秒更新一次进度
-
-        // 发送请求到后端
+        request.maxLatency = parseInt(document.getElementById('latencyRange').value);
+
+        const resetButton = () => {
+            validateBtn.disabled = false;
+            validateBtnText.textContent = '验证';  
+            validateBtnText.classList.remove('d-none');
+            validateSpinner.classList.add('d-none');
+            progressArea.classList.add('d-none');
+        };
+
+        // 创建验证任务，再轮询任务状态直到结束
         fetch('/api/validate', {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json'
             },
-            body: JSON.stringify({
-                urls: validUrls,
-                maxLatency: latency,
-                token: uploadToken || ''
-            })
+            body: JSON.stringify(request)
         })
         .then(response => response.json())
         .then(data => {
-            if (data.success) {
-                const message = `${data.message}
-原始链接：${data.stats.total} 个
-验证通过：${data.stats.unique} 个
-有效链接：${data.stats.valid} 个
+            if (!data.success) {
+                throw new Error(data.message || '创建验证任务失败');
+            }
+            const cancelBtn = document.getElementById('cancelBtn');
+            cancelBtn.disabled = false;
+            cancelBtn.onclick = () => {
+                cancelBtn.disabled = true;
+                cancelJob(data.jobId);
+            };
+
+            const hostFailures = {};
+            return watchJob(data.jobId, event => {
+                const status = event.status;
+                progressBar.style.width = `${status.progress}%`;
+                progressText.textContent = `${status.progress.toFixed(1)}%（${status.processed}/${status.total}）`
+                    + ` 通过 ${status.succeeded}，失败 ${status.failed}`
+                    + (status.state === 'running' ? `，剩余约 ${formatETA(status.eta)}` : '');
+
+                // 统计失败最多的主机，便于尽早发现整体失效的源
+                const result = event.result;
+                if (result && result.probe && !result.probe.valid) {
+                    const host = new URL(result.url).host;
+                    hostFailures[host] = (hostFailures[host] || 0) + 1;
+                    renderFailedHosts(hostFailures);
+                }
+            });
+        })
+        .then(status => {
+            if (status.summary && status.summary.hosts) {
+                renderHostReport(status.summary.hosts);
+            }
+            if (status.state === 'done') {
+                const stats = status.summary;
+                const message = `验证完成！
+原始链接：${stats.total} 个
+验证通过：${stats.unique} 个
+有效链接：${stats.valid} 个
+未验证（协议不支持探测）：${stats.unverified || 0} 个
 
 您可以通过以下地址访问合并后的 M3U 文件：
-<a href="${data.m3uLink}" target="_blank">${data.m3uLink}</a>`;
+<a href="${stats.m3uLink}" target="_blank">${stats.m3uLink}</a>
+TXT 格式：<a href="${stats.txtLink}" target="_blank">${stats.txtLink}</a>`;
 
                 showResult('success', message.replace(/\n/g, '<br>'));
+            } else if (status.state === 'cancelled') {
+                showResult('error', `验证已取消，已完成 ${status.processed} 个链接的探测结果已保存，播放列表未更新`);
             } else {
-                showResult('error', data.message);
+                showResult('error', status.error || '验证失败');
             }
-            validateBtn.disabled = false;
-            validateBtnText.textContent = '验证';  
-            validateBtnText.classList.remove('d-none');
-            validateSpinner.classList.add('d-none');
-            progressArea.classList.add('d-none');
+            resetButton();
         })
         .catch(error => {
-            showResult('error', '验证请求失败，请稍后重试');
-            validateBtn.disabled = false;
-            validateBtnText.textContent = '验证';  
-            validateBtnText.classList.remove('d-none');
-            validateSpinner.classList.add('d-none');
-            progressArea.classList.add('d-none');
-        })
-        .finally(() => clearInterval(progressInterval));
+            showResult('error', error.message || '验证请求失败，请稍后重试');
+            resetButton();
+        });
+    }
+
+    // 显示失败次数最多的主机
+    function renderFailedHosts(hostFailures) {
+        const top = Object.entries(hostFailures)
+            .sort((a, b) => b[1] - a[1])
+            .slice(0, 5);
+        const container = document.getElementById('failedHosts');
+        container.textContent = '';
+        if (top.length === 0) return;
+        container.textContent = '失败较多的主机：' + top.map(([host, count]) => `${host}（${count}）`).join('，');
+    }
+
+    // 任务结束后按主机显示失败情况，不可用的主机剩余地址未探测
+    function renderHostReport(hosts) {
+        const container = document.getElementById('failedHosts');
+        container.textContent = '';
+        if (hosts.length === 0) return;
+        container.appendChild(document.createTextNode('失败的主机：'));
+        const list = document.createElement('ul');
+        hosts.forEach(h => {
+            const item = document.createElement('li');
+            let text = `${h.host}：共 ${h.total} 个，通过 ${h.succeeded}，失败 ${h.failed}`;
+            if (h.down) {
+                text += `，主机不可用（${h.reason}），跳过 ${h.skipped} 个`;
+            }
+            item.textContent = text;
+            list.appendChild(item);
+        });
+        container.appendChild(list);
     }
 
     // 事件监听
     addUrlBtn.addEventListener('click', () => addUrlInput());
     validateBtn.addEventListener('click', validateM3U);
+    document.getElementById('startValidateBtn').addEventListener('click', startValidation);
+    document.getElementById('closePreviewBtn').addEventListener('click', closePreview);
+    document.getElementById('previewToggleAll').addEventListener('click', e => {
+        e.preventDefault();
+        const boxes = [...document.querySelectorAll('#previewGroups input')];
+        const check = boxes.every(box => !box.checked);
+        boxes.forEach(box => { box.checked = check; });
+        e.target.textContent = check ? '全不选' : '全选';
+    });
 
     // 使用事件委托处理所有删除按钮的点击
     document.addEventListener('click', function(e) {
@@ -354,11 +518,12 @@ function handleFileUpload(event) {
     if (!file) return;
 
     // 检查文件类型
-    if (!file.name.toLowerCase().endsWith('.m3u') && !file.name.toLowerCase().endsWith('.m3u8')) {
+    const allowedExts = ['.m3u', '.m3u8', '.txt', '.xspf', '.pls', '.json'];
+    if (!allowedExts.some(ext => file.name.toLowerCase().endsWith(ext))) {
         showResult(`
             <div class="alert alert-danger" role="alert">
                 <h4 class="alert-heading">错误</h4>
-                <p>请上传 .m3u 或 .m3u8 格式的文件</p>
+                <p>请上传 .m3u、.m3u8、.txt、.xspf、.pls 或 .json 格式的文件</p>
             </div>
         `);
         return;
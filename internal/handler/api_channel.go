@@ -19,6 +19,7 @@ import (
 type ChannelValidateRequest struct {
 	ChannelNames []string `json:"channelNames"`
 	Timeout      int      `json:"timeout"`
+	ValidateLimits
 }
 
 // 根据传入的频道名称获取当前频道下有多少记录,支持多频道
@@ -127,49 +128,22 @@ func HandleChannelValidate(c *core.Context) {
 
 	allEntries := make([]m3u.Entry, 0, len(r))
 	for _, v := range r {
-		metadata := fmt.Sprintf("#EXTINF:-1 tvg-name=\"%s\" tvg-logo=\"%s\",group-title=\"%s\",%s",
-			v.ChannelName, v.StreamLogo, v.ChannelName, v.StreamName)
 		for _, url := range v.StreamUrl {
-			allEntries = append(allEntries, m3u.Entry{
-				Metadata: metadata,
-				URL:      url,
-			})
+			allEntries = append(allEntries, m3u.EntryFromStream(v, url))
 		}
 	}
 
 	timeout := time.Duration(req.Timeout) * time.Millisecond
-	validEntries, finalValidEntries, err := m3u.ValidateAndUnique(allEntries, timeout, 100)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "验证失败",
-		})
-		return
-	}
-
-	// 使用新的公共函数
-	if err := SaveValidatedEntries(finalValidEntries); err != nil {
-		c.JSON(http.StatusInternalServerError, ValidateResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-		return
-	}
+	host := c.Request.Host
+	job := m3u.NewJob(m3u.JobKindChannel, jobOwner(c))
+	go job.Run(func(job *m3u.Job) (*m3u.JobSummary, error) {
+		return runValidation(core.NewContext(), job, allEntries, validateOptions(timeout, req.ValidateLimits), host, false)
+	})
 
-	// 返回响应
 	c.JSON(http.StatusOK, ValidateResponse{
 		Success: true,
-		Message: "验证完成！",
-		Stats: struct {
-			Total  int `json:"total"`
-			Unique int `json:"unique"`
-			Valid  int `json:"valid"`
-		}{
-			Total:  len(allEntries),
-			Unique: len(validEntries),
-			Valid:  len(finalValidEntries),
-		},
-		M3ULink: fmt.Sprintf("http://%s/iptv.m3u", c.Request.Host),
+		Message: "验证任务已创建",
+		JobID:   job.ID(),
 	})
 }
 
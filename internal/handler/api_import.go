@@ -0,0 +1,338 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"tv-server/internal/logic/m3u"
+	"tv-server/internal/model"
+	"tv-server/utils/cache"
+	"tv-server/utils/core"
+	"tv-server/utils/msg"
+
+	"github.com/google/uuid"
+)
+
+// PreviewRequest 预览请求，token 与 url 二选一
+type PreviewRequest struct {
+	Token    string `json:"token"`    // 上传文件返回的 token
+	URL      string `json:"url"`      // 播放列表地址
+	MaxDepth int    `json:"maxDepth"` // 嵌套播放列表的最大展开深度，0 使用配置值，负数表示不展开
+}
+
+// PreviewEntry 预览中的单个条目
+type PreviewEntry struct {
+	m3u.ParsedEntry
+	Source    string `json:"source,omitempty"` // 来自嵌套播放列表时为该列表的地址
+	Depth     int    `json:"depth,omitempty"`  // 所在列表的嵌套深度
+	Duplicate bool   `json:"duplicate"`        // 地址与列表中之前的条目重复
+	Exists    bool   `json:"exists"`           // 地址已存在于数据库
+}
+
+// PreviewGroup 预览中的分组统计
+type PreviewGroup struct {
+	Name       string `json:"name"`
+	Count      int    `json:"count"`
+	Duplicates int    `json:"duplicates"`
+	Exists     int    `json:"exists"`
+}
+
+type PreviewResponse struct {
+	Format       string         `json:"format"`
+	Charset      string         `json:"charset"`
+	EPGURLs      []string       `json:"epgUrls,omitempty"`
+	Total        int            `json:"total"`
+	Duplicates   int            `json:"duplicates"` // 列表内重复的地址数
+	Exists       int            `json:"exists"`     // 数据库中已存在的地址数
+	Groups       []PreviewGroup `json:"groups"`     // 按首次出现的顺序排列
+	Entries      []PreviewEntry `json:"entries"`
+	Warnings     []m3u.Warning  `json:"warnings"`
+	WarningCount int            `json:"warningCount"`
+}
+
+// ImportSelection 从预览中选择的分组或条目，groups 与 urls 都为空时选择全部条目
+type ImportSelection struct {
+	Groups       []string `json:"groups"`       // 要导入的分组
+	URLs         []string `json:"urls"`         // 要导入的条目播放地址
+	SkipExisting bool     `json:"skipExisting"` // 跳过数据库中已存在的地址
+}
+
+// ImportRequest 导入请求
+type ImportRequest struct {
+	PreviewRequest
+	ImportSelection
+	DryRun bool `json:"dryRun"` // 只返回将要导入的条目，不写入数据库
+}
+
+type ImportResponse struct {
+	Imported int            `json:"imported"`
+	Skipped  int            `json:"skipped"`
+	DryRun   bool           `json:"dryRun"`
+	Entries  []PreviewEntry `json:"entries,omitempty"` // 仅在 dryRun 时返回
+}
+
+// HandlePreview 解析播放列表并返回条目、分组统计、重复情况和解析警告，不写入数据库
+func HandlePreview(c *core.Context) {
+	var req PreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, err)
+		return
+	}
+
+	var previews []PreviewEntry
+	seen := make(map[string]bool)
+	source, playlist, err := scanPlaylist(c.StdCtx, req, func(entry m3u.Entry) error {
+		if pe, ok := newPreviewEntry(entry); ok {
+			pe.Duplicate = seen[pe.URL]
+			seen[pe.URL] = true
+			previews = append(previews, pe)
+		}
+		return nil
+	})
+	if err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, err)
+		return
+	}
+	logWarnings(source, playlist)
+
+	if err := markExisting(c, previews); err != nil {
+		c.WebResponse(msg.CodeError, nil, err)
+		return
+	}
+
+	resp := PreviewResponse{
+		Format:       string(playlist.Format),
+		Charset:      playlist.Charset,
+		Total:        len(previews),
+		Entries:      previews,
+		Warnings:     playlist.Warnings,
+		WarningCount: playlist.WarningCount,
+	}
+	if resp.Entries == nil {
+		resp.Entries = []PreviewEntry{}
+	}
+	if playlist.Header != nil {
+		resp.EPGURLs = playlist.Header.EPGURLs
+	}
+
+	groupIndex := make(map[string]int)
+	for _, pe := range previews {
+		i, ok := groupIndex[pe.Channel]
+		if !ok {
+			i = len(resp.Groups)
+			groupIndex[pe.Channel] = i
+			resp.Groups = append(resp.Groups, PreviewGroup{Name: pe.Channel})
+		}
+		group := &resp.Groups[i]
+		group.Count++
+		if pe.Duplicate {
+			group.Duplicates++
+			resp.Duplicates++
+		}
+		if pe.Exists {
+			group.Exists++
+			resp.Exists++
+		}
+	}
+
+	c.WebResponse(msg.CodeOK, resp, nil)
+}
+
+// HandleImport 将预览中选中的分组或条目写入数据库，解析时只保留选中的条目
+func HandleImport(c *core.Context) {
+	var req ImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, err)
+		return
+	}
+
+	filter := newImportFilter(req.Groups, req.URLs)
+	source, playlist, err := scanPlaylist(c.StdCtx, req.PreviewRequest, filter.add)
+	if err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, err)
+		return
+	}
+	logWarnings(source, playlist)
+
+	if err := markExisting(c, filter.previews); err != nil {
+		c.WebResponse(msg.CodeError, nil, err)
+		return
+	}
+	if req.SkipExisting {
+		filter.dropExisting()
+	}
+
+	resp := ImportResponse{DryRun: req.DryRun, Imported: len(filter.entries), Skipped: filter.skipped}
+	if req.DryRun {
+		resp.Entries = filter.previews
+	} else {
+		if err := saveEntries(c, filter.entries); err != nil {
+			c.WebResponse(msg.CodeError, nil, fmt.Errorf("写入数据库失败: %v", err))
+			return
+		}
+		fmt.Printf("从 %s 导入 %d 个条目，跳过 %d 个\n", source, resp.Imported, resp.Skipped)
+	}
+
+	c.WebResponse(msg.CodeOK, resp, nil)
+}
+
+// scanPlaylist 根据 token 或 url 流式解析播放列表并展开嵌套列表，每个条目交给 fn
+// 返回来源描述和不含条目的 Playlist，读取中途出错时已交给 fn 的条目仍然有效
+// ctx 被取消后停止获取远程列表和嵌套列表，也不再把条目交给 fn
+func scanPlaylist(ctx context.Context, req PreviewRequest, fn func(m3u.Entry) error) (string, *m3u.Playlist, error) {
+	var (
+		source   string
+		playlist *m3u.Playlist
+		err      error
+	)
+	expander := m3u.NewExpander(ctx, req.URL, nestedDepth(req.MaxDepth))
+	emit := expander.Wrap(func(entry m3u.Entry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(entry)
+	})
+	switch {
+	case req.Token != "":
+		// token 用于拼接文件路径，必须是上传时生成的 UUID
+		if _, err := uuid.Parse(req.Token); err != nil {
+			return "", nil, errors.New("无效的 token")
+		}
+		source = req.Token
+		playlist, err = m3u.ScanFile(filepath.Join(cache.CacheDir, req.Token), emit)
+	case req.URL != "":
+		source = req.URL
+		playlist, err = m3u.ScanURL(ctx, req.URL, emit)
+	default:
+		return "", nil, errors.New("需要提供 token 或 url")
+	}
+
+	if playlist == nil {
+		return source, nil, fmt.Errorf("解析 %s 失败: %v", source, err)
+	}
+	if err != nil {
+		fmt.Printf("解析 %s 失败: %v\n", source, err)
+	}
+	expander.AddWarnings(playlist)
+	return source, playlist, nil
+}
+
+// newPreviewEntry 返回条目的预览信息，没有 #EXTINF 信息、无法导入的条目返回 false
+func newPreviewEntry(entry m3u.Entry) (PreviewEntry, bool) {
+	parsed := m3u.ParseEntry([]m3u.Entry{entry})
+	if len(parsed) == 0 {
+		return PreviewEntry{}, false
+	}
+	return PreviewEntry{ParsedEntry: parsed[0], Source: entry.Source, Depth: entry.Depth}, true
+}
+
+// markExisting 标记地址已存在于数据库的条目
+func markExisting(c *core.Context, previews []PreviewEntry) error {
+	urls := make([]string, 0, len(previews))
+	for _, pe := range previews {
+		urls = append(urls, pe.URL)
+	}
+	existing, err := model.GetDB().M3U().GetExistingUrls(c, urls)
+	if err != nil {
+		return fmt.Errorf("查询已有地址失败: %v", err)
+	}
+	for i := range previews {
+		previews[i].Exists = existing[previews[i].URL]
+	}
+	return nil
+}
+
+// importFilter 在流式解析时只保留选中的条目，groups 与 urls 都为空时选中全部条目
+// 列表中重复的地址只保留第一次出现的条目
+type importFilter struct {
+	groups    map[string]bool
+	urls      map[string]bool
+	selectAll bool
+	keepBare  bool // 保留没有 #EXTINF 信息的条目，这类条目只参与验证，不能导入
+	seen      map[string]bool
+
+	entries  []m3u.Entry
+	previews []PreviewEntry // 与 entries 一一对应
+	bare     []m3u.Entry    // keepBare 时选中的没有 #EXTINF 信息的条目
+	skipped  int            // 选中但被跳过的条目数
+}
+
+func newImportFilter(groups, urls []string) *importFilter {
+	return &importFilter{
+		groups:    toSet(groups),
+		urls:      toSet(urls),
+		selectAll: len(groups) == 0 && len(urls) == 0,
+		seen:      make(map[string]bool),
+	}
+}
+
+// add 作为 scanPlaylist 的回调保留选中的条目
+func (f *importFilter) add(entry m3u.Entry) error {
+	pe, ok := newPreviewEntry(entry)
+	if !ok && !f.keepBare {
+		return nil
+	}
+	duplicate := f.seen[entry.URL]
+	f.seen[entry.URL] = true
+	if !f.selectAll && !f.urls[entry.URL] && (!ok || !f.groups[pe.Channel]) {
+		return nil
+	}
+	if duplicate {
+		f.skipped++
+		return nil
+	}
+	if !ok {
+		f.bare = append(f.bare, entry)
+		return nil
+	}
+	f.entries = append(f.entries, entry)
+	f.previews = append(f.previews, pe)
+	return nil
+}
+
+// importEntries 将 filter 选中的条目写入数据库，skipExisting 时跳过数据库中已存在的地址
+// 不改变 filter 中的条目，已存在的地址仍然参与验证
+func importEntries(ctx *core.Context, filter *importFilter, skipExisting bool) error {
+	entries := filter.entries
+	if skipExisting {
+		if err := markExisting(ctx, filter.previews); err != nil {
+			return err
+		}
+		entries = make([]m3u.Entry, 0, len(filter.entries))
+		for i, pe := range filter.previews {
+			if !pe.Exists {
+				entries = append(entries, filter.entries[i])
+			}
+		}
+	}
+	if err := saveEntries(ctx, entries); err != nil {
+		return err
+	}
+	fmt.Printf("导入 %d 个条目，跳过 %d 个已存在的条目\n", len(entries), len(filter.entries)-len(entries))
+	return nil
+}
+
+// dropExisting 去掉已由 markExisting 标记为存在于数据库的条目
+func (f *importFilter) dropExisting() {
+	entries := f.entries[:0]
+	previews := f.previews[:0]
+	for i, pe := range f.previews {
+		if pe.Exists {
+			f.skipped++
+			continue
+		}
+		entries = append(entries, f.entries[i])
+		previews = append(previews, pe)
+	}
+	f.entries, f.previews = entries, previews
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -1,10 +1,12 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,7 +17,6 @@ import (
 	"tv-server/utils/core"
 	"tv-server/utils/msg"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
@@ -23,17 +24,31 @@ type ValidateRequest struct {
 	URLs       []string `json:"urls"`
 	MaxLatency int      `json:"maxLatency"`
 	Token      string   `json:"token"`
+	MaxDepth   int      `json:"maxDepth"` // 嵌套播放列表的最大展开深度，0 使用配置值，负数表示不展开
+	ValidateLimits
+
+	// Selection 要验证的分组或条目，来自预览接口，为空时验证全部条目
+	Selection ImportSelection `json:"selection"`
+	// Import 为 true 时将选中的条目写入数据库，否则只验证并生成播放列表
+	Import bool `json:"import"`
+}
+
+// ValidateLimits 验证时的并发和访问频率设置，为 0 的字段使用配置值
+type ValidateLimits struct {
+	Workers  int     `json:"workers"`  // 同时进行的探测数
+	PerHost  int     `json:"perHost"`  // 每个主机同时进行的探测数
+	HostRPS  float64 `json:"hostRps"`  // 每个主机每秒最多开始的探测数
+	JitterMs int     `json:"jitterMs"` // 每次探测前随机等待的最长毫秒数
+
+	Retries        int `json:"retries"`        // 暂时性失败的重试次数
+	RetryBackoffMs int `json:"retryBackoffMs"` // 第一次重试前等待的毫秒数，之后每次加倍
+	HostFailures   int `json:"hostFailures"`   // 同一主机连续解析失败或拒绝连接多少次后不再探测其余地址
 }
 
 type ValidateResponse struct {
 	Success bool   `json:"success"`
 	Message string `json:"message"`
-	Stats   struct {
-		Total  int `json:"total"`  // 原始链接数
-		Unique int `json:"unique"` // 去重后数量
-		Valid  int `json:"valid"`  // 有效链接数
-	} `json:"stats"`
-	M3ULink string `json:"m3uLink"` // M3U 文件链接
+	JobID   string `json:"jobId,omitempty"` // 验证任务 ID，结果见任务状态中的 summary
 }
 
 type UploadResponse struct {
@@ -41,6 +56,7 @@ type UploadResponse struct {
 	Message  string `json:"message"`
 	Token    string `json:"token"`
 	FileName string `json:"fileName"`
+	Format   string `json:"format"` // 识别出的播放列表格式
 }
 
 // 定义结构体
@@ -58,22 +74,25 @@ var (
 	}
 )
 
-// HandleProcess 获取验证进度
-// ** 需要先触发验证，在请求进度才能从0开始，否则可能获取到的进度是100
-func HandleProcess(c *core.Context) {
-	c.WebResponse(msg.CodeOK, gin.H{
-		"success": true,
-		"message": "获取进度成功",
-		"process": m3u.GetProcess(),
-	}, nil)
-}
-
 // SaveValidatedEntries 保存验证后的条目到缓存文件
 func SaveValidatedEntries(entries []m3u.Entry) error {
 	if len(entries) == 0 {
 		return nil
 	}
 
+	// 手动验证和后台验证可能同时完成，两个文件需一起更新
+	cache.CacheMutex.Lock()
+	defer cache.CacheMutex.Unlock()
+
+	if err := writeCacheFiles(entries); err != nil {
+		return err
+	}
+	cache.LastValidation = time.Now()
+	return nil
+}
+
+// writeCacheFiles 将 entries 写入缓存的 M3U 和 TXT 文件，entries 为空时写入空的播放列表，调用方需持有 cache.CacheMutex
+func writeCacheFiles(entries []m3u.Entry) error {
 	tempFile := cache.CacheFile + ".temp"
 	if err := m3u.WriteToFile(entries, tempFile); err != nil {
 		return fmt.Errorf("写入缓存失败: %v", err)
@@ -84,10 +103,31 @@ func SaveValidatedEntries(entries []m3u.Entry) error {
 		return fmt.Errorf("更新缓存文件失败: %v", err)
 	}
 
+	// 同时生成 TXT 格式，供只支持 TXT 的机顶盒应用使用
+	tempTxtFile := cache.CacheTxtFile + ".temp"
+	if err := writeTxtFile(entries, tempTxtFile); err != nil {
+		os.Remove(tempTxtFile)
+		return fmt.Errorf("写入 TXT 缓存失败: %v", err)
+	}
+
+	if err := os.Rename(tempTxtFile, cache.CacheTxtFile); err != nil {
+		os.Remove(tempTxtFile)
+		return fmt.Errorf("更新 TXT 缓存文件失败: %v", err)
+	}
 	return nil
 }
 
-// HandleValidate 处理验证请求
+func writeTxtFile(entries []m3u.Entry, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return m3u.WriteTXT(file, entries)
+}
+
+// HandleValidate 创建验证任务并立即返回任务 ID，进度和结果通过任务状态接口获取
 func HandleValidate(c *core.Context) {
 	var req ValidateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -95,86 +135,134 @@ func HandleValidate(c *core.Context) {
 		return
 	}
 
-	// 获取所有链接
-	var allEntries []m3u.Entry
+	// 确保缓存目录存在
+	if err := os.MkdirAll(cache.CacheDir, 0755); err != nil {
+		fmt.Printf("创建缓存目录失败: %v\n", err)
+		c.JSON(http.StatusInternalServerError, ValidateResponse{
+			Success: false,
+			Message: "系统错误：无法访问缓存目录",
+		})
+		return
+	}
 
-	// 处理上传的文件和URLs
-	if req.Token != "" {
-		filePath := filepath.Join(cache.CacheDir, req.Token)
-		fmt.Printf("处理上传的文件，Token: %s, 文件路径: %s\n", req.Token, filePath)
-
-		// 确保缓存目录存在
-		if err := os.MkdirAll(cache.CacheDir, 0755); err != nil {
-			fmt.Printf("创建缓存目录失败: %v\n", err)
-			c.JSON(http.StatusInternalServerError, ValidateResponse{
-				Success: false,
-				Message: "系统错误：无法访问缓存目录",
-			})
-			return
+	host := c.Request.Host
+	job := m3u.NewJob(m3u.JobKindPlaylist, jobOwner(c))
+	go job.Run(func(job *m3u.Job) (*m3u.JobSummary, error) {
+		// 请求结束后 gin 会复用 c，任务中使用独立的上下文
+		ctx := core.NewContext()
+		filter := newImportFilter(req.Selection.Groups, req.Selection.URLs)
+		filter.keepBare = true
+		collectEntries(job.Context(), req, filter.add)
+		if err := job.Context().Err(); err != nil {
+			return nil, err
 		}
 
-		if _, err := os.Stat(filePath); err != nil {
-			fmt.Printf("文件不存在或无法访问: %v\n", err)
-		} else {
-			entries, err := m3u.ParseFile(filePath)
-			if err != nil {
-				fmt.Printf("解析文件失败: %v\n", err)
-			} else {
-				fmt.Printf("成功解析文件，获取到 %d 个条目\n", len(entries))
-				allEntries = append(allEntries, entries...)
+		// 没有 #EXTINF 信息的地址同样需要验证，只是不会写入数据库
+		allEntries := append(filter.entries[:len(filter.entries):len(filter.entries)], filter.bare...)
+		fmt.Printf("开始验证 %d 个链接，跳过 %d 个重复的链接\n", len(allEntries), filter.skipped)
+		// 只有选择导入时才写入数据库，避免未经预览的播放列表污染数据库
+		if req.Import {
+			if err := importEntries(ctx, filter, req.Selection.SkipExisting); err != nil {
+				fmt.Printf("写入数据库失败: %v\n", err)
 			}
 		}
+
+		//req.MaxLatency单位是ms
+		maxLatency := time.Duration(req.MaxLatency) * time.Millisecond
+		opts := validateOptions(maxLatency, req.ValidateLimits)
+		// 解析时只预先展开 .m3u 和 .txt，其余返回频道列表的地址在验证时展开
+		opts.MaxDepth = nestedDepth(req.MaxDepth)
+		return runValidation(ctx, job, allEntries, opts, host, req.Import)
+	})
+
+	c.JSON(http.StatusOK, ValidateResponse{
+		Success: true,
+		Message: "验证任务已创建",
+		JobID:   job.ID(),
+	})
+}
+
+// collectEntries 依次流式解析上传的文件和远程播放列表，每个条目交给 fn
+// ctx 被取消后停止解析，正在获取的播放列表也会中断
+func collectEntries(ctx context.Context, req ValidateRequest, fn func(m3u.Entry) error) {
+	var sources []PreviewRequest
+	if req.Token != "" {
+		sources = append(sources, PreviewRequest{Token: req.Token, MaxDepth: req.MaxDepth})
 	}
 	for _, url := range req.URLs {
-		if entries, err := m3u.ParseURL(url); err == nil {
-			allEntries = append(allEntries, entries...)
-		}
+		sources = append(sources, PreviewRequest{URL: url, MaxDepth: req.MaxDepth})
 	}
 
-	// 验证链接
-	fmt.Printf("开始验证 %d 个链接\n", len(allEntries))
+	for _, src := range sources {
+		if ctx.Err() != nil {
+			break
+		}
+		source, playlist, err := scanPlaylist(ctx, src, fn)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		logWarnings(source, playlist)
+	}
+}
 
-	//将allEntries写入mongodb
-	if err := saveEntries(c, allEntries); err != nil {
-		fmt.Printf("写入MongoDB失败: %v\n", err)
+// runValidation 验证条目并去重，保存探测结果后重新生成缓存的播放列表
+// importExpanded 时将验证中从嵌套频道列表展开的条目写入数据库
+// 任务被取消时只保存已完成的探测结果，缓存的播放列表保持不变，避免尚未验证的频道被移除
+func runValidation(ctx *core.Context, job *m3u.Job, entries []m3u.Entry, opts m3u.ValidateOptions, host string, importExpanded bool) (*m3u.JobSummary, error) {
+	result, err := m3u.ValidateAndUnique(job.Context(), job, entries, opts)
+	if result == nil {
+		return nil, fmt.Errorf("验证失败: %w", err)
+	}
+	if importExpanded && len(result.Expanded) > 0 {
+		if err := saveEntries(ctx, result.Expanded); err != nil {
+			fmt.Printf("写入展开的条目失败: %v\n", err)
+		}
 	}
 
-	//req.MaxLatency单位是ms
-	maxLatency := time.Duration(req.MaxLatency) * time.Millisecond
-	//开始验证并去重
-	validEntries, finalValidEntries, err := m3u.ValidateAndUnique(allEntries, maxLatency, 100)
+	// 记录各地址的探测结果，失败不影响生成播放列表
+	// ctx 不随任务取消，已完成的结果总能完整写入
+	probes := result.Recorded()
+	stats, saveErr := model.GetDB().M3U().SaveProbeResults(ctx, probes)
+	if saveErr != nil {
+		fmt.Printf("保存探测结果失败: %v\n", saveErr)
+	}
+	// 按历次验证的成功比例决定是否保留，统计保存失败时以本次探测结果为准
+	result.Select(stats, healthPolicy())
+	// 本次被归档的地址不再写入播放列表
+	restored, archived := applyArchivePolicy(ctx, probes, stats)
+	result.Exclude(archived)
+
+	summary := &m3u.JobSummary{
+		Total:      len(entries) + len(result.Expanded),
+		Unique:     len(result.Valid),
+		Valid:      len(result.Unique),
+		Unverified: countUnverified(result.Unique),
+		Hosts:      result.Hosts,
+		Archived:   len(archived),
+		Restored:   len(restored),
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ValidateResponse{
-			Success: false,
-			Message: "验证失败",
-		})
-		return
+		return summary, err
 	}
 
-	// 使用新的公共函数
-	if err := SaveValidatedEntries(finalValidEntries); err != nil {
-		c.JSON(http.StatusInternalServerError, ValidateResponse{
-			Success: false,
-			Message: err.Error(),
-		})
-		return
+	if err := SaveValidatedEntries(result.Unique); err != nil {
+		return nil, err
 	}
+	summary.M3ULink = fmt.Sprintf("http://%s/iptv.m3u", host)
+	summary.TxtLink = fmt.Sprintf("http://%s/iptv.txt", host)
+	return summary, nil
+}
 
-	// 返回响应
-	c.JSON(http.StatusOK, ValidateResponse{
-		Success: true,
-		Message: "验证完成！",
-		Stats: struct {
-			Total  int `json:"total"`
-			Unique int `json:"unique"`
-			Valid  int `json:"valid"`
-		}{
-			Total:  len(allEntries),
-			Unique: len(validEntries),
-			Valid:  len(finalValidEntries),
-		},
-		M3ULink: fmt.Sprintf("http://%s/iptv.m3u", c.Request.Host),
-	})
+// countUnverified 统计未经验证的条目数
+func countUnverified(entries []m3u.Entry) int {
+	count := 0
+	for _, entry := range entries {
+		if entry.Unverified {
+			count++
+		}
+	}
+	return count
 }
 
 // 返回缓存的M3U文件
@@ -189,6 +277,18 @@ func HandleM3U(c *core.Context) {
 	c.File(cache.CacheFile)
 }
 
+// HandleTXT 返回 DIYP/TXT 格式的缓存文件
+func HandleTXT(c *core.Context) {
+	if _, err := os.Stat(cache.CacheTxtFile); os.IsNotExist(err) {
+		c.String(http.StatusNotFound, "No TXT file available. Please validate M3U URLs first.")
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Content-Disposition", "inline")
+	c.File(cache.CacheTxtFile)
+}
+
 // HandleUpload 处理文件上传
 func HandleUpload(c *core.Context) {
 	file, err := c.FormFile("file")
@@ -236,24 +336,175 @@ func HandleUpload(c *core.Context) {
 		}
 	}()
 
+	format, err := m3u.DetectFileFormat(tempFilePath)
+	if err != nil {
+		fmt.Printf("识别文件格式失败: %v\n", err)
+	}
+
 	c.JSON(http.StatusOK, UploadResponse{
 		Success:  true,
 		Message:  "文件上传成功",
 		Token:    token,
 		FileName: file.Filename,
+		Format:   string(format),
 	})
 }
 
+// nestedDepth 返回嵌套播放列表的最大展开深度，请求中未指定时使用配置值
+func nestedDepth(reqDepth int) int {
+	depth := reqDepth
+	if depth == 0 {
+		depth = core.GetConfig().Import.MaxNestedDepth
+	}
+	if depth == 0 {
+		depth = m3u.DefaultMaxDepth
+	}
+	if depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+const (
+	// maxWorkers 请求中允许设置的最大并发数
+	maxWorkers = 1000
+	// maxRetries 请求中允许设置的最大重试次数
+	maxRetries = 5
+
+	// defaultMinSuccessRatio 未配置时保留地址所需的最低成功比例
+	defaultMinSuccessRatio = 0.5
+	// defaultMaxConsecutiveFailures 未配置时连续失败多少次后不再保留
+	defaultMaxConsecutiveFailures = 3
+	// defaultHostFailures 未配置时同一主机连续硬失败多少次后不再探测其余地址
+	defaultHostFailures = 3
+)
+
+// validateOptions 合并请求和配置中的并发设置，请求中的非零值优先
+func validateOptions(maxLatency time.Duration, limits ValidateLimits) m3u.ValidateOptions {
+	cfg := core.GetConfig().Validate
+	opts := m3u.ValidateOptions{
+		MaxLatency: maxLatency,
+		Workers:    cfg.Workers,
+		PerHost:    cfg.PerHost,
+		HostRPS:    cfg.HostRPS,
+		Jitter:     time.Duration(cfg.JitterMs) * time.Millisecond,
+
+		Retries:      cfg.Retries,
+		RetryBackoff: time.Duration(cfg.RetryBackoffMs) * time.Millisecond,
+		HostFailures: cfg.HostFailures,
+
+		SkipStaleCheck: cfg.SkipStaleCheck,
+	}
+	if opts.HostFailures == 0 {
+		opts.HostFailures = defaultHostFailures
+	}
+	if limits.Workers > 0 {
+		opts.Workers = min(limits.Workers, maxWorkers)
+	}
+	if limits.PerHost > 0 {
+		opts.PerHost = limits.PerHost
+	}
+	if limits.HostRPS > 0 {
+		opts.HostRPS = limits.HostRPS
+	}
+	if limits.JitterMs > 0 {
+		opts.Jitter = time.Duration(limits.JitterMs) * time.Millisecond
+	}
+	if limits.Retries > 0 {
+		opts.Retries = min(limits.Retries, maxRetries)
+	}
+	if limits.RetryBackoffMs > 0 {
+		opts.RetryBackoff = time.Duration(limits.RetryBackoffMs) * time.Millisecond
+	}
+	if limits.HostFailures > 0 {
+		opts.HostFailures = limits.HostFailures
+	}
+	return opts
+}
+
+// healthPolicy 返回配置的保留策略，未配置的字段使用默认值
+func healthPolicy() m3u.HealthPolicy {
+	cfg := core.GetConfig().Validate
+	policy := m3u.HealthPolicy{
+		MinSuccessRatio:        defaultMinSuccessRatio,
+		MaxConsecutiveFailures: defaultMaxConsecutiveFailures,
+	}
+	if cfg.MinSuccessRatio > 0 {
+		policy.MinSuccessRatio = cfg.MinSuccessRatio
+	}
+	if cfg.MaxConsecutiveFailures > 0 {
+		policy.MaxConsecutiveFailures = cfg.MaxConsecutiveFailures
+	}
+	return policy
+}
+
+// logWarnings 输出解析警告，条数过多时只输出前若干条
+func logWarnings(source string, playlist *m3u.Playlist) {
+	if playlist.Charset != "" && playlist.Charset != m3u.CharsetUTF8 {
+		fmt.Printf("%s 使用 %s 编码，已转换为 UTF-8\n", source, playlist.Charset)
+	}
+	if playlist.WarningCount == 0 {
+		return
+	}
+
+	const maxLogged = 20
+	fmt.Printf("解析 %s 共产生 %d 条警告\n", source, playlist.WarningCount)
+	for i, w := range playlist.Warnings {
+		if i >= maxLogged {
+			fmt.Printf("  ... 其余 %d 条警告已省略\n", playlist.WarningCount-maxLogged)
+			break
+		}
+		fmt.Printf("  %s\n", w)
+	}
+}
+
 func saveEntries(ctx *core.Context, entries []m3u.Entry) error {
 	parsedEntries := m3u.ParseEntry(entries)
 	msList := make([]*types.MediaStream, 0, len(entries))
 
+	// 记录各播放地址的请求选项、来源、所属播放列表和节目单地址
+	optionMap := make(map[string]*types.StreamOption)
+	sourceMap := make(map[string]string)
+	originMap := make(map[string]string)
+	epgMap := make(map[string]string)
+	for _, entry := range entries {
+		if entry.Options != nil {
+			optionMap[entry.URL] = entry.Options
+		}
+		if entry.Source != "" {
+			sourceMap[entry.URL] = entry.Source
+		}
+		if entry.Origin != "" {
+			originMap[entry.URL] = entry.Origin
+		}
+		if len(entry.EPGURLs) > 0 {
+			epgMap[entry.URL] = strings.Join(entry.EPGURLs, ",")
+		}
+	}
+
 	for _, parsedEntry := range parsedEntries {
 		ms := &types.MediaStream{
-			StreamName:  parsedEntry.Title,
-			ChannelName: parsedEntry.Channel,
-			StreamUrl:   []string{parsedEntry.URL},
-			StreamLogo:  parsedEntry.Logo,
+			StreamName:    parsedEntry.Title,
+			ChannelName:   parsedEntry.Channel,
+			StreamUrl:     []string{parsedEntry.URL},
+			StreamLogo:    parsedEntry.Logo,
+			TvgID:         parsedEntry.TvgID,
+			TvgName:       parsedEntry.TvgName,
+			TvgChno:       parsedEntry.TvgChno,
+			TvgLanguage:   parsedEntry.TvgLanguage,
+			TvgCountry:    parsedEntry.TvgCountry,
+			Radio:         parsedEntry.Radio,
+			Catchup:       parsedEntry.Catchup,
+			CatchupSource: parsedEntry.CatchupSource,
+			CatchupDays:   parsedEntry.CatchupDays,
+			Attrs:         parsedEntry.Attrs,
+			EpgUrl:        epgMap[parsedEntry.URL],
+		}
+		opt, source, origin := optionMap[parsedEntry.URL], sourceMap[parsedEntry.URL], originMap[parsedEntry.URL]
+		if opt != nil || source != "" || origin != "" {
+			ms.UrlInfo = map[string]*types.StreamUrlInfo{
+				parsedEntry.URL: {URL: parsedEntry.URL, Options: opt, Source: source, Origin: origin},
+			}
 		}
 		msList = append(msList, ms)
 	}
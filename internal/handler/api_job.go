@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"tv-server/internal/logic/m3u"
+	"tv-server/utils/core"
+	"tv-server/utils/msg"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// defaultJobListLimit 任务列表默认返回的条数
+	defaultJobListLimit = 20
+	// streamKeepAlive 没有事件时发送心跳的间隔，避免连接被代理断开
+	streamKeepAlive = 15 * time.Second
+)
+
+// jobOwner 返回发起任务的用户，目前没有登录，以客户端地址区分
+func jobOwner(c *core.Context) string {
+	return c.ClientIP()
+}
+
+// HandleJobStatus 获取验证任务的状态
+func HandleJobStatus(c *core.Context) {
+	job := m3u.GetJob(c.Query("id"))
+	if job == nil {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("任务不存在"))
+		return
+	}
+	c.WebResponse(msg.CodeOK, job.Status(), nil)
+}
+
+// CancelJobRequest 取消任务的请求
+type CancelJobRequest struct {
+	ID string `json:"id" binding:"required"`
+}
+
+// HandleJobCancel 取消排队中或运行中的验证任务
+// 已完成的探测结果会被保存，缓存的播放列表保持不变
+func HandleJobCancel(c *core.Context) {
+	var req CancelJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, err)
+		return
+	}
+	job := m3u.GetJob(req.ID)
+	if job == nil {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("任务不存在"))
+		return
+	}
+	if !job.Cancel() {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("任务已结束"))
+		return
+	}
+	c.WebResponse(msg.CodeOK, job.Status(), nil)
+}
+
+// HandleJobList 列出最近的验证任务，mine=1 时只返回当前用户的任务
+func HandleJobList(c *core.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = defaultJobListLimit
+	}
+	owner := ""
+	if c.Query("mine") == "1" {
+		owner = jobOwner(c)
+	}
+	c.WebResponse(msg.CodeOK, m3u.ListJobs(owner, limit), nil)
+}
+
+// HandleProcess 获取验证进度，未指定任务 ID 时返回当前用户最近一个任务的进度
+func HandleProcess(c *core.Context) {
+	var status m3u.JobStatus
+	if id := c.Query("id"); id != "" {
+		status = m3u.GetJob(id).Status()
+	} else if list := m3u.ListJobs(jobOwner(c), 1); len(list) > 0 {
+		status = list[0]
+	}
+	c.WebResponse(msg.CodeOK, gin.H{
+		"success": true,
+		"message": "获取进度成功",
+		"jobId":   status.ID,
+		"state":   status.State,
+		"process": status.Progress,
+	}, nil)
+}
+
+// HandleJobEvents 以 SSE 推送验证任务的事件，包括每个地址的结果、累计统计和预计剩余时间
+func HandleJobEvents(c *core.Context) {
+	job := m3u.GetJob(c.Query("id"))
+	if job == nil {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("任务不存在"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭 nginx 的响应缓冲，否则事件会被攒到一起发送
+	c.Header("X-Accel-Buffering", "no")
+
+	streamJob(c.Request.Context(), job, func(event m3u.JobEvent) error {
+		c.SSEvent(event.Type, event)
+		c.Writer.Flush()
+		if err := c.Errors.Last(); err != nil {
+			return err
+		}
+		return nil
+	}, func() error {
+		_, err := io.WriteString(c.Writer, ": ping\n\n")
+		c.Writer.Flush()
+		return err
+	})
+}
+
+// HandleJobSocket 以 WebSocket 推送验证任务的事件，供无法使用 SSE 的客户端使用
+// 每条消息是一个 JSON 格式的 m3u.JobEvent
+func HandleJobSocket(c *core.Context) {
+	job := m3u.GetJob(c.Query("id"))
+	if job == nil {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("任务不存在"))
+		return
+	}
+
+	websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// 客户端不会发送消息，读取出错说明连接已断开
+		go func() {
+			io.Copy(io.Discard, ws)
+			cancel()
+		}()
+
+		streamJob(ctx, job, func(event m3u.JobEvent) error {
+			return websocket.JSON.Send(ws, event)
+		}, nil)
+	}).ServeHTTP(c.Writer, c.Request)
+}
+
+// streamJob 先发送任务的当前状态，再转发任务事件，直到任务结束、连接断开或发送失败
+// keepAlive 为空时不发送心跳
+func streamJob(ctx context.Context, job *m3u.Job, send func(m3u.JobEvent) error, keepAlive func() error) {
+	events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	// 订阅之前已完成的地址不再逐条推送，当前状态中已包含其统计
+	last := m3u.JobEvent{Type: m3u.JobEventStatus, Status: job.Status()}
+	if err := send(last); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if keepAlive != nil && keepAlive() != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				// 最终状态的事件可能因订阅者处理不及时被丢弃，此时补发
+				if last.Type != m3u.JobEventStatus || last.Status.EndedAt == 0 {
+					send(m3u.JobEvent{Type: m3u.JobEventStatus, Status: job.Status()})
+				}
+				return
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			last = event
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+	"tv-server/internal/logic/m3u"
+	"tv-server/internal/model"
+	"tv-server/internal/model/types"
+	"tv-server/utils/cache"
+	"tv-server/utils/core"
+	"tv-server/utils/msg"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultRecheckInterval 未配置时后台验证重新检查自动归档的地址的间隔
+const defaultRecheckInterval = 7 * 24 * time.Hour
+
+// ArchiveRequest 手动归档或恢复播放地址的请求
+type ArchiveRequest struct {
+	URLs []string `json:"urls" binding:"required"`
+}
+
+// archivePolicy 返回配置的自动归档策略
+func archivePolicy() m3u.ArchivePolicy {
+	cfg := core.GetConfig().Archive
+	return m3u.ArchivePolicy{
+		MaxConsecutiveFailures: cfg.MaxConsecutiveFailures,
+		MaxDeadTime:            time.Duration(cfg.MaxDeadDays) * 24 * time.Hour,
+	}
+}
+
+// recheckInterval 返回重新检查已归档地址的间隔
+func recheckInterval() time.Duration {
+	if days := core.GetConfig().Archive.RecheckDays; days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return defaultRecheckInterval
+}
+
+// applyArchivePolicy 恢复本次验证通过的已归档地址，按策略归档长期失效的地址，返回本次恢复和归档的地址
+// 手动归档的地址只能手动恢复；失败只记录日志，不影响验证结果
+func applyArchivePolicy(ctx *core.Context, probes []*types.ProbeResult, stats map[string]*types.ProbeStats) (restored, archived map[string]bool) {
+	db := model.GetDB()
+	plan := archivePolicy().Plan(probes, stats, time.Now())
+	restored = make(map[string]bool)
+	archived = make(map[string]bool)
+
+	urls, err := db.M3U().RestoreUrls(ctx, plan.Restore, false)
+	if err != nil {
+		log.Printf("恢复已归档的地址失败: %v", err)
+	}
+	for _, url := range urls {
+		restored[url] = true
+	}
+	for reason, candidates := range plan.Archive {
+		urls, err := db.M3U().ArchiveUrls(ctx, candidates, reason)
+		if err != nil {
+			log.Printf("归档失效地址失败: %v", err)
+			continue
+		}
+		for _, url := range urls {
+			archived[url] = true
+		}
+	}
+	if len(restored) > 0 || len(archived) > 0 {
+		log.Printf("恢复 %d 个已归档的地址，归档 %d 个失效地址", len(restored), len(archived))
+	}
+	return restored, archived
+}
+
+// HandleArchive 手动归档播放地址，归档的地址同时从正在提供的播放列表中移除
+func HandleArchive(c *core.Context) {
+	var req ArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("无效的请求参数: %v", err))
+		return
+	}
+
+	urls, err := model.GetDB().M3U().ArchiveUrls(c, req.URLs, types.ArchiveReasonManual)
+	if err != nil {
+		c.WebResponse(msg.CodeError, nil, err)
+		return
+	}
+	if err := removeFromPlaylist(urls); err != nil {
+		log.Printf("从播放列表中移除已归档的地址失败: %v", err)
+	}
+	c.WebResponse(msg.CodeOK, gin.H{"archived": urls}, nil)
+}
+
+// HandleRestore 手动恢复已归档的播放地址，恢复的地址在下一次验证通过后重新加入播放列表
+func HandleRestore(c *core.Context) {
+	var req ArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("无效的请求参数: %v", err))
+		return
+	}
+
+	urls, err := model.GetDB().M3U().RestoreUrls(c, req.URLs, true)
+	if err != nil {
+		c.WebResponse(msg.CodeError, nil, err)
+		return
+	}
+	c.WebResponse(msg.CodeOK, gin.H{"restored": urls}, nil)
+}
+
+// removeFromPlaylist 从正在提供的播放列表中移除 urls，没有播放列表或没有需要移除的条目时不做改动
+// 读取和写入在同一次加锁中完成，以免覆盖同时完成的验证结果；移除后没有条目时写入空的播放列表
+func removeFromPlaylist(urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	removed := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		removed[url] = true
+	}
+
+	cache.CacheMutex.Lock()
+	defer cache.CacheMutex.Unlock()
+
+	playlist, err := m3u.ParseFile(cache.CacheFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries := make([]m3u.Entry, 0, len(playlist.Entries))
+	for _, entry := range playlist.Entries {
+		if !removed[entry.URL] {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == len(playlist.Entries) {
+		return nil
+	}
+	return writeCacheFiles(entries)
+}
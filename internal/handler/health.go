@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+	"tv-server/internal/logic/m3u"
+	"tv-server/internal/model"
+	"tv-server/internal/model/types"
+	"tv-server/utils/core"
+	"tv-server/utils/msg"
+)
+
+const (
+	// defaultHealthRawHours 未配置时原始验证记录保留的小时数
+	defaultHealthRawHours = 48
+	// defaultHealthBucketMinutes 未配置时汇总验证记录的时间段分钟数
+	defaultHealthBucketMinutes = 60
+	// defaultHealthRetentionDays 未配置时验证记录保留的天数
+	defaultHealthRetentionDays = 90
+	// healthCompactInterval 两次汇总和清理验证记录之间的间隔
+	healthCompactInterval = time.Hour
+
+	// defaultHealthDays 未指定时统计最近多少天的可用性
+	defaultHealthDays = 7
+	// maxSeriesPoints 返回的时间序列最多包含的时间段数
+	maxSeriesPoints = 96
+	// minSeriesSpan 时间序列中每个时间段的最小秒数
+	minSeriesSpan = 5 * 60
+)
+
+// healthRetention 验证记录的保留设置，未配置的字段使用默认值
+type healthRetention struct {
+	raw       time.Duration // 原始记录保留的时间
+	bucket    time.Duration // 汇总的时间段
+	retention time.Duration // 所有记录保留的时间
+}
+
+func healthRetentionConfig() healthRetention {
+	cfg := core.GetConfig().Health
+	r := healthRetention{
+		raw:       defaultHealthRawHours * time.Hour,
+		bucket:    defaultHealthBucketMinutes * time.Minute,
+		retention: defaultHealthRetentionDays * 24 * time.Hour,
+	}
+	if cfg.RawHours > 0 {
+		r.raw = time.Duration(cfg.RawHours) * time.Hour
+	}
+	if cfg.BucketMinutes > 0 {
+		r.bucket = time.Duration(cfg.BucketMinutes) * time.Minute
+	}
+	if cfg.RetentionDays > 0 {
+		r.retention = time.Duration(cfg.RetentionDays) * 24 * time.Hour
+	}
+	return r
+}
+
+// StartHealthRetention 启动后立即并在之后每小时汇总过期的原始验证记录、删除超过保留时间的记录，ctx 结束后停止
+func StartHealthRetention(ctx context.Context) {
+	go func() {
+		for {
+			compactHealthHistory(core.NewContext())
+			if m3u.SleepContext(ctx, healthCompactInterval) != nil {
+				return
+			}
+		}
+	}()
+}
+
+func compactHealthHistory(ctx *core.Context) {
+	r := healthRetentionConfig()
+	now := time.Now()
+	err := model.GetDB().M3U().CompactHealthHistory(ctx,
+		now.Add(-r.raw).Unix(), int64(r.bucket.Seconds()), now.Add(-r.retention).Unix())
+	if err != nil {
+		log.Printf("汇总验证记录失败: %v", err)
+	}
+}
+
+// URLHealth 单个播放地址的可用性
+type URLHealth struct {
+	URL        string `json:"url"`
+	StreamName string `json:"streamName,omitempty"`
+	*types.HealthSummary
+}
+
+// StreamHealthResponse 播放地址或频道分组的可用性
+type StreamHealthResponse struct {
+	Since   int64                `json:"since"`
+	Span    int64                `json:"span"` // Series 中每个时间段的秒数
+	Summary *types.HealthSummary `json:"summary"`
+	URLs    []URLHealth          `json:"urls"`   // 各播放地址的可用性
+	Series  []*types.HealthPoint `json:"series"` // 所有地址合并后按时间段汇总的验证记录，用于绘制图表
+}
+
+// HandleStreamHealth 返回单个播放地址或整个频道分组在最近 days 天内的可用性
+// 使用 url 指定播放地址，或使用 channelName 指定频道分组，可再用 streamName 只统计其中的一个媒体流
+func HandleStreamHealth(c *core.Context) {
+	days := defaultHealthDays
+	if value := c.Query("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days <= 0 {
+			c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("无效的天数: %s", value))
+			return
+		}
+	}
+	if c.Query("url") == "" && c.Query("channelName") == "" {
+		c.WebResponse(msg.CodeBadRequest, nil, fmt.Errorf("需要指定 url 或 channelName"))
+		return
+	}
+	retention := healthRetentionConfig()
+	window := min(time.Duration(days)*24*time.Hour, retention.retention)
+
+	names, err := healthURLs(c)
+	if err != nil {
+		c.WebResponse(msg.CodeError, nil, err)
+		return
+	}
+	urls := make([]string, 0, len(names))
+	for url := range names {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	now := time.Now()
+	since := now.Add(-window).Unix()
+	points, err := model.GetDB().M3U().GetHealthHistory(c, urls, since)
+	if err != nil {
+		c.WebResponse(msg.CodeError, nil, err)
+		return
+	}
+
+	byURL := make(map[string][]*types.HealthPoint)
+	for _, p := range points {
+		byURL[p.URL] = append(byURL[p.URL], p)
+	}
+	resp := &StreamHealthResponse{
+		Since:   since,
+		Span:    seriesSpan(window, retention),
+		Summary: types.SummarizeHealth(points),
+		URLs:    make([]URLHealth, 0, len(urls)),
+	}
+	for _, url := range urls {
+		resp.URLs = append(resp.URLs, URLHealth{URL: url, StreamName: names[url], HealthSummary: types.SummarizeHealth(byURL[url])})
+	}
+
+	// 合并所有地址的记录后按时间段汇总
+	merged := make([]*types.HealthPoint, 0, len(points))
+	for _, p := range points {
+		merged = append(merged, &types.HealthPoint{
+			Time: p.Time, Checks: p.Checks, Successes: p.Successes,
+			Latency: p.Latency, ErrorClass: p.ErrorClass, FailedAt: p.FailedAt,
+		})
+	}
+	resp.Series = types.DownsampleHealth(merged, resp.Span)
+
+	c.WebResponse(msg.CodeOK, resp, nil)
+}
+
+// healthURLs 按请求参数返回要统计的播放地址，value 为所属媒体流的名称
+func healthURLs(c *core.Context) (map[string]string, error) {
+	names := make(map[string]string)
+	if url := c.Query("url"); url != "" {
+		names[url] = ""
+		return names, nil
+	}
+	filter := &types.QueryFilter{ChannelNameList: []string{c.Query("channelName")}}
+	if streamName := c.Query("streamName"); streamName != "" {
+		filter.StreamNameList = []string{streamName}
+	}
+	streams, err := model.GetDB().M3U().GetList(c, filter)
+	if err != nil {
+		return nil, fmt.Errorf("获取频道记录失败: %w", err)
+	}
+	for _, stream := range streams {
+		for _, url := range stream.StreamUrl {
+			names[url] = stream.StreamName
+		}
+	}
+	return names, nil
+}
+
+// seriesSpan 返回时间序列中每个时间段的秒数，使序列不超过 maxSeriesPoints 个时间段
+// 统计范围包含已汇总的记录时取汇总时间段的整数倍，避免一条汇总记录被计入错误的时间段
+func seriesSpan(window time.Duration, retention healthRetention) int64 {
+	unit := int64(minSeriesSpan)
+	if window > retention.raw {
+		unit = max(unit, int64(retention.bucket.Seconds()))
+	}
+	span := int64(window.Seconds()) / maxSeriesPoints
+	return max((span+unit-1)/unit*unit, unit)
+}
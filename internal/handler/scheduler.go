@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"tv-server/internal/logic/m3u"
+	"tv-server/internal/model"
+	"tv-server/internal/model/types"
+	"tv-server/utils/cache"
+	"tv-server/utils/core"
+	"tv-server/utils/msg"
+)
+
+const (
+	// defaultScheduleInterval 未配置时两次后台验证之间的间隔
+	defaultScheduleInterval = 6 * time.Hour
+	// defaultScheduleLatency 未配置时后台验证单个地址的最大延迟
+	defaultScheduleLatency = 5 * time.Second
+	// schedulerStartDelay 启动后第一次验证前等待的时间，避免与启动时的其它工作争抢资源
+	schedulerStartDelay = time.Minute
+	// recentFailureWindow 在该时间内验证失败的地址优先重新验证
+	recentFailureWindow = 24 * time.Hour
+	// schedulerOwner 后台验证任务的创建者
+	schedulerOwner = "scheduler"
+)
+
+// SchedulerStatus 后台验证的状态
+type SchedulerStatus struct {
+	Enabled    bool   `json:"enabled"`
+	Interval   int    `json:"interval"` // 秒
+	QuietHours string `json:"quietHours,omitempty"`
+	Quiet      bool   `json:"quiet"`             // 当前是否处于静默时段
+	NextRun    int64  `json:"nextRun,omitempty"` // 下一次验证的时间
+	LastRun    int64  `json:"lastRun,omitempty"`
+	LastJobID  string `json:"lastJobId,omitempty"` // 最近一次验证的任务 ID，进度和结果见任务状态
+	Changed    bool   `json:"changed"`             // 最近一次验证是否更新了播放列表
+	Error      string `json:"error,omitempty"`
+}
+
+// scheduler 后台定时重新验证数据库中的所有播放地址
+var scheduler = struct {
+	mu     sync.Mutex
+	status SchedulerStatus
+	quiet  *m3u.QuietHours
+}{}
+
+// StartScheduler 按配置启动后台验证，未启用时直接返回，ctx 结束后停止并取消进行中的验证
+func StartScheduler(ctx context.Context) {
+	cfg := core.GetConfig().Scheduler
+	interval := time.Duration(cfg.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		interval = defaultScheduleInterval
+	}
+	quiet, err := m3u.ParseQuietHours(cfg.QuietHours)
+	if err != nil {
+		log.Printf("静默时段配置无效，已忽略: %v", err)
+	}
+
+	scheduler.mu.Lock()
+	scheduler.quiet = quiet
+	scheduler.status = SchedulerStatus{
+		Enabled:    cfg.Enabled,
+		Interval:   int(interval.Seconds()),
+		QuietHours: cfg.QuietHours,
+	}
+	scheduler.mu.Unlock()
+	if !cfg.Enabled {
+		return
+	}
+
+	log.Printf("后台验证已启用，间隔 %s", interval)
+	go func() {
+		wait := schedulerStartDelay
+		for {
+			setNextRun(time.Now().Add(wait))
+			if m3u.SleepContext(ctx, wait) != nil {
+				return
+			}
+			// 静默时段内不验证，等到时段结束
+			if remaining := quiet.Remaining(time.Now()); remaining > 0 {
+				log.Printf("处于静默时段，后台验证推迟 %s", remaining.Round(time.Minute))
+				wait = remaining
+				continue
+			}
+			runScheduled(ctx)
+			wait = interval
+		}
+	}()
+}
+
+func setNextRun(t time.Time) {
+	scheduler.mu.Lock()
+	scheduler.status.NextRun = t.Unix()
+	scheduler.mu.Unlock()
+}
+
+// runScheduled 创建后台验证任务并等待结束，任务和手动创建的任务一样可以查询进度和取消
+func runScheduled(ctx context.Context) {
+	job := m3u.NewJob(m3u.JobKindScheduled, schedulerOwner)
+	stop := context.AfterFunc(ctx, func() { job.Cancel() })
+	defer stop()
+
+	scheduler.mu.Lock()
+	scheduler.status.LastRun = time.Now().Unix()
+	scheduler.status.LastJobID = job.ID()
+	scheduler.status.NextRun = 0
+	scheduler.mu.Unlock()
+
+	var changed bool
+	job.Run(func(job *m3u.Job) (*m3u.JobSummary, error) {
+		summary, updated, err := revalidateCatalog(core.NewContext(), job)
+		changed = updated
+		return summary, err
+	})
+
+	status := job.Status()
+	scheduler.mu.Lock()
+	scheduler.status.Changed = changed
+	scheduler.status.Error = status.Error
+	scheduler.mu.Unlock()
+	if changed {
+		log.Printf("后台验证结束: %s，播放列表已更新", status.State)
+	} else {
+		log.Printf("后台验证结束: %s，播放列表没有变化", status.State)
+	}
+}
+
+// revalidateCatalog 按优先级验证数据库中的播放地址并保存探测结果，
+// 再结合以往的验证统计对整个目录重新选出可用的条目，与正在提供的播放列表不同时才重新生成
+// 自动归档的地址每隔一段时间重新验证一次，验证通过时恢复
+// 返回的 bool 表示是否更新了播放列表
+func revalidateCatalog(ctx *core.Context, job *m3u.Job) (*m3u.JobSummary, bool, error) {
+	cfg := core.GetConfig().Scheduler
+	db := model.GetDB()
+
+	streams, err := db.M3U().GetList(ctx, &types.QueryFilter{})
+	if err != nil {
+		return nil, false, fmt.Errorf("获取频道记录失败: %w", err)
+	}
+
+	var catalog, rechecks []m3u.Entry
+	probes := make(map[string]*types.ProbeResult)
+	stats := make(map[string]*types.ProbeStats)
+	now, interval := time.Now(), recheckInterval()
+	for _, stream := range streams {
+		for _, url := range stream.ArchivedUrl {
+			if m3u.DueForRecheck(stream.UrlInfo[url], now, interval) {
+				rechecks = append(rechecks, m3u.EntryFromStream(stream, url))
+			}
+		}
+		for _, url := range stream.StreamUrl {
+			catalog = append(catalog, m3u.EntryFromStream(stream, url))
+			if info := stream.UrlInfo[url]; info != nil {
+				if info.Probe != nil {
+					probes[url] = info.Probe
+				}
+				if info.Stats != nil {
+					stats[url] = info.Stats
+				}
+			}
+		}
+	}
+
+	// 同一地址可能属于多个频道，目录中保留每一条，验证队列中只探测一次
+	seen := make(map[string]bool)
+	queue := uniqueURLs(m3u.PrioritizeEntries(catalog, favoriteURLs(), probes, now, recentFailureWindow), seen)
+	if cfg.BatchSize > 0 && len(queue) > cfg.BatchSize {
+		queue = queue[:cfg.BatchSize]
+	}
+	queue = append(queue, uniqueURLs(rechecks, seen)...)
+
+	latency := time.Duration(cfg.MaxLatencyMs) * time.Millisecond
+	if latency <= 0 {
+		latency = defaultScheduleLatency
+	}
+	result, err := m3u.ValidateAndUnique(job.Context(), job, queue, validateOptions(latency, ValidateLimits{}))
+	if result == nil {
+		return nil, false, fmt.Errorf("验证失败: %w", err)
+	}
+
+	recorded := result.Recorded()
+	updated, saveErr := db.M3U().SaveProbeResults(ctx, recorded)
+	if saveErr != nil {
+		fmt.Printf("保存探测结果失败: %v\n", saveErr)
+	}
+	restored, archived := applyArchivePolicy(ctx, recorded, updated)
+	summary := &m3u.JobSummary{Total: len(queue), Hosts: result.Hosts, Archived: len(archived), Restored: len(restored)}
+	if err != nil {
+		// 被取消时只保存已完成的探测结果，正在提供的播放列表保持不变
+		return summary, false, err
+	}
+
+	// 本次未验证或因主机不可用跳过的地址沿用以往的探测结果和统计
+	for _, probe := range recorded {
+		probes[probe.URL] = probe
+	}
+	for url, s := range updated {
+		stats[url] = s
+	}
+	// 恢复的地址重新加入目录
+	for _, entry := range rechecks {
+		if restored[entry.URL] {
+			catalog = append(catalog, entry)
+		}
+	}
+	selection := &m3u.ValidateResult{Entries: make([]m3u.Entry, 0, len(catalog))}
+	for _, entry := range catalog {
+		if m3u.ProbeSupported(entry.URL) {
+			entry.Probe = probes[entry.URL]
+		} else {
+			entry.Unverified = true
+		}
+		selection.Entries = append(selection.Entries, entry)
+	}
+	selection.Select(stats, healthPolicy())
+	selection.Exclude(archived)
+
+	summary.Unique = len(selection.Valid)
+	summary.Valid = len(selection.Unique)
+	summary.Unverified = countUnverified(selection.Unique)
+
+	changed, err := playlistChanged(selection.Unique)
+	if err != nil {
+		return summary, false, err
+	}
+	if changed {
+		if err := SaveValidatedEntries(selection.Unique); err != nil {
+			return summary, false, err
+		}
+	}
+	return summary, changed, nil
+}
+
+// uniqueURLs 返回 entries 中地址不在 seen 里的条目，同一地址只保留第一条，并将保留的地址加入 seen
+func uniqueURLs(entries []m3u.Entry, seen map[string]bool) []m3u.Entry {
+	unique := make([]m3u.Entry, 0, len(entries))
+	for _, entry := range entries {
+		if seen[entry.URL] {
+			continue
+		}
+		seen[entry.URL] = true
+		unique = append(unique, entry)
+	}
+	return unique
+}
+
+// favoriteURLs 返回所有收藏的播放地址，查询失败时返回空集合，只影响验证顺序
+func favoriteURLs() map[string]bool {
+	urls := make(map[string]bool)
+	favorites, err := model.GetDB().Favorite().GetAllFavorites()
+	if err != nil {
+		fmt.Printf("获取收藏失败: %v\n", err)
+		return urls
+	}
+	for _, favorite := range favorites {
+		urls[favorite.StreamUrl] = true
+	}
+	return urls
+}
+
+// playlistChanged 判断 entries 生成的播放列表是否与正在提供的不同
+// 没有可用条目时不会覆盖原有的播放列表，视为没有变化
+func playlistChanged(entries []m3u.Entry) (bool, error) {
+	if len(entries) == 0 {
+		return false, nil
+	}
+	var buf bytes.Buffer
+	if err := m3u.Write(&buf, entries); err != nil {
+		return false, fmt.Errorf("生成播放列表失败: %w", err)
+	}
+	current, err := os.ReadFile(cache.CacheFile)
+	if err != nil {
+		return true, nil
+	}
+	return !bytes.Equal(buf.Bytes(), current), nil
+}
+
+// HandleSchedulerStatus 返回后台验证的状态
+func HandleSchedulerStatus(c *core.Context) {
+	scheduler.mu.Lock()
+	status := scheduler.status
+	status.Quiet = scheduler.quiet.Contains(time.Now())
+	scheduler.mu.Unlock()
+	c.WebResponse(msg.CodeOK, status, nil)
+}
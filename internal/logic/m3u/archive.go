@@ -0,0 +1,66 @@
+package m3u
+
+import (
+	"time"
+	"tv-server/internal/model/types"
+)
+
+// ArchivePolicy 自动归档失效地址的策略，满足任意一个条件即归档
+type ArchivePolicy struct {
+	MaxConsecutiveFailures int           // 连续失败达到该次数时归档，0 不按次数归档
+	MaxDeadTime            time.Duration // 超过该时间没有验证通过时归档，从未通过时从第一次验证算起，0 不按时间归档
+}
+
+// Reason 返回地址应当归档的原因，不需要归档时返回空字符串
+func (p ArchivePolicy) Reason(stats *types.ProbeStats, now time.Time) string {
+	if stats == nil {
+		return ""
+	}
+	if p.MaxConsecutiveFailures > 0 && stats.ConsecutiveFailures >= p.MaxConsecutiveFailures {
+		return types.ArchiveReasonFailures
+	}
+	if p.MaxDeadTime > 0 && stats.ConsecutiveFailures > 0 {
+		since := stats.LastSuccessAt
+		if since == 0 {
+			since = stats.FirstCheckedAt
+		}
+		if since > 0 && now.Sub(time.Unix(since, 0)) >= p.MaxDeadTime {
+			return types.ArchiveReasonDead
+		}
+	}
+	return ""
+}
+
+// ArchivePlan 根据一次验证的结果需要归档和恢复的地址
+type ArchivePlan struct {
+	Archive map[string][]string // 按原因分组的需要归档的地址
+	Restore []string            // 验证通过、如已归档需要恢复的地址
+}
+
+// Plan 根据探测结果和更新后的统计决定需要归档和恢复的地址，stats 的 key 为播放地址
+// 只有本次验证失败的地址才会归档，验证通过的地址都应尝试恢复
+func (p ArchivePolicy) Plan(probes []*types.ProbeResult, stats map[string]*types.ProbeStats, now time.Time) *ArchivePlan {
+	plan := &ArchivePlan{Archive: make(map[string][]string)}
+	for _, probe := range probes {
+		if probe.Valid {
+			plan.Restore = append(plan.Restore, probe.URL)
+			continue
+		}
+		if reason := p.Reason(stats[probe.URL], now); reason != "" {
+			plan.Archive[reason] = append(plan.Archive[reason], probe.URL)
+		}
+	}
+	return plan
+}
+
+// DueForRecheck 判断已归档的地址是否需要重新验证，手动归档的地址不会自动重新验证
+func DueForRecheck(info *types.StreamUrlInfo, now time.Time, interval time.Duration) bool {
+	if info == nil || info.Archive == nil || info.Archive.Reason == types.ArchiveReasonManual {
+		return false
+	}
+	last := info.Archive.ArchivedAt
+	if info.Probe != nil && info.Probe.ProbedAt > last {
+		last = info.Probe.ProbedAt
+	}
+	return now.Sub(time.Unix(last, 0)) >= interval
+}
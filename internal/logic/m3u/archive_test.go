@@ -0,0 +1,84 @@
+package m3u
+
+import (
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+func TestArchivePolicy_Plan(t *testing.T) {
+	now := time.Now()
+	day := int64(24 * 60 * 60)
+	policy := ArchivePolicy{MaxConsecutiveFailures: 10, MaxDeadTime: 14 * 24 * time.Hour}
+
+	probes := []*types.ProbeResult{
+		{URL: "http://a/back", Valid: true},
+		{URL: "http://a/flapping", Valid: false},
+		{URL: "http://a/failing", Valid: false},
+		{URL: "http://a/dead", Valid: false},
+		{URL: "http://a/never", Valid: false},
+		{URL: "http://a/new", Valid: false},
+	}
+	stats := map[string]*types.ProbeStats{
+		"http://a/back":     {Checks: 30, ConsecutiveFailures: 0},
+		"http://a/flapping": {Checks: 30, ConsecutiveFailures: 2, LastSuccessAt: now.Unix() - day},
+		"http://a/failing":  {Checks: 30, ConsecutiveFailures: 10, LastSuccessAt: now.Unix() - day},
+		"http://a/dead":     {Checks: 5, ConsecutiveFailures: 5, LastSuccessAt: now.Unix() - 15*day},
+		"http://a/never":    {Checks: 3, ConsecutiveFailures: 3, FirstCheckedAt: now.Unix() - 20*day},
+	}
+
+	plan := policy.Plan(probes, stats, now)
+	if len(plan.Restore) != 1 || plan.Restore[0] != "http://a/back" {
+		t.Errorf("验证通过的地址应尝试恢复: %v", plan.Restore)
+	}
+	if got := plan.Archive[types.ArchiveReasonFailures]; len(got) != 1 || got[0] != "http://a/failing" {
+		t.Errorf("连续失败的地址不符合预期: %v", got)
+	}
+	if got := plan.Archive[types.ArchiveReasonDead]; len(got) != 2 || got[0] != "http://a/dead" || got[1] != "http://a/never" {
+		t.Errorf("长期失效的地址不符合预期: %v", got)
+	}
+
+	if plan := (ArchivePolicy{}).Plan(probes, stats, now); len(plan.Archive) != 0 {
+		t.Errorf("未配置策略时不应归档: %v", plan.Archive)
+	}
+}
+
+func TestDueForRecheck(t *testing.T) {
+	now := time.Now()
+	week := 7 * 24 * time.Hour
+	archived := func(reason string, archivedAt, probedAt time.Time) *types.StreamUrlInfo {
+		return &types.StreamUrlInfo{
+			Archive: &types.UrlArchive{ArchivedAt: archivedAt.Unix(), Reason: reason},
+			Probe:   &types.ProbeResult{ProbedAt: probedAt.Unix()},
+		}
+	}
+
+	if !DueForRecheck(archived(types.ArchiveReasonDead, now.Add(-30*24*time.Hour), now.Add(-8*24*time.Hour)), now, week) {
+		t.Error("上次验证超过间隔时应重新验证")
+	}
+	if DueForRecheck(archived(types.ArchiveReasonDead, now.Add(-30*24*time.Hour), now.Add(-time.Hour)), now, week) {
+		t.Error("最近验证过时不应重新验证")
+	}
+	if DueForRecheck(archived(types.ArchiveReasonFailures, now.Add(-time.Hour), now.Add(-30*24*time.Hour)), now, week) {
+		t.Error("刚归档时不应重新验证")
+	}
+	if DueForRecheck(archived(types.ArchiveReasonManual, now.Add(-30*24*time.Hour), now.Add(-30*24*time.Hour)), now, week) {
+		t.Error("手动归档的地址不应自动重新验证")
+	}
+	if DueForRecheck(&types.StreamUrlInfo{}, now, week) || DueForRecheck(nil, now, week) {
+		t.Error("未归档的地址不应重新验证")
+	}
+}
+
+func TestValidateResult_Exclude(t *testing.T) {
+	result := &ValidateResult{Entries: []Entry{
+		{URL: "http://a/1", Unverified: true},
+		{URL: "http://a/2", Unverified: true},
+		{URL: "http://a/1", Unverified: true},
+	}}
+	result.filter(func(Entry) bool { return true })
+	result.Exclude(map[string]bool{"http://a/1": true})
+	if len(result.Valid) != 1 || len(result.Unique) != 1 || result.Unique[0].URL != "http://a/2" {
+		t.Errorf("排除后的结果不符合预期: %+v", result.Unique)
+	}
+}
@@ -0,0 +1,224 @@
+package m3u
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// charsetSniffSize 用于字符集识别的内容长度
+const charsetSniffSize = 8192
+
+// 字符集名称
+const (
+	CharsetUTF8    = "utf-8"
+	CharsetUTF16LE = "utf-16le"
+	CharsetUTF16BE = "utf-16be"
+	CharsetGB18030 = "gb18030"
+)
+
+// NewUTF8Reader 识别 r 的字符集并返回转换为 UTF-8 的 Reader，同时去掉 BOM
+// 识别顺序: BOM、contentType 中声明的 charset、内容特征
+// contentType 为 HTTP 响应的 Content-Type，可以为空
+func NewUTF8Reader(r io.Reader, contentType string) (io.Reader, string, error) {
+	br := bufio.NewReaderSize(r, charsetSniffSize)
+	head, err := br.Peek(charsetSniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+	complete := err == io.EOF
+
+	// 1. BOM
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		br.Discard(3)
+		return br, CharsetUTF8, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return decodeWith(br, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)), CharsetUTF16LE, nil
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return decodeWith(br, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)), CharsetUTF16BE, nil
+	}
+
+	// 2. Content-Type 中声明的非 UTF-8 字符集
+	// 很多服务器对任意内容都声明 utf-8，因此 utf-8 仍需经过内容检查
+	if name := declaredCharset(contentType); name != "" && name != CharsetUTF8 {
+		if enc, err := htmlindex.Get(name); err == nil {
+			return decodeWith(br, enc), name, nil
+		}
+	}
+
+	// 3. 内容特征
+	// 开头都是 ASCII 时还无法判断，遇到第一个非 ASCII 字符时再识别
+	if !complete && isASCII(head) {
+		return newLateSniffReader(br), CharsetUTF8, nil
+	}
+	switch charset := sniffCharset(head, complete); charset {
+	case CharsetUTF16LE:
+		return decodeWith(br, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)), charset, nil
+	case CharsetUTF16BE:
+		return decodeWith(br, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)), charset, nil
+	case CharsetGB18030:
+		return decodeWith(br, simplifiedchinese.GB18030), charset, nil
+	default:
+		return br, CharsetUTF8, nil
+	}
+}
+
+// declaredCharset 从 Content-Type 中取出 charset 参数，统一为小写
+func declaredCharset(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	name := strings.ToLower(strings.TrimSpace(params["charset"]))
+	if name == "utf8" {
+		name = CharsetUTF8
+	}
+	return name
+}
+
+// sniffCharset 根据内容特征判断字符集
+// complete 表示 head 已包含全部内容，否则末尾可能是被截断的多字节字符
+func sniffCharset(head []byte, complete bool) string {
+	if len(head) == 0 {
+		return CharsetUTF8
+	}
+
+	// 播放列表以 ASCII 为主，UTF-16 编码时大量字节为 0
+	var evenZeros, oddZeros int
+	for i, b := range head {
+		if b != 0 {
+			continue
+		}
+		if i%2 == 0 {
+			evenZeros++
+		} else {
+			oddZeros++
+		}
+	}
+	half := len(head) / 2
+	if half > 0 {
+		if oddZeros*10 > half*3 && evenZeros*10 < half {
+			return CharsetUTF16LE
+		}
+		if evenZeros*10 > half*3 && oddZeros*10 < half {
+			return CharsetUTF16BE
+		}
+	}
+
+	if !complete {
+		head = trimPartialRune(head)
+	}
+	if utf8.Valid(head) {
+		return CharsetUTF8
+	}
+
+	// 国内播放列表中非 UTF-8 的内容基本都是 GBK，GB18030 兼容 GBK
+	return CharsetGB18030
+}
+
+// trimPartialRune 去掉末尾被截断的 UTF-8 字符
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// isASCII 判断 b 是否只包含 ASCII 字符
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// lateSniffMinSize 延迟识别时至少使用的内容长度，避免只凭一两个字节判断
+const lateSniffMinSize = 256
+
+// lateSniffReader 用于开头的 charsetSniffSize 字节都是 ASCII 的内容
+// 原样输出 ASCII 部分，从第一个非 ASCII 字符开始识别字符集，之后按识别结果转换
+type lateSniffReader struct {
+	*transform.Reader
+	sniffer *lateSniffer
+}
+
+func newLateSniffReader(r io.Reader) *lateSniffReader {
+	sniffer := &lateSniffer{charset: CharsetUTF8}
+	return &lateSniffReader{Reader: transform.NewReader(r, sniffer), sniffer: sniffer}
+}
+
+// Charset 返回识别出的字符集，读取完成后才是最终结果
+func (r *lateSniffReader) Charset() string {
+	return r.sniffer.charset
+}
+
+// lateSniffer 实现 transform.Transformer，识别前原样输出，识别后交给 decoder
+type lateSniffer struct {
+	charset string
+	decoder transform.Transformer
+}
+
+func (t *lateSniffer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	if t.decoder != nil {
+		return t.decoder.Transform(dst, src, atEOF)
+	}
+
+	i := 0
+	for i < len(src) && src[i] < utf8.RuneSelf {
+		i++
+	}
+	if i == len(src) {
+		n := copy(dst, src)
+		if n < len(src) {
+			return n, n, transform.ErrShortDst
+		}
+		return n, n, nil
+	}
+
+	// 先输出 ASCII 部分，内容不够时等待更多输入，让识别从非 ASCII 字符开始
+	n := copy(dst, src[:i])
+	if n < i {
+		return n, n, transform.ErrShortDst
+	}
+	if !atEOF && len(src)-i < lateSniffMinSize {
+		return n, n, transform.ErrShortSrc
+	}
+
+	t.charset = sniffCharset(src[i:], atEOF)
+	if t.charset == CharsetGB18030 {
+		t.decoder = simplifiedchinese.GB18030.NewDecoder()
+	} else {
+		t.decoder = transform.Nop
+	}
+	nDst, nSrc, err = t.decoder.Transform(dst[i:], src[i:], atEOF)
+	return nDst + i, nSrc + i, err
+}
+
+func (t *lateSniffer) Reset() {
+	t.charset = CharsetUTF8
+	t.decoder = nil
+}
+
+func decodeWith(r io.Reader, enc encoding.Encoding) io.Reader {
+	return transform.NewReader(r, enc.NewDecoder())
+}
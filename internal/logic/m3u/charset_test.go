@@ -0,0 +1,120 @@
+package m3u
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const charsetSample = `#EXTM3U
+#EXTINF:-1 group-title="卫视频道",湖南卫视
+http://example.com/hunan.m3u8
+`
+
+func TestParseReader_Charsets(t *testing.T) {
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(charsetSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16le, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String(charsetSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16be, err := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().String(charsetSample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		content     string
+		contentType string
+		charset     string
+	}{
+		{"UTF-8", charsetSample, "", CharsetUTF8},
+		{"UTF-8 BOM", "\xef\xbb\xbf" + charsetSample, "", CharsetUTF8},
+		{"GBK 特征识别", gbk, "", CharsetGB18030},
+		{"GBK Content-Type", gbk, "audio/x-mpegurl; charset=GBK", "gbk"},
+		{"GBK 声明为 UTF-8", gbk, "text/plain; charset=utf-8", CharsetGB18030},
+		{"UTF-16LE BOM", utf16le, "", CharsetUTF16LE},
+		{"UTF-16BE 无 BOM", utf16be, "", CharsetUTF16BE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist, err := parseReader(strings.NewReader(tt.content), "", tt.contentType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if playlist.Charset != tt.charset {
+				t.Errorf("字符集应为 %s，实际为 %s", tt.charset, playlist.Charset)
+			}
+			if playlist.Format != FormatM3U {
+				t.Errorf("格式应为 m3u，实际为 %s", playlist.Format)
+			}
+			parsed := ParseEntry(playlist.Entries)
+			if len(parsed) != 1 || parsed[0].Channel != "卫视频道" || parsed[0].Title != "湖南卫视" {
+				t.Errorf("解析结果不符合预期: %+v", parsed)
+			}
+			if playlist.WarningCount != 0 {
+				t.Errorf("不应产生警告: %v", playlist.Warnings)
+			}
+		})
+	}
+}
+
+func TestSniffCharset_TruncatedRune(t *testing.T) {
+	head := []byte(strings.Repeat("频道", 10))
+	// 截断最后一个字符的中间字节
+	head = head[:len(head)-1]
+	if got := sniffCharset(head, false); got != CharsetUTF8 {
+		t.Errorf("截断的 UTF-8 内容应识别为 utf-8，实际为 %s", got)
+	}
+	if got := sniffCharset(bytes.Clone(head), true); got != CharsetGB18030 {
+		t.Errorf("完整内容末尾不合法时应识别为 gb18030，实际为 %s", got)
+	}
+}
+
+func TestParseReader_LateNonASCII(t *testing.T) {
+	// 开头超过 charsetSniffSize 的内容都是 ASCII，中文出现在后面
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for b.Len() <= charsetSniffSize*2 {
+		b.WriteString("#EXTINF:-1 group-title=\"News\",CCTV\nhttp://example.com/cctv.m3u8\n")
+	}
+	tail := `#EXTINF:-1 group-title="卫视频道",湖南卫视
+http://example.com/hunan.m3u8
+`
+	gbk, err := simplifiedchinese.GBK.NewEncoder().String(b.String() + tail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		charset string
+	}{
+		{"UTF-8", b.String() + tail, CharsetUTF8},
+		{"GBK", gbk, CharsetGB18030},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist, err := parseReader(iotest.OneByteReader(strings.NewReader(tt.content)), "", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if playlist.Charset != tt.charset {
+				t.Errorf("字符集应为 %s，实际为 %s", tt.charset, playlist.Charset)
+			}
+			parsed := ParseEntry(playlist.Entries)
+			last := parsed[len(parsed)-1]
+			if last.Channel != "卫视频道" || last.Title != "湖南卫视" {
+				t.Errorf("后面的中文内容解析错误: %+v", last)
+			}
+		})
+	}
+}
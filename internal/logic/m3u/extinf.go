@@ -0,0 +1,181 @@
+package m3u
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 常用的 EXTINF 属性名
+const (
+	AttrTvgID         = "tvg-id"
+	AttrTvgName       = "tvg-name"
+	AttrTvgChno       = "tvg-chno"
+	AttrTvgLogo       = "tvg-logo"
+	AttrTvgLanguage   = "tvg-language"
+	AttrTvgCountry    = "tvg-country"
+	AttrGroupTitle    = "group-title"
+	AttrRadio         = "radio"
+	AttrCatchup       = "catchup"
+	AttrCatchupSource = "catchup-source"
+	AttrCatchupDays   = "catchup-days"
+)
+
+// DefaultGroup 没有 group-title 时使用的分组名称
+const DefaultGroup = "未分类"
+
+// ExtInf 定义 #EXTINF 行的结构化信息
+type ExtInf struct {
+	Duration float64           // 时长，直播源一般为 -1
+	Attrs    map[string]string // key="value" 形式的属性，key 统一为小写
+	Title    string            // 逗号后的标题
+}
+
+// ParseExtInf 解析 #EXTINF 行
+// 属性格式不规范时仍会返回已解析出的部分，同时返回错误说明
+func ParseExtInf(line string) (*ExtInf, error) {
+	rest, ok := cutPrefixFold(strings.TrimSpace(line), "#EXTINF:")
+	if !ok {
+		return nil, fmt.Errorf("不是 #EXTINF 行")
+	}
+
+	info := &ExtInf{Duration: -1}
+
+	// 时长位于冒号之后、第一个空白或逗号之前
+	end := strings.IndexAny(rest, " \t,")
+	if end < 0 {
+		end = len(rest)
+	}
+	if d := strings.TrimSpace(rest[:end]); d != "" {
+		if v, err := strconv.ParseFloat(d, 64); err == nil {
+			info.Duration = v
+		}
+	}
+	rest = rest[end:]
+
+	// 标题位于引号之外的第一个逗号之后
+	comma := indexUnquoted(rest, ',')
+	attrPart := rest
+	if comma >= 0 {
+		attrPart = rest[:comma]
+		info.Title = strings.TrimSpace(rest[comma+1:])
+	}
+
+	attrs, err := ParseAttributes(attrPart)
+	info.Attrs = attrs
+	return info, err
+}
+
+// ParseAttributes 解析 key="value" 形式的属性列表，返回的 key 统一为小写
+// 同时兼容单引号和不带引号的写法
+func ParseAttributes(s string) (map[string]string, error) {
+	attrs := make(map[string]string)
+	var errs []string
+
+	i, n := 0, len(s)
+	for i < n {
+		// 跳过空白
+		for i < n && isSpace(s[i]) {
+			i++
+		}
+		if i >= n {
+			break
+		}
+
+		// 读取 key
+		start := i
+		for i < n && s[i] != '=' && !isSpace(s[i]) {
+			i++
+		}
+		key := strings.ToLower(s[start:i])
+		if i >= n || s[i] != '=' {
+			errs = append(errs, fmt.Sprintf("属性 %q 缺少值", key))
+			continue
+		}
+		i++ // 跳过 '='
+
+		// 读取 value
+		var value string
+		if i < n && (s[i] == '"' || s[i] == '\'') {
+			quote := s[i]
+			i++
+			var b strings.Builder
+			closed := false
+			for i < n {
+				if s[i] == '\\' && i+1 < n && s[i+1] == quote {
+					b.WriteByte(quote)
+					i += 2
+					continue
+				}
+				if s[i] == quote {
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(s[i])
+				i++
+			}
+			value = b.String()
+			if !closed {
+				errs = append(errs, fmt.Sprintf("属性 %q 的引号未闭合", key))
+			}
+		} else {
+			start = i
+			for i < n && !isSpace(s[i]) {
+				i++
+			}
+			value = s[start:i]
+		}
+
+		if key == "" {
+			errs = append(errs, "存在缺少名称的属性")
+			continue
+		}
+		attrs[key] = value
+	}
+
+	if len(errs) > 0 {
+		return attrs, fmt.Errorf("属性格式错误: %s", strings.Join(errs, "; "))
+	}
+	return attrs, nil
+}
+
+// indexUnquoted 返回引号之外第一次出现 c 的位置
+func indexUnquoted(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == '\\' && i+1 < len(s) && s[i+1] == quote {
+				i++
+			} else if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			// 只有紧跟在 '=' 之后的引号才算属性值的开始
+			if i > 0 && s[i-1] == '=' {
+				quote = s[i]
+			}
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// hasPrefixFold 判断 s 是否以 prefix 开头，忽略大小写
+func hasPrefixFold(s, prefix string) bool {
+	_, ok := cutPrefixFold(s, prefix)
+	return ok
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
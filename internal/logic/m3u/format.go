@@ -0,0 +1,122 @@
+package m3u
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"regexp"
+)
+
+// Format 播放列表格式
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatTXT  Format = "txt"  // DIYP/TXT 格式: "分组,#genre#" 与 "名称,地址"
+	FormatXSPF Format = "xspf" // VLC 等播放器使用的 XML 播放列表
+	FormatPLS  Format = "pls"  // 网络电台常用的 INI 风格播放列表
+	FormatJSON Format = "json" // [{"name", "group", "logo", "url"}] 形式的 JSON 数组
+)
+
+// sniffSize 用于格式识别的内容长度
+const sniffSize = 4096
+
+// txtLineRe 匹配 TXT 格式中的 "名称,地址" 行
+var txtLineRe = regexp.MustCompile(`^[^,#][^,]*,\s*[A-Za-z][A-Za-z0-9+.\-]*://`)
+
+// DetectFormat 根据内容开头判断播放列表格式，无法识别时按 M3U 处理
+func DetectFormat(head []byte) Format {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	trimmed := bytes.TrimSpace(head)
+	if bytes.HasPrefix(trimmed, []byte("#EXTM3U")) || bytes.HasPrefix(trimmed, []byte("#EXTINF")) {
+		return FormatM3U
+	}
+	if bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(bytes.ToLower(trimmed), []byte("<playlist")) {
+		return FormatXSPF
+	}
+	if len(trimmed) >= len("[playlist]") && bytes.EqualFold(trimmed[:len("[playlist]")], []byte("[playlist]")) {
+		return FormatPLS
+	}
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		return FormatJSON
+	}
+
+	for _, line := range bytes.Split(trimmed, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if bytes.Contains(line, []byte(",#genre#")) || txtLineRe.Match(line) {
+			return FormatTXT
+		}
+		if bytes.HasPrefix(line, []byte("#EXTINF")) {
+			return FormatM3U
+		}
+	}
+	return FormatM3U
+}
+
+// DetectFileFormat 读取文件开头判断播放列表格式，非 UTF-8 内容先转换后再判断
+func DetectFileFormat(filename string) (Format, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	r, _, err := NewUTF8Reader(file, "")
+	if err != nil {
+		return "", err
+	}
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return DetectFormat(head[:n]), nil
+}
+
+// entryScanner 各格式解析器的公共接口
+type entryScanner interface {
+	Scan() bool
+	Entry() Entry
+	Header() *Header
+	Warnings() []Warning
+	WarningCount() int
+	Err() error
+}
+
+// newFormatScanner 识别 r 的格式并返回对应的解析器
+func newFormatScanner(r io.Reader, baseURL string) (entryScanner, Format, error) {
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	format := DetectFormat(head)
+	switch format {
+	case FormatXSPF:
+		scanner, err := newListScanner(br, baseURL, parseXSPF)
+		return scanner, format, err
+	case FormatPLS:
+		scanner, err := newListScanner(br, baseURL, parsePLS)
+		return scanner, format, err
+	case FormatJSON:
+		scanner, err := newListScanner(br, baseURL, parseJSON)
+		return scanner, format, err
+	case FormatTXT:
+		scanner := NewTXTScanner(br)
+		if err := scanner.SetBaseURL(baseURL); err != nil {
+			return nil, format, err
+		}
+		return scanner, format, nil
+	default:
+		scanner := NewScanner(br)
+		if err := scanner.SetBaseURL(baseURL); err != nil {
+			return nil, format, err
+		}
+		return scanner, format, nil
+	}
+}
@@ -0,0 +1,86 @@
+package m3u
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 头部属性名
+const (
+	AttrXTvgURL  = "x-tvg-url"
+	AttrURLTvg   = "url-tvg"
+	AttrTvgShift = "tvg-shift"
+)
+
+// headerDefaults 头部中可作为条目默认值的属性
+var headerDefaults = []string{AttrTvgShift, AttrCatchup, AttrCatchupDays, AttrCatchupSource}
+
+// Header 定义 #EXTM3U 头信息
+type Header struct {
+	Attrs   map[string]string `json:"attrs,omitempty"`
+	EPGURLs []string          `json:"epgUrls,omitempty"` // x-tvg-url/url-tvg 中的节目单地址
+}
+
+// ParseHeader 解析 #EXTM3U 行
+func ParseHeader(line string) (*Header, error) {
+	rest, ok := cutPrefixFold(strings.TrimSpace(line), "#EXTM3U")
+	if !ok {
+		return nil, fmt.Errorf("不是 #EXTM3U 行")
+	}
+
+	attrs, err := ParseAttributes(rest)
+	header := &Header{Attrs: attrs}
+	header.EPGURLs = MergeEPGURLs(nil, attrs[AttrXTvgURL], attrs[AttrURLTvg])
+	return header, err
+}
+
+// apply 将头部中的默认属性应用到条目上，条目自身的属性优先
+func (h *Header) apply(entry *Entry) {
+	if h == nil {
+		return
+	}
+	entry.EPGURLs = h.EPGURLs
+
+	if entry.Info == nil {
+		return
+	}
+	changed := false
+	for _, key := range headerDefaults {
+		value, ok := h.Attrs[key]
+		if !ok {
+			continue
+		}
+		if _, exists := entry.Info.Attrs[key]; exists {
+			continue
+		}
+		if entry.Info.Attrs == nil {
+			entry.Info.Attrs = make(map[string]string)
+		}
+		entry.Info.Attrs[key] = value
+		changed = true
+	}
+
+	// 重新生成元数据，使输出的播放列表也带上默认属性
+	if changed {
+		entry.Metadata = formatExtInf(entry.Info)
+	}
+}
+
+// MergeEPGURLs 将逗号分隔的节目单地址合并到 urls 中并去重
+func MergeEPGURLs(urls []string, lists ...string) []string {
+	seen := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		seen[u] = true
+	}
+	for _, list := range lists {
+		for _, u := range strings.Split(list, ",") {
+			u = strings.TrimSpace(u)
+			if u == "" || seen[u] {
+				continue
+			}
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,175 @@
+package m3u
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// HLS 播放列表中用到的标签
+const (
+	tagStreamInf      = "#EXT-X-STREAM-INF:"
+	tagMediaSequence  = "#EXT-X-MEDIA-SEQUENCE:"
+	tagTargetDuration = "#EXT-X-TARGETDURATION:"
+	tagPlaylistType   = "#EXT-X-PLAYLIST-TYPE:"
+	tagEndList        = "#EXT-X-ENDLIST"
+	tagExtInf         = "#EXTINF:"
+)
+
+// HLSVariant 主播放列表中的一个码率
+type HLSVariant struct {
+	URI        string
+	Bandwidth  int64
+	Resolution string
+	Codecs     string
+}
+
+// HLSPlaylist 解析后的 HLS 播放列表，Variants 非空时为主播放列表，否则为媒体播放列表
+type HLSPlaylist struct {
+	Variants []HLSVariant
+
+	MediaSequence  int64
+	TargetDuration float64
+	PlaylistType   string // VOD、EVENT 或空
+	EndList        bool
+	Segments       []string // 分片的绝对地址
+}
+
+// IsMaster 是否为主播放列表
+func (p *HLSPlaylist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// IsLive 是否为直播，点播列表带有 #EXT-X-ENDLIST 或类型为 VOD
+func (p *HLSPlaylist) IsLive() bool {
+	return !p.EndList && !strings.EqualFold(p.PlaylistType, "VOD")
+}
+
+// advancedFrom 判断直播列表相比 prev 是否有更新
+// EVENT 类型的列表序号不变，只在末尾追加分片
+func (p *HLSPlaylist) advancedFrom(prev *HLSPlaylist) bool {
+	if p.MediaSequence != prev.MediaSequence || len(p.Segments) != len(prev.Segments) {
+		return true
+	}
+	return len(p.Segments) > 0 && p.Segments[len(p.Segments)-1] != prev.Segments[len(prev.Segments)-1]
+}
+
+// isHLSContent 判断内容是否为 HLS 播放列表
+func isHLSContent(head []byte) bool {
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	return bytes.HasPrefix(bytes.TrimSpace(head), []byte("#EXTM3U")) && !IsPlaylistContent(head)
+}
+
+// ParseHLS 解析 HLS 播放列表，其中的相对地址基于 base 解析
+func ParseHLS(data []byte, base *url.URL) (*HLSPlaylist, error) {
+	playlist := &HLSPlaylist{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	var (
+		variant   *HLSVariant // 等待地址的 #EXT-X-STREAM-INF
+		inSegment bool        // 等待地址的 #EXTINF
+		line      int
+	)
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+			if !strings.HasPrefix(text, "#EXTM3U") {
+				return nil, fmt.Errorf("不是 HLS 播放列表")
+			}
+			continue
+		}
+
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, tagStreamInf):
+			attrs := parseHLSAttrs(text[len(tagStreamInf):])
+			variant = &HLSVariant{
+				Resolution: attrs["RESOLUTION"],
+				Codecs:     attrs["CODECS"],
+			}
+			variant.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+		case strings.HasPrefix(text, tagMediaSequence):
+			playlist.MediaSequence, _ = strconv.ParseInt(strings.TrimSpace(text[len(tagMediaSequence):]), 10, 64)
+		case strings.HasPrefix(text, tagTargetDuration):
+			playlist.TargetDuration, _ = strconv.ParseFloat(strings.TrimSpace(text[len(tagTargetDuration):]), 64)
+		case strings.HasPrefix(text, tagPlaylistType):
+			playlist.PlaylistType = strings.TrimSpace(text[len(tagPlaylistType):])
+		case strings.HasPrefix(text, tagEndList):
+			playlist.EndList = true
+		case strings.HasPrefix(text, tagExtInf):
+			inSegment = true
+		case strings.HasPrefix(text, "#"):
+			// 其余标签与验证无关
+		default:
+			uri, err := resolveHLSURI(text, base)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行: %v", line, err)
+			}
+			switch {
+			case variant != nil:
+				variant.URI = uri
+				playlist.Variants = append(playlist.Variants, *variant)
+				variant = nil
+			case inSegment:
+				playlist.Segments = append(playlist.Segments, uri)
+				inSegment = false
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if line == 0 {
+		return nil, fmt.Errorf("播放列表为空")
+	}
+	return playlist, nil
+}
+
+// resolveHLSURI 将播放列表中的地址解析为绝对地址
+func resolveHLSURI(raw string, base *url.URL) (string, error) {
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("无效的地址: %w", err)
+	}
+	if base == nil {
+		if !ref.IsAbs() {
+			return "", errNoBase
+		}
+		return ref.String(), nil
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// parseHLSAttrs 解析 KEY=VALUE,KEY="VALUE" 形式的属性列表
+func parseHLSAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		key, rest, found := strings.Cut(s, "=")
+		if !found {
+			break
+		}
+		key = strings.ToUpper(strings.TrimSpace(key))
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+			_, rest, _ = strings.Cut(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[key] = strings.TrimSpace(value)
+		s = rest
+	}
+	return attrs
+}
@@ -0,0 +1,180 @@
+package m3u
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tv-server/internal/model/types"
+)
+
+func TestParseHLS_Master(t *testing.T) {
+	base, _ := url.Parse("http://example.com/live/index.m3u8")
+	playlist, err := ParseHLS([]byte(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2"
+hd/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360
+http://cdn.example.com/sd/index.m3u8
+`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !playlist.IsMaster() || len(playlist.Variants) != 2 {
+		t.Fatalf("应解析为主播放列表: %+v", playlist)
+	}
+	v := playlist.Variants[0]
+	if v.URI != "http://example.com/live/hd/index.m3u8" || v.Bandwidth != 2560000 ||
+		v.Resolution != "1920x1080" || v.Codecs != "avc1.640028,mp4a.40.2" {
+		t.Errorf("码率信息不符合预期: %+v", v)
+	}
+}
+
+func TestValidateURL_HLS(t *testing.T) {
+	var sequence int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/master.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000\nlive.m3u8\n")
+		case "/live.m3u8":
+			seq := atomic.AddInt64(&sequence, 1)
+			fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:%d\n#EXTINF:1,\nseg.ts\n", seq)
+		case "/stale.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:1,\nseg.ts\n")
+		case "/vod.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg.ts\n#EXT-X-ENDLIST\n")
+		case "/empty.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n")
+		case "/html-segment.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nerror.html\n#EXT-X-ENDLIST\n")
+		case "/seg.ts":
+			w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+		case "/error.html", "/page":
+			fmt.Fprint(w, "<!DOCTYPE html><html><body>404</body></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path  string
+		valid bool
+		class string
+	}{
+		{"/master.m3u8", true, ""},
+		{"/vod.m3u8", true, ""},
+		{"/stale.m3u8", false, types.ProbeErrorBadContent},
+		{"/empty.m3u8", false, types.ProbeErrorBadContent},
+		{"/html-segment.m3u8", false, types.ProbeErrorBadContent},
+		{"/page", false, types.ProbeErrorBadContent},
+		{"/missing.m3u8", false, types.ProbeErrorHTTP4xx},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		res := ValidateURL(context.Background(), server.URL+tt.path, nil, time.Second)
+		if res.Valid != tt.valid {
+			t.Errorf("%s 验证结果应为 %v，实际为 %v: %s", tt.path, tt.valid, res.Valid, res.Error)
+		}
+		if res.ErrorClass != tt.class {
+			t.Errorf("%s 失败分类应为 %q，实际为 %q", tt.path, tt.class, res.ErrorClass)
+		}
+		if tt.path == "/vod.m3u8" && time.Since(start) > 500*time.Millisecond {
+			t.Errorf("点播列表不应等待更新")
+		}
+		if !res.Valid && res.Error == "" {
+			t.Errorf("%s 验证失败时应返回原因", tt.path)
+		}
+		if tt.path == "/stale.m3u8" && (!res.Stale || !strings.Contains(res.Error, "未更新")) {
+			t.Errorf("应识别出未更新的直播列表: %+v", res)
+		}
+	}
+}
+
+func TestValidateURL_ProbeResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old.m3u8":
+			http.Redirect(w, r, "/master.m3u8", http.StatusFound)
+		case "/master.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=1280x720,CODECS=\"avc1.64001f,mp4a.40.2\"\nvod.m3u8\n")
+		case "/vod.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\nseg.ts\n#EXT-X-ENDLIST\n")
+		case "/seg.ts":
+			w.Write(make([]byte, 64*1024))
+		case "/error":
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	res := ValidateURL(context.Background(), server.URL+"/old.m3u8", nil, time.Second)
+	if !res.Valid {
+		t.Fatalf("应验证通过: %s", res.Error)
+	}
+	if res.StatusCode != http.StatusOK || res.FinalURL != server.URL+"/master.m3u8" ||
+		res.ContentType != "application/vnd.apple.mpegurl" {
+		t.Errorf("响应信息不符合预期: %+v", res)
+	}
+	if res.Bandwidth != 800000 || res.Resolution != "1280x720" || res.Codecs != "avc1.64001f,mp4a.40.2" {
+		t.Errorf("码率信息不符合预期: %+v", res)
+	}
+	if res.Live || res.Throughput <= 0 || res.Latency < res.TTFB {
+		t.Errorf("测量结果不符合预期: %+v", res)
+	}
+
+	if res := ValidateURL(context.Background(), server.URL+"/error", nil, time.Second); res.StatusCode != http.StatusBadGateway ||
+		res.ErrorClass != types.ProbeErrorHTTP5xx {
+		t.Errorf("应识别出 5xx 错误: %+v", res)
+	}
+
+	// 关闭后端口不再监听
+	server.Close()
+	if res := ValidateURL(context.Background(), server.URL+"/master.m3u8", nil, time.Second); res.ErrorClass != types.ProbeErrorRefused {
+		t.Errorf("应识别出连接被拒绝: %+v", res)
+	}
+}
+
+func TestValidateURL_StaleCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stale.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:1,\nseg.ts\n")
+		case "/slow.m3u8":
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:6,\nseg.ts\n")
+		case "/seg.ts":
+			w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+		}
+	}))
+	defer server.Close()
+
+	// 关闭检查时不等待列表更新，并在结果中注明
+	start := time.Now()
+	opts := ValidateOptions{MaxLatency: time.Second, SkipStaleCheck: true}
+	if res := validateURL(context.Background(), server.URL+"/stale.m3u8", nil, opts, nil, nil); !res.Valid || res.Stale || !res.StaleUnchecked {
+		t.Errorf("关闭检查时应验证通过: %+v", res)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("关闭检查时不应等待列表更新")
+	}
+
+	// 等待时间单独计算，获取列表和分片用掉的时间不影响检查
+	if res := ValidateURL(context.Background(), server.URL+"/stale.m3u8", nil, time.Second); res.Valid || !res.Stale || res.StaleUnchecked {
+		t.Errorf("应检查出未更新的直播列表: %+v", res)
+	}
+
+	// 分片时长超出可以等待的时间时不做检查，也不超时
+	start = time.Now()
+	if res := ValidateURL(context.Background(), server.URL+"/slow.m3u8", nil, time.Second); !res.Valid || res.Stale || !res.StaleUnchecked {
+		t.Errorf("无法等待一个分片时长时应跳过检查并注明: %+v", res)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("等待时间不应超出时间预算")
+	}
+}
@@ -0,0 +1,123 @@
+package m3u
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+// maxHostReports 任务结果中最多列出的主机数
+const maxHostReports = 50
+
+// HostReport 单个主机在一次验证中的结果，只列出有失败的主机
+type HostReport struct {
+	Host      string `json:"host"`      // 主机名和端口
+	Total     int    `json:"total"`     // 该主机的地址数，包括跳过的
+	Succeeded int    `json:"succeeded"` // 验证通过的地址数
+	Failed    int    `json:"failed"`    // 探测失败的地址数，不包括跳过的
+	Skipped   int    `json:"skipped"`   // 主机被判为不可用后未探测、直接判为失败的地址数
+	Down      bool   `json:"down"`      // 是否被判为不可用
+	Reason    string `json:"reason,omitempty"`
+}
+
+// hostHealth 记录一次验证中各主机的探测结果
+// 同一主机连续多次解析失败或拒绝连接时判为不可用，剩余的地址不再探测，避免逐个等待超时
+type hostHealth struct {
+	threshold int // 连续硬失败达到该次数时判为不可用，0 不判断
+
+	mu    sync.Mutex
+	hosts map[string]*hostRecord
+}
+
+type hostRecord struct {
+	HostReport
+	hardFailures int // 连续的硬失败次数，探测成功时清零
+}
+
+func newHostHealth(threshold int) *hostHealth {
+	return &hostHealth{threshold: threshold, hosts: make(map[string]*hostRecord)}
+}
+
+// record 返回主机的记录，不存在时创建，调用方需持有锁
+func (h *hostHealth) record(host string) *hostRecord {
+	r := h.hosts[host]
+	if r == nil {
+		r = &hostRecord{HostReport: HostReport{Host: host}}
+		h.hosts[host] = r
+	}
+	return r
+}
+
+// isHardFailure 判断失败是否说明主机本身不可用，而不只是某个地址失效
+func isHardFailure(class string) bool {
+	return class == types.ProbeErrorDNS || class == types.ProbeErrorRefused
+}
+
+// skip 主机已被判为不可用时返回直接判为失败的结果，否则返回 nil
+func (h *hostHealth) skip(host, url string) *types.ProbeResult {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.hosts[host]
+	if r == nil || !r.Down {
+		return nil
+	}
+	r.Total++
+	r.Skipped++
+	return &types.ProbeResult{
+		URL:        url,
+		ProbedAt:   time.Now().Unix(),
+		Error:      fmt.Sprintf("host down: %s", r.Reason),
+		ErrorClass: types.ProbeErrorHostDown,
+	}
+}
+
+// observe 记录一次探测的结果
+func (h *hostHealth) observe(host string, probe *types.ProbeResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	r := h.record(host)
+	r.Total++
+	if probe.Valid {
+		r.Succeeded++
+		r.hardFailures = 0
+		return
+	}
+	r.Failed++
+	if !isHardFailure(probe.ErrorClass) {
+		return
+	}
+	r.hardFailures++
+	if h.threshold > 0 && r.hardFailures >= h.threshold && !r.Down {
+		r.Down = true
+		r.Reason = probe.ErrorClass
+		fmt.Printf("主机 %s 连续 %d 次 %s，剩余地址不再探测\n", host, r.hardFailures, r.Reason)
+	}
+}
+
+// report 返回有失败的主机，不可用的在前，其余按失败数从多到少排列
+func (h *hostHealth) report() []HostReport {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var reports []HostReport
+	for _, r := range h.hosts {
+		if r.Failed+r.Skipped > 0 {
+			reports = append(reports, r.HostReport)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		a, b := reports[i], reports[j]
+		if a.Down != b.Down {
+			return a.Down
+		}
+		if fa, fb := a.Failed+a.Skipped, b.Failed+b.Skipped; fa != fb {
+			return fa > fb
+		}
+		return a.Host < b.Host
+	})
+	if len(reports) > maxHostReports {
+		reports = reports[:maxHostReports]
+	}
+	return reports
+}
@@ -0,0 +1,94 @@
+package m3u
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+func TestValidateAndUnique_HostDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+	}))
+	defer server.Close()
+
+	// 监听后立即关闭，得到一个拒绝连接的端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := ln.Addr().String()
+	ln.Close()
+
+	var entries []Entry
+	for i := 0; i < 20; i++ {
+		entries = append(entries, Entry{URL: fmt.Sprintf("http://%s/%d.ts", refused, i)})
+	}
+	entries = append(entries, Entry{URL: server.URL + "/ok.ts"})
+
+	// 每个主机同时只探测一个地址，连续 3 次拒绝连接后剩余地址直接判为失败
+	result, err := ValidateAndUnique(context.Background(), nil, entries, ValidateOptions{
+		MaxLatency:   time.Second,
+		PerHost:      1,
+		HostFailures: 3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unique) != 1 || result.Unique[0].URL != server.URL+"/ok.ts" {
+		t.Fatalf("只有正常主机的地址应验证通过: %+v", result.Unique)
+	}
+
+	classes := make(map[string]int)
+	for _, probe := range result.Probes {
+		if !probe.Valid {
+			classes[probe.ErrorClass]++
+		}
+	}
+	if classes[types.ProbeErrorRefused] != 3 || classes[types.ProbeErrorHostDown] != 17 {
+		t.Errorf("失败原因不符合预期: %v", classes)
+	}
+	// 跳过的地址不计入统计和归档判断
+	if recorded := result.Recorded(); len(recorded) != 4 {
+		t.Errorf("应只记录实际探测的 4 个地址，实际 %d 个", len(recorded))
+	}
+
+	if len(result.Hosts) != 1 {
+		t.Fatalf("应只列出失败的主机: %+v", result.Hosts)
+	}
+	host := result.Hosts[0]
+	if !host.Down || host.Reason != types.ProbeErrorRefused || host.Total != 20 || host.Failed != 3 || host.Skipped != 17 {
+		t.Errorf("主机结果不符合预期: %+v", host)
+	}
+}
+
+func TestHostHealth_SuccessResetsFailures(t *testing.T) {
+	h := newHostHealth(2)
+	refused := &types.ProbeResult{ErrorClass: types.ProbeErrorRefused}
+	h.observe("a", refused)
+	h.observe("a", &types.ProbeResult{Valid: true})
+	h.observe("a", refused)
+	if h.skip("a", "http://a/x") != nil {
+		t.Fatal("探测成功后应重新计算连续失败次数")
+	}
+	// 超时和 4xx 只说明单个地址有问题，不影响主机
+	h.observe("b", &types.ProbeResult{ErrorClass: types.ProbeErrorTimeout})
+	h.observe("b", &types.ProbeResult{ErrorClass: types.ProbeErrorHTTP4xx})
+	if h.skip("b", "http://b/x") != nil {
+		t.Fatal("非硬失败不应判为主机不可用")
+	}
+	h.observe("a", refused)
+	if probe := h.skip("a", "http://a/x"); probe == nil || probe.ErrorClass != types.ProbeErrorHostDown {
+		t.Fatalf("连续硬失败后应判为不可用: %+v", probe)
+	}
+
+	reports := h.report()
+	if len(reports) != 2 || reports[0].Host != "a" || !reports[0].Down || reports[0].Skipped != 1 {
+		t.Errorf("主机结果应将不可用的排在前面: %+v", reports)
+	}
+}
@@ -0,0 +1,393 @@
+package m3u
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"tv-server/internal/model/types"
+
+	"github.com/google/uuid"
+)
+
+// JobState 验证任务的状态
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+// 验证任务的类型
+const (
+	JobKindPlaylist  = "playlist"  // 验证上传或远程的播放列表
+	JobKindChannel   = "channel"   // 重新验证数据库中的频道
+	JobKindScheduled = "scheduled" // 后台定时重新验证整个目录
+)
+
+const (
+	// maxRunningJobs 同时运行的验证任务数，其余任务排队等待
+	maxRunningJobs = 2
+	// maxJobHistory 保留的最近任务数，更早的已结束任务会被移除
+	maxJobHistory = 50
+	// jobEventBuffer 每个订阅者缓存的事件数
+	jobEventBuffer = 256
+)
+
+// 推送给订阅者的事件类型
+const (
+	JobEventResult = "result" // 一个地址处理完成
+	JobEventStatus = "status" // 任务状态变化
+)
+
+// JobSummary 验证任务结束后的结果摘要
+type JobSummary struct {
+	Total      int    `json:"total"`      // 原始链接数
+	Unique     int    `json:"unique"`     // 验证通过的链接数
+	Valid      int    `json:"valid"`      // 去重后的有效链接数
+	Unverified int    `json:"unverified"` // 协议无法探测、未经验证的链接数
+	M3ULink    string `json:"m3uLink,omitempty"`
+	TxtLink    string `json:"txtLink,omitempty"`
+
+	Hosts []HostReport `json:"hosts,omitempty"` // 有失败的主机
+
+	Archived int `json:"archived,omitempty"` // 本次自动归档的地址数
+	Restored int `json:"restored,omitempty"` // 本次恢复的已归档地址数
+}
+
+// JobStatus 验证任务在某一时刻的状态
+type JobStatus struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	Owner      string      `json:"owner"`
+	State      JobState    `json:"state"`
+	Total      int         `json:"total"`      // 待验证的链接数
+	Processed  int         `json:"processed"`  // 已处理的链接数
+	Succeeded  int         `json:"succeeded"`  // 验证通过的链接数
+	Failed     int         `json:"failed"`     // 验证失败的链接数
+	Unverified int         `json:"unverified"` // 未经验证的链接数
+	Progress   float64     `json:"progress"`   // 百分比
+	Rate       float64     `json:"rate"`       // 实际每秒处理的链接数
+	ETA        int64       `json:"eta"`        // 预计剩余秒数，无法估计时为 -1
+	CreatedAt  int64       `json:"createdAt"`
+	StartedAt  int64       `json:"startedAt,omitempty"`
+	EndedAt    int64       `json:"endedAt,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Summary    *JobSummary `json:"summary,omitempty"`
+}
+
+// JobResult 单个地址的处理结果
+type JobResult struct {
+	URL        string             `json:"url"`
+	Title      string             `json:"title,omitempty"`
+	Unverified bool               `json:"unverified,omitempty"` // 协议无法探测，未经验证
+	Probe      *types.ProbeResult `json:"probe,omitempty"`
+}
+
+// JobEvent 推送给订阅者的任务事件，Status 为事件发生时的任务状态
+type JobEvent struct {
+	Type   string     `json:"type"`
+	Result *JobResult `json:"result,omitempty"`
+	Status JobStatus  `json:"status"`
+}
+
+// Job 一次验证任务，各任务的进度互相独立
+// 方法可以在 nil 上调用，此时不记录任何信息
+type Job struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.RWMutex
+	status      JobStatus
+	validating  time.Time // 开始验证的时间，用于根据实际速度估计剩余时间
+	ended       time.Time
+	subscribers map[chan JobEvent]struct{}
+}
+
+var jobs = struct {
+	sync.RWMutex
+	byID  map[string]*Job
+	order []*Job // 按创建时间排列
+}{
+	byID: make(map[string]*Job),
+}
+
+// jobSlots 限制同时运行的任务数
+var jobSlots = make(chan struct{}, maxRunningJobs)
+
+// NewJob 创建并登记一个排队中的任务，owner 为发起任务的用户
+func NewJob(kind, owner string) *Job {
+	job := &Job{status: JobStatus{
+		ID:        uuid.New().String(),
+		Kind:      kind,
+		Owner:     owner,
+		State:     JobQueued,
+		CreatedAt: time.Now().Unix(),
+	}}
+	job.ctx, job.cancel = context.WithCancel(context.Background())
+
+	jobs.Lock()
+	defer jobs.Unlock()
+	jobs.byID[job.status.ID] = job
+	jobs.order = append(jobs.order, job)
+	pruneJobs()
+	return job
+}
+
+// pruneJobs 移除超出保留数量的已结束任务，调用方需持有写锁
+func pruneJobs() {
+	excess := len(jobs.order) - maxJobHistory
+	if excess <= 0 {
+		return
+	}
+	kept := jobs.order[:0]
+	for _, job := range jobs.order {
+		if excess > 0 && job.Status().finished() {
+			delete(jobs.byID, job.ID())
+			excess--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	jobs.order = kept
+}
+
+// GetJob 根据 ID 查找任务，不存在时返回 nil
+func GetJob(id string) *Job {
+	jobs.RLock()
+	defer jobs.RUnlock()
+	return jobs.byID[id]
+}
+
+// ListJobs 返回最近的任务，新任务在前；owner 非空时只返回该用户的任务
+func ListJobs(owner string, limit int) []JobStatus {
+	jobs.RLock()
+	defer jobs.RUnlock()
+
+	list := make([]JobStatus, 0, len(jobs.order))
+	for i := len(jobs.order) - 1; i >= 0; i-- {
+		if limit > 0 && len(list) >= limit {
+			break
+		}
+		status := jobs.order[i].Status()
+		if owner != "" && status.Owner != owner {
+			continue
+		}
+		list = append(list, status)
+	}
+	return list
+}
+
+// ID 返回任务 ID
+func (j *Job) ID() string {
+	if j == nil {
+		return ""
+	}
+	return j.status.ID
+}
+
+// Context 返回任务的 ctx，任务被取消时 ctx 也会被取消
+func (j *Job) Context() context.Context {
+	if j == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// Cancel 取消排队中或运行中的任务，任务已结束时返回 false
+// 任务在 fn 返回后才会变为 cancelled 状态
+func (j *Job) Cancel() bool {
+	if j == nil {
+		return false
+	}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	if j.status.finished() {
+		return false
+	}
+	j.cancel()
+	return true
+}
+
+// Status 返回任务当前状态的副本
+func (j *Job) Status() JobStatus {
+	if j == nil {
+		return JobStatus{}
+	}
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.snapshot()
+}
+
+// snapshot 生成当前状态的副本并计算进度，调用方需持有锁
+func (j *Job) snapshot() JobStatus {
+	status := j.status
+	if status.Total > 0 {
+		status.Progress = float64(status.Processed) / float64(status.Total) * 100
+	} else if status.State == JobDone {
+		status.Progress = 100
+	}
+
+	status.ETA = -1
+	if status.finished() {
+		status.ETA = 0
+	}
+	if !j.validating.IsZero() && status.Processed > 0 {
+		end := time.Now()
+		if !j.ended.IsZero() {
+			end = j.ended
+		}
+		if elapsed := end.Sub(j.validating).Seconds(); elapsed > 0 {
+			status.Rate = float64(status.Processed) / elapsed
+		}
+		if !status.finished() && status.Rate > 0 {
+			status.ETA = int64(math.Ceil(float64(status.Total-status.Processed) / status.Rate))
+		}
+	}
+	return status
+}
+
+// Subscribe 订阅任务事件，返回事件通道和取消订阅的函数，任务结束后通道会被关闭
+// 订阅者处理不及时时会丢弃部分事件，之后事件中的 Status 仍是准确的统计
+func (j *Job) Subscribe() (<-chan JobEvent, func()) {
+	ch := make(chan JobEvent, jobEventBuffer)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.status.finished() {
+		close(ch)
+		return ch, func() {}
+	}
+	if j.subscribers == nil {
+		j.subscribers = make(map[chan JobEvent]struct{})
+	}
+	j.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subscribers[ch]; ok {
+			delete(j.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish 向所有订阅者推送事件，调用方需持有写锁
+func (j *Job) publish(event JobEvent) {
+	for ch := range j.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// finished 任务是否已结束
+func (s JobStatus) finished() bool {
+	return s.State == JobDone || s.State == JobFailed || s.State == JobCancelled
+}
+
+// Run 等待运行名额后执行 fn，并根据 fn 的返回值结束任务
+// fn 中应使用 job.Context() 以便及时响应取消；fn 中发生的 panic 会被记录为任务失败
+func (j *Job) Run(fn func(job *Job) (*JobSummary, error)) {
+	select {
+	case jobSlots <- struct{}{}:
+		defer func() { <-jobSlots }()
+	case <-j.ctx.Done():
+		// 排队时被取消
+		j.finish(nil, j.ctx.Err())
+		return
+	}
+
+	j.mu.Lock()
+	j.status.State = JobRunning
+	j.status.StartedAt = time.Now().Unix()
+	j.publish(JobEvent{Type: JobEventStatus, Status: j.snapshot()})
+	j.mu.Unlock()
+
+	var (
+		summary *JobSummary
+		err     error
+	)
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("任务异常: %v", r)
+			}
+		}()
+		summary, err = fn(j)
+	}()
+	j.finish(summary, err)
+}
+
+// finish 结束任务，推送最终状态后关闭所有订阅者的通道
+// 任务被取消时 summary 为已完成部分的统计
+func (j *Job) finish(summary *JobSummary, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.ended = time.Now()
+	j.status.EndedAt = j.ended.Unix()
+	j.status.Summary = summary
+	switch {
+	case j.ctx.Err() != nil:
+		j.status.State = JobCancelled
+		j.status.Error = "任务已取消"
+	case err != nil:
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+	default:
+		j.status.State = JobDone
+	}
+	j.cancel()
+
+	j.publish(JobEvent{Type: JobEventStatus, Status: j.snapshot()})
+	for ch := range j.subscribers {
+		close(ch)
+	}
+	j.subscribers = nil
+}
+
+// addTotal 增加待验证的链接数
+func (j *Job) addTotal(n int) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.validating.IsZero() {
+		j.validating = time.Now()
+	}
+	j.status.Total += n
+}
+
+// record 记录一个已处理的条目
+func (j *Job) record(entry Entry) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.status.Processed++
+	switch {
+	case entry.Unverified:
+		j.status.Unverified++
+	case entry.Probe != nil && entry.Probe.Valid:
+		j.status.Succeeded++
+	default:
+		j.status.Failed++
+	}
+
+	result := &JobResult{URL: entry.URL, Unverified: entry.Unverified, Probe: entry.Probe}
+	if entry.Info != nil {
+		result.Title = entry.Info.Title
+	}
+	j.publish(JobEvent{Type: JobEventResult, Result: result, Status: j.snapshot()})
+}
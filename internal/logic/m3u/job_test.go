@@ -0,0 +1,152 @@
+package m3u
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJob_TracksProgressPerJob(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dead" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+	}))
+	defer server.Close()
+
+	a := NewJob(JobKindPlaylist, "a")
+	b := NewJob(JobKindChannel, "b")
+	entries := []Entry{
+		{URL: server.URL + "/live"},
+		{URL: server.URL + "/dead"},
+		{URL: "rtsp://example.com/live"},
+	}
+
+	a.Run(func(job *Job) (*JobSummary, error) {
+		result, err := ValidateAndUnique(job.Context(), job, entries, ValidateOptions{MaxLatency: time.Second, Workers: 2})
+		if err != nil {
+			return nil, err
+		}
+		return &JobSummary{Total: len(entries), Valid: len(result.Unique)}, nil
+	})
+	b.Run(func(job *Job) (*JobSummary, error) {
+		return nil, errors.New("解析失败")
+	})
+
+	status := a.Status()
+	if status.State != JobDone || status.Total != 3 || status.Processed != 3 ||
+		status.Succeeded != 1 || status.Failed != 1 || status.Unverified != 1 || status.Progress != 100 {
+		t.Errorf("任务进度不符合预期: %+v", status)
+	}
+	if status.Summary == nil || status.Summary.Valid != 2 || status.StartedAt == 0 || status.EndedAt == 0 {
+		t.Errorf("任务结果不符合预期: %+v", status)
+	}
+	if status := b.Status(); status.State != JobFailed || status.Error != "解析失败" || status.Processed != 0 {
+		t.Errorf("失败的任务状态不符合预期: %+v", status)
+	}
+
+	if GetJob(a.ID()) != a {
+		t.Error("应能根据 ID 查找任务")
+	}
+	if list := ListJobs("b", 0); len(list) == 0 || list[0].ID != b.ID() {
+		t.Errorf("应只返回指定用户的任务: %+v", list)
+	}
+	if list := ListJobs("", 2); len(list) != 2 || list[0].ID != b.ID() || list[1].ID != a.ID() {
+		t.Errorf("最近的任务应排在前面: %+v", list)
+	}
+}
+
+func TestJob_Subscribe(t *testing.T) {
+	job := NewJob(JobKindPlaylist, "sub")
+	events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+
+	entries := []Entry{{URL: "rtsp://example.com/a"}, {URL: "rtmp://example.com/b"}}
+	go job.Run(func(job *Job) (*JobSummary, error) {
+		_, err := ValidateAndUnique(job.Context(), job, entries, ValidateOptions{MaxLatency: time.Second, Workers: 2})
+		return &JobSummary{Total: len(entries)}, err
+	})
+
+	var results int
+	var last JobEvent
+	for event := range events {
+		if event.Type == JobEventResult {
+			results++
+			if event.Result == nil || !event.Result.Unverified {
+				t.Errorf("结果事件不符合预期: %+v", event)
+			}
+		}
+		last = event
+	}
+	if results != len(entries) {
+		t.Errorf("应推送 %d 个结果事件，实际为 %d", len(entries), results)
+	}
+	if last.Type != JobEventStatus || last.Status.State != JobDone || last.Status.ETA != 0 {
+		t.Errorf("最后一个事件应为结束状态: %+v", last)
+	}
+
+	// 任务结束后订阅会立即得到已关闭的通道
+	events, _ = job.Subscribe()
+	if _, ok := <-events; ok {
+		t.Error("已结束的任务不应再推送事件")
+	}
+}
+
+func TestJob_Cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+	}))
+	defer server.Close()
+
+	entries := []Entry{{URL: server.URL + "/fast"}}
+	for i := 0; i < 5; i++ {
+		entries = append(entries, Entry{URL: fmt.Sprintf("%s/slow?%d", server.URL, i)})
+	}
+
+	job := NewJob(JobKindPlaylist, "cancel")
+	events, unsubscribe := job.Subscribe()
+	defer unsubscribe()
+	go func() {
+		for event := range events {
+			if event.Type == JobEventResult {
+				job.Cancel()
+			}
+		}
+	}()
+
+	var result *ValidateResult
+	var validateErr error
+	start := time.Now()
+	job.Run(func(job *Job) (*JobSummary, error) {
+		result, validateErr = ValidateAndUnique(job.Context(), job, entries, ValidateOptions{MaxLatency: 5 * time.Second, Workers: 10})
+		return &JobSummary{Total: len(entries)}, validateErr
+	})
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("取消后应中断进行中的探测")
+	}
+
+	if !errors.Is(validateErr, context.Canceled) {
+		t.Errorf("应返回取消错误: %v", validateErr)
+	}
+	// 被中断的探测不计入结果
+	if len(result.Probes) != 1 || len(result.Unique) != 1 {
+		t.Errorf("应只保留已完成的结果: probes=%d unique=%d", len(result.Probes), len(result.Unique))
+	}
+	status := job.Status()
+	if status.State != JobCancelled || status.Processed != 1 || status.Failed != 0 || status.Summary == nil {
+		t.Errorf("取消后的任务状态不符合预期: %+v", status)
+	}
+	if job.Cancel() {
+		t.Error("已结束的任务不应能再次取消")
+	}
+}
@@ -0,0 +1,201 @@
+package m3u
+
+import (
+	"context"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWorkers 未设置并发数时同时进行的探测数
+	DefaultWorkers = 100
+	// DefaultRetryBackoff 未设置重试间隔时第一次重试前等待的时间
+	DefaultRetryBackoff = 500 * time.Millisecond
+)
+
+// ValidateOptions 批量验证的超时、并发和访问频率设置
+type ValidateOptions struct {
+	MaxLatency time.Duration // 单个地址的最大延迟
+	Workers    int           // 同时进行的探测数，0 使用 DefaultWorkers
+	PerHost    int           // 每个主机同时进行的探测数，0 不限制
+	HostRPS    float64       // 每个主机每秒最多开始的探测数，0 不限制
+	Jitter     time.Duration // 每次探测前随机等待的最长时间，避免同时发起请求
+
+	Retries      int           // 超时、连接重置和 5xx 等暂时性失败的重试次数
+	RetryBackoff time.Duration // 第一次重试前等待的时间，之后每次加倍，0 使用 DefaultRetryBackoff
+
+	HostFailures int // 同一主机连续解析失败或拒绝连接达到该次数后不再探测其余地址，0 不限制
+
+	SkipStaleCheck bool // 不检查 HLS 直播列表是否更新，检查时需要等待一个分片时长后重新获取列表
+
+	MaxDepth int // 探测到地址返回频道列表时展开的最大嵌套深度，0 不展开
+}
+
+// backoff 返回第 attempt 次重试前等待的时间（attempt 从 1 开始）
+func (o ValidateOptions) backoff(attempt int) time.Duration {
+	base := o.RetryBackoff
+	if base <= 0 {
+		base = DefaultRetryBackoff
+	}
+	return base << (attempt - 1)
+}
+
+// hostLimiter 限制对同一主机的并发数和请求频率
+// 聚合的播放列表中大量地址常来自同一个源站，并发过多会被限流，导致正常的地址被判为失效
+type hostLimiter struct {
+	perHost  int
+	interval time.Duration // 同一主机两次探测开始的最小间隔
+	jitter   time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+// hostSlot 单个主机的并发名额和下一次可以开始探测的时间
+type hostSlot struct {
+	sem  chan struct{}
+	next time.Time
+}
+
+func newHostLimiter(opts ValidateOptions) *hostLimiter {
+	l := &hostLimiter{
+		perHost: opts.PerHost,
+		jitter:  opts.Jitter,
+		hosts:   make(map[string]*hostSlot),
+	}
+	if opts.HostRPS > 0 {
+		l.interval = time.Duration(float64(time.Second) / opts.HostRPS)
+	}
+	return l
+}
+
+// slot 返回主机对应的名额，不存在时创建
+func (l *hostLimiter) slot(host string) *hostSlot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := l.hosts[host]
+	if s == nil {
+		s = &hostSlot{}
+		if l.perHost > 0 {
+			s.sem = make(chan struct{}, l.perHost)
+		}
+		l.hosts[host] = s
+	}
+	return s
+}
+
+// acquire 等待主机的并发名额和请求间隔，ctx 被取消时返回错误
+// 返回 nil 时调用方需在探测结束后调用 release
+func (l *hostLimiter) acquire(ctx context.Context, host string) error {
+	s := l.slot(host)
+	if s.sem != nil {
+		select {
+		case s.sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	var wait time.Duration
+	if l.interval > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		if s.next.Before(now) {
+			s.next = now
+		}
+		wait = s.next.Sub(now)
+		s.next = s.next.Add(l.interval)
+		l.mu.Unlock()
+	}
+	if l.jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(l.jitter)))
+	}
+	if err := SleepContext(ctx, wait); err != nil {
+		l.release(host)
+		return err
+	}
+	return nil
+}
+
+// release 归还主机的并发名额
+func (l *hostLimiter) release(host string) {
+	if s := l.slot(host); s.sem != nil {
+		<-s.sem
+	}
+}
+
+// SleepContext 等待 d，ctx 被取消时提前返回错误
+func SleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostOf 返回地址的主机名，用于按主机限制并发
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// hostPortOf 返回地址的主机名和端口，同一主机的不同端口可能是不同的服务
+func hostPortOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// interleaveByHost 按主机轮流排列条目，同一主机的条目保持原有顺序
+// 避免大量协程同时等待同一主机的名额，而其他主机的地址迟迟得不到探测
+// 只在相邻且优先级相同的条目之间轮流排列，优先级高的条目仍先验证
+func interleaveByHost(entries []Entry) []Entry {
+	result := make([]Entry, 0, len(entries))
+	for start := 0; start < len(entries); {
+		end := start + 1
+		for end < len(entries) && entries[end].Priority == entries[start].Priority {
+			end++
+		}
+		result = appendInterleaved(result, entries[start:end])
+		start = end
+	}
+	return result
+}
+
+// appendInterleaved 将 entries 按主机轮流排列后追加到 result
+func appendInterleaved(result, entries []Entry) []Entry {
+	var hosts []string
+	byHost := make(map[string][]Entry)
+	for _, entry := range entries {
+		host := hostOf(entry.URL)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], entry)
+	}
+
+	for n := 0; n < len(entries); {
+		for _, host := range hosts {
+			if list := byHost[host]; len(list) > 0 {
+				result = append(result, list[0])
+				byHost[host] = list[1:]
+				n++
+			}
+		}
+	}
+	return result
+}
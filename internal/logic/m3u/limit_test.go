@@ -0,0 +1,109 @@
+package m3u
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateAndUnique_PerHostLimit(t *testing.T) {
+	var active, peak int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&active, 1)
+		defer atomic.AddInt64(&active, -1)
+		for {
+			p := atomic.LoadInt64(&peak)
+			if n <= p || atomic.CompareAndSwapInt64(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+	}))
+	defer server.Close()
+
+	var entries []Entry
+	for i := 0; i < 12; i++ {
+		entries = append(entries, Entry{URL: fmt.Sprintf("%s/%d.ts", server.URL, i)})
+	}
+	result, err := ValidateAndUnique(context.Background(), nil, entries, ValidateOptions{
+		MaxLatency: time.Second,
+		Workers:    12,
+		PerHost:    3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unique) != len(entries) {
+		t.Errorf("所有地址都应验证通过: %d", len(result.Unique))
+	}
+	if p := atomic.LoadInt64(&peak); p > 3 {
+		t.Errorf("同一主机的并发数不应超过 3，实际为 %d", p)
+	}
+}
+
+func TestHostLimiter_RPS(t *testing.T) {
+	l := newHostLimiter(ValidateOptions{HostRPS: 20})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.acquire(context.Background(), "a.example.com"); err != nil {
+			t.Fatal(err)
+		}
+		l.release("a.example.com")
+	}
+	// 每秒 20 次，5 次探测之间至少间隔 4 × 50ms
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("请求频率未被限制: %v", elapsed)
+	}
+
+	// 不同主机互不影响
+	start = time.Now()
+	if err := l.acquire(context.Background(), "b.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("其他主机不应等待: %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.acquire(ctx, "a.example.com"); err == nil {
+		t.Error("ctx 取消后应返回错误")
+	}
+}
+
+func TestInterleaveByHost(t *testing.T) {
+	entries := []Entry{
+		{URL: "http://a.com/1"}, {URL: "http://a.com/2"}, {URL: "http://a.com/3"},
+		{URL: "http://B.com/1"}, {URL: "http://c.com/1"}, {URL: "http://b.com/2"},
+	}
+	var urls []string
+	for _, entry := range interleaveByHost(entries) {
+		urls = append(urls, entry.URL)
+	}
+	want := "http://a.com/1 http://B.com/1 http://c.com/1 http://a.com/2 http://b.com/2 http://a.com/3"
+	if got := strings.Join(urls, " "); got != want {
+		t.Errorf("排列顺序不符合预期:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestInterleaveByHost_KeepsPriority(t *testing.T) {
+	entries := []Entry{
+		{URL: "http://a.com/fav", Priority: 0}, {URL: "http://a.com/fav2", Priority: 0},
+		{URL: "http://a.com/fail", Priority: 1}, {URL: "http://b.com/fail", Priority: 1},
+		{URL: "http://b.com/1", Priority: 2}, {URL: "http://b.com/2", Priority: 2}, {URL: "http://c.com/1", Priority: 2},
+	}
+	var urls []string
+	for _, entry := range interleaveByHost(entries) {
+		urls = append(urls, entry.URL)
+	}
+	want := "http://a.com/fav http://a.com/fav2 http://a.com/fail http://b.com/fail http://b.com/1 http://c.com/1 http://b.com/2"
+	if got := strings.Join(urls, " "); got != want {
+		t.Errorf("只应在同一优先级内轮流排列:\n got: %s\nwant: %s", got, want)
+	}
+}
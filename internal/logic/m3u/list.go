@@ -0,0 +1,305 @@
+package m3u
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tv-server/internal/model/types"
+)
+
+// listScanner 用于需要整体读取后才能解析的格式（XSPF、PLS、JSON），依次返回解析出的条目
+type listScanner struct {
+	base    *url.URL
+	entries []Entry
+	entry   Entry
+	err     error
+	warningList
+}
+
+// newListScanner 使用 parse 解析 r 的全部内容
+func newListScanner(r io.Reader, baseURL string, parse func(io.Reader, *listScanner) error) (*listScanner, error) {
+	s := &listScanner{}
+	if baseURL != "" {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		s.base = u
+	}
+	s.err = parse(r, s)
+	return s, nil
+}
+
+// Scan 读取下一个条目，没有更多条目时返回 false
+func (s *listScanner) Scan() bool {
+	if len(s.entries) == 0 {
+		return false
+	}
+	s.entry, s.entries = s.entries[0], s.entries[1:]
+	return true
+}
+
+// Entry 返回最近一次 Scan 读取到的条目
+func (s *listScanner) Entry() Entry {
+	return s.entry
+}
+
+// Header 这些格式没有 #EXTM3U 头，始终返回 nil
+func (s *listScanner) Header() *Header {
+	return nil
+}
+
+// Err 返回解析过程中遇到的错误
+func (s *listScanner) Err() error {
+	return s.err
+}
+
+// add 添加一个条目，地址无效时记录警告并跳过
+func (s *listScanner) add(line int, info *ExtInf, rawURL string, opt *types.StreamOption) {
+	streamURL, err := resolveStreamURL(strings.TrimSpace(rawURL), s.base)
+	if err != nil {
+		s.warn(line, fmt.Sprintf("%v，已跳过: %s", err, truncate(rawURL, 80)))
+		return
+	}
+	s.entries = append(s.entries, Entry{
+		Metadata: formatExtInf(info),
+		URL:      streamURL,
+		Options:  opt,
+		Info:     info,
+	})
+}
+
+// newExtInf 根据名称、分组和台标构造 #EXTINF 信息
+func newExtInf(duration float64, title, group, logo string) *ExtInf {
+	if group == "" {
+		group = DefaultGroup
+	}
+	attrs := map[string]string{AttrGroupTitle: group}
+	if logo != "" {
+		attrs[AttrTvgLogo] = logo
+	}
+	return &ExtInf{Duration: duration, Attrs: attrs, Title: title}
+}
+
+// XSPF 格式，参见 https://xspf.org/spec
+// VLC 导出的列表在扩展中以 vlc:node 记录分组，以 vlc:option 记录播放选项
+type xspfPlaylist struct {
+	Tracks []xspfTrack `xml:"trackList>track"`
+	Nodes  []xspfNode  `xml:"extension>node"`
+}
+
+type xspfTrack struct {
+	Locations  []string        `xml:"location"`
+	Title      string          `xml:"title"`
+	Album      string          `xml:"album"`
+	Image      string          `xml:"image"`
+	Duration   string          `xml:"duration"` // 毫秒
+	Extensions []xspfExtension `xml:"extension"`
+}
+
+type xspfExtension struct {
+	ID      string   `xml:"id"`
+	Options []string `xml:"option"`
+}
+
+type xspfNode struct {
+	Title string     `xml:"title,attr"`
+	Nodes []xspfNode `xml:"node"`
+	Items []struct {
+		TID string `xml:"tid,attr"`
+	} `xml:"item"`
+}
+
+// parseXSPF 解析 XSPF 格式
+func parseXSPF(r io.Reader, s *listScanner) error {
+	dec := xml.NewDecoder(r)
+	// 内容在解析前已统一转换为 UTF-8，忽略 XML 声明中的编码
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	var playlist xspfPlaylist
+	if err := dec.Decode(&playlist); err != nil {
+		return fmt.Errorf("解析 XSPF 失败: %w", err)
+	}
+
+	// vlc:item 的 tid 对应 track 中的 vlc:id
+	groups := make(map[string]string)
+	var walk func(nodes []xspfNode)
+	walk = func(nodes []xspfNode) {
+		for _, node := range nodes {
+			for _, item := range node.Items {
+				groups[item.TID] = node.Title
+			}
+			walk(node.Nodes)
+		}
+	}
+	walk(playlist.Nodes)
+
+	for i, track := range playlist.Tracks {
+		if len(track.Locations) == 0 {
+			s.warn(0, fmt.Sprintf("第 %d 个 track 缺少 location", i+1))
+			continue
+		}
+
+		var opt *types.StreamOption
+		group := track.Album
+		for _, ext := range track.Extensions {
+			if g, ok := groups[ext.ID]; ok && ext.ID != "" {
+				group = g
+			}
+			for _, option := range ext.Options {
+				if opt == nil {
+					opt = &types.StreamOption{}
+				}
+				if err := parseOptionLine(opt, prefixVLCOpt+option); err != nil {
+					s.warn(0, fmt.Sprintf("第 %d 个 track: %v", i+1, err))
+				}
+			}
+		}
+
+		duration := -1.0
+		if ms, err := strconv.ParseFloat(strings.TrimSpace(track.Duration), 64); err == nil && ms > 0 {
+			duration = ms / 1000
+		}
+		title := strings.TrimSpace(track.Title)
+
+		// 多个 location 是同一内容的备用地址
+		for _, location := range track.Locations {
+			s.add(0, newExtInf(duration, title, strings.TrimSpace(group), strings.TrimSpace(track.Image)), location, opt)
+		}
+	}
+	return nil
+}
+
+// plsItem PLS 格式中同一序号的各字段
+type plsItem struct {
+	line   int
+	file   string
+	title  string
+	length float64
+}
+
+// parsePLS 解析 PLS 格式
+//
+//	[playlist]
+//	File1=http://example.com/radio.mp3
+//	Title1=电台
+//	Length1=-1
+//	NumberOfEntries=1
+func parsePLS(r io.Reader, s *listScanner) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	items := make(map[int]*plsItem)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "[") || strings.HasPrefix(text, ";") {
+			continue
+		}
+
+		key, value, found := strings.Cut(text, "=")
+		if !found {
+			s.warn(line, fmt.Sprintf("无法识别的行: %s", truncate(text, 80)))
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			// NumberOfEntries、Version 等
+			continue
+		}
+		n, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			s.warn(line, fmt.Sprintf("无法识别的键: %s", key))
+			continue
+		}
+
+		item := items[n]
+		if item == nil {
+			item = &plsItem{length: -1}
+			items[n] = item
+		}
+		switch field {
+		case "file":
+			item.file, item.line = value, line
+		case "title":
+			item.title = value
+		case "length":
+			if length, err := strconv.ParseFloat(value, 64); err == nil {
+				item.length = length
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+
+	indexes := make([]int, 0, len(items))
+	for n := range items {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+	for _, n := range indexes {
+		item := items[n]
+		if item.file == "" {
+			s.warn(0, fmt.Sprintf("第 %d 项缺少 File%d", n, n))
+			continue
+		}
+		s.add(item.line, newExtInf(item.length, item.title, "", ""), item.file, nil)
+	}
+	return nil
+}
+
+// jsonChannel JSON 格式中的单个频道
+type jsonChannel struct {
+	Name  string `json:"name"`
+	Group string `json:"group"`
+	Logo  string `json:"logo"`
+	URL   string `json:"url"`
+}
+
+// parseJSON 解析 JSON 数组格式: [{"name": "", "group": "", "logo": "", "url": ""}]
+func parseJSON(r io.Reader, s *listScanner) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return fmt.Errorf("解析 JSON 失败: %w", err)
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("解析 JSON 失败: 顶层应为数组")
+	}
+
+	for i := 1; dec.More(); i++ {
+		// 先读取原始内容，单个条目格式错误时不影响其余条目
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("解析 JSON 第 %d 个条目失败: %w", i, err)
+		}
+		var ch jsonChannel
+		if err := json.Unmarshal(raw, &ch); err != nil {
+			s.warn(0, fmt.Sprintf("第 %d 个条目格式错误: %v", i, err))
+			continue
+		}
+		if ch.URL == "" {
+			s.warn(0, fmt.Sprintf("第 %d 个条目缺少 url", i))
+			continue
+		}
+		s.add(0, newExtInf(-1, strings.TrimSpace(ch.Name), strings.TrimSpace(ch.Group), strings.TrimSpace(ch.Logo)), ch.URL, nil)
+	}
+	return nil
+}
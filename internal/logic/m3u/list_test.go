@@ -0,0 +1,99 @@
+package m3u
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseReader_ListFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		content string
+	}{
+		{"XSPF", FormatXSPF, `<?xml version="1.0" encoding="UTF-8"?>
+<playlist xmlns="http://xspf.org/ns/0/" xmlns:vlc="http://www.videolan.org/vlc/playlist/ns/0/" version="1">
+  <trackList>
+    <track>
+      <location>http://example.com/cctv1.m3u8</location>
+      <title>CCTV-1</title>
+      <image>http://example.com/cctv1.png</image>
+      <extension application="http://www.videolan.org/vlc/playlist/0">
+        <vlc:id>0</vlc:id>
+        <vlc:option>http-user-agent=AptvPlayer/1.0</vlc:option>
+      </extension>
+    </track>
+    <track>
+      <location>/hunan.m3u8</location>
+      <title>湖南卫视</title>
+      <album>卫视</album>
+    </track>
+    <track><title>缺少地址</title></track>
+  </trackList>
+  <extension application="http://www.videolan.org/vlc/playlist/0">
+    <vlc:node title="央视"><vlc:item tid="0"/></vlc:node>
+  </extension>
+</playlist>`},
+		{"PLS", FormatPLS, `[playlist]
+File2=/hunan.m3u8
+Title2=湖南卫视
+File1=http://example.com/cctv1.m3u8
+Title1=CCTV-1
+Length1=-1
+Title3=缺少地址
+NumberOfEntries=3
+Version=2
+`},
+		{"JSON", FormatJSON, `[
+  {"name": "CCTV-1", "group": "央视", "logo": "http://example.com/cctv1.png", "url": "http://example.com/cctv1.m3u8"},
+  {"name": "湖南卫视", "group": "卫视", "url": "/hunan.m3u8"},
+  {"name": "缺少地址"},
+  {"name": 1}
+]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat([]byte(tt.content)); got != tt.format {
+				t.Fatalf("格式应为 %s，实际为 %s", tt.format, got)
+			}
+			playlist, err := ParseReader(strings.NewReader(tt.content), "http://example.com/list")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if playlist.Format != tt.format {
+				t.Errorf("格式应为 %s，实际为 %s", tt.format, playlist.Format)
+			}
+			if playlist.WarningCount == 0 {
+				t.Error("缺少地址的条目应产生警告")
+			}
+
+			parsed := ParseEntry(playlist.Entries)
+			if len(parsed) != 2 {
+				t.Fatalf("期望 2 个条目，实际 %d 个: %+v", len(parsed), parsed)
+			}
+			if parsed[0].Title != "CCTV-1" || parsed[0].URL != "http://example.com/cctv1.m3u8" {
+				t.Errorf("第一个条目不符合预期: %+v", parsed[0])
+			}
+			if parsed[1].Title != "湖南卫视" || parsed[1].URL != "http://example.com/hunan.m3u8" {
+				t.Errorf("相对地址应基于列表地址解析: %+v", parsed[1])
+			}
+			if tt.format != FormatPLS {
+				if parsed[0].Channel != "央视" || parsed[1].Channel != "卫视" {
+					t.Errorf("分组不符合预期: %s %s", parsed[0].Channel, parsed[1].Channel)
+				}
+				if parsed[0].Logo != "http://example.com/cctv1.png" {
+					t.Errorf("台标不符合预期: %s", parsed[0].Logo)
+				}
+			}
+		})
+	}
+
+	playlist, err := ParseReader(strings.NewReader(tests[0].content), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opt := playlist.Entries[0].Options; opt == nil || opt.UserAgent != "AptvPlayer/1.0" {
+		t.Errorf("XSPF 中的 vlc:option 应转换为请求选项: %+v", opt)
+	}
+}
@@ -0,0 +1,242 @@
+package m3u
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMulticastWait 未设置超时时间时等待第一个组播数据包的最长时间
+	defaultMulticastWait = 3 * time.Second
+	// rtpHeaderSize RTP 固定头部的长度
+	rtpHeaderSize = 12
+	// maxDatagramSize 单个 UDP 数据包的最大长度
+	maxDatagramSize = 64 * 1024
+)
+
+var (
+	multicastMu    sync.RWMutex
+	multicastIface *net.Interface
+)
+
+// SetMulticastInterface 设置加入组播组使用的网卡，name 为网卡名称或网卡上的 IPv4 地址，为空时由系统按路由选择
+// 找不到网卡时返回错误且不改变原有设置
+func SetMulticastInterface(name string) error {
+	var ifi *net.Interface
+	if name != "" {
+		var err error
+		if ifi, err = findInterface(name); err != nil {
+			return err
+		}
+	}
+	multicastMu.Lock()
+	multicastIface = ifi
+	multicastMu.Unlock()
+	return nil
+}
+
+func multicastInterface() *net.Interface {
+	multicastMu.RLock()
+	defer multicastMu.RUnlock()
+	return multicastIface
+}
+
+// findInterface 按名称或 IPv4 地址查找网卡
+func findInterface(name string) (*net.Interface, error) {
+	ip := net.ParseIP(name)
+	if ip == nil {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("找不到网卡 %s: %w", name, err)
+		}
+		return ifi, nil
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("获取网卡列表失败: %w", err)
+	}
+	for i := range ifaces {
+		addrs, err := ifaces[i].Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return &ifaces[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("找不到地址为 %s 的网卡", name)
+}
+
+// isMulticastURL 判断是否为 udp:// 或 rtp:// 组播地址
+func isMulticastURL(rawURL string) bool {
+	switch URLScheme(rawURL) {
+	case "udp", "rtp":
+		return true
+	}
+	return false
+}
+
+// multicastGroup 解析后的组播地址
+type multicastGroup struct {
+	addr   *net.UDPAddr
+	source net.IP // 只接收该地址发送的数据，nil 不限制
+}
+
+// parseMulticastURL 解析 udp://[源地址]@组播地址:端口 形式的地址，rtp:// 相同
+func parseMulticastURL(rawURL string) (*multicastGroup, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的地址: %w", err)
+	}
+	addr, err := net.ResolveUDPAddr("udp4", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("无效的组播地址: %w", err)
+	}
+	if !addr.IP.IsMulticast() || addr.Port == 0 {
+		return nil, fmt.Errorf("%s 不是组播地址", u.Host)
+	}
+	group := &multicastGroup{addr: addr}
+	if source := u.User.Username(); source != "" {
+		if group.source = net.ParseIP(source).To4(); group.source == nil {
+			return nil, fmt.Errorf("无效的源地址: %s", source)
+		}
+	}
+	return group, nil
+}
+
+// multicastPayload 返回数据包中的媒体数据，RTP 封装的数据去掉 RTP 头部
+// 不少 udp:// 源实际使用 RTP 封装，rtp:// 源也可能直接发送 TS，因此按内容判断而不是按协议
+func multicastPayload(pkt []byte) []byte {
+	if len(pkt) == 0 || pkt[0] == tsSyncByte {
+		return pkt
+	}
+	if payload, ok := rtpPayload(pkt); ok {
+		return payload
+	}
+	return pkt
+}
+
+// rtpPayload 去掉 RTP 头部、CSRC 列表、扩展头和填充，不是有效的 RTP 数据包时 ok 为 false
+func rtpPayload(pkt []byte) (payload []byte, ok bool) {
+	if len(pkt) < rtpHeaderSize || pkt[0]>>6 != 2 {
+		return nil, false
+	}
+	start := rtpHeaderSize + int(pkt[0]&0x0f)*4
+	if pkt[0]&0x10 != 0 {
+		if len(pkt) < start+4 {
+			return nil, false
+		}
+		start += 4 + int(binary.BigEndian.Uint16(pkt[start+2:]))*4
+	}
+	end := len(pkt)
+	if pkt[0]&0x20 != 0 {
+		end -= int(pkt[end-1])
+	}
+	if start > end {
+		return nil, false
+	}
+	return pkt[start:end], true
+}
+
+// multicastReader 从组播连接中逐个读取数据包的媒体数据
+type multicastReader struct {
+	conn   *net.UDPConn
+	source net.IP
+	buf    []byte
+}
+
+// next 读取下一个数据包，跳过其它源发送的数据和空数据包，返回的切片在下一次读取前有效
+func (r *multicastReader) next() ([]byte, error) {
+	for {
+		n, from, err := r.conn.ReadFromUDP(r.buf)
+		if err != nil {
+			return nil, err
+		}
+		if r.source != nil && !from.IP.Equal(r.source) {
+			continue
+		}
+		if payload := multicastPayload(r.buf[:n]); len(payload) > 0 {
+			return payload, nil
+		}
+	}
+}
+
+// probeMulticast 加入组播组，在最大延迟内等待数据并确认为 MPEG-TS，再接收一段时间测量码率
+func (p *prober) probeMulticast(rawURL string) error {
+	group, err := parseMulticastURL(rawURL)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", multicastInterface(), group.addr)
+	if err != nil {
+		return fmt.Errorf("加入组播组失败: %w", err)
+	}
+	defer conn.Close()
+	// 取消时关闭连接以结束正在等待的读取
+	stop := context.AfterFunc(p.ctx, func() { conn.Close() })
+	defer stop()
+
+	wait := p.maxLatency
+	if wait <= 0 {
+		wait = defaultMulticastWait
+	}
+	r := &multicastReader{conn: conn, source: group.source, buf: make([]byte, maxDatagramSize)}
+
+	conn.SetReadDeadline(p.start.Add(wait))
+	payload, err := r.next()
+	if err != nil {
+		if p.ctx.Err() != nil {
+			return p.ctx.Err()
+		}
+		return fmt.Errorf("%v 内没有收到组播数据: %w", wait, err)
+	}
+	first := time.Now()
+	p.result.TTFB = first.Sub(p.start).Milliseconds()
+	p.result.Latency = p.result.TTFB
+	p.result.Live = true
+
+	// 一个数据包一般只有 7 个 TS 包，凑够识别格式所需的长度，码率从第一个数据包之后开始统计
+	deadline := first.Add(p.sampleTime)
+	conn.SetReadDeadline(deadline)
+	head := append([]byte(nil), payload...)
+	var received int64
+	last := first
+	for len(head) < sniffSize {
+		if payload, err = r.next(); err != nil {
+			break
+		}
+		head = append(head, payload...)
+		received += int64(len(payload))
+		last = time.Now()
+	}
+	sniffer, err := sniffMedia(head)
+	if err != nil {
+		return err
+	}
+	if sniffer.ts == nil {
+		return badContent("组播数据不是 MPEG-TS")
+	}
+	sniffer.ts.Write(head)
+
+	for received < segmentReadSize && time.Now().Before(deadline) {
+		if payload, err = r.next(); err != nil {
+			break
+		}
+		sniffer.ts.Write(payload)
+		received += int64(len(payload))
+		last = time.Now()
+	}
+	if p.ctx.Err() != nil {
+		return p.ctx.Err()
+	}
+	p.result.Throughput = throughput(received, last.Sub(first))
+	sniffer.apply(p.result)
+	return nil
+}
@@ -0,0 +1,132 @@
+package m3u
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+
+	"golang.org/x/net/ipv4"
+)
+
+// loopbackInterface 返回回环网卡，并将组播接口设置为该网卡
+func loopbackInterface(t *testing.T) *net.Interface {
+	t.Helper()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("获取网卡列表失败: %v", err)
+	}
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagLoopback != 0 && ifaces[i].Flags&net.FlagUp != 0 {
+			if err := SetMulticastInterface(ifaces[i].Name); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { SetMulticastInterface("") })
+			return &ifaces[i]
+		}
+	}
+	t.Skip("没有可用的回环网卡")
+	return nil
+}
+
+// sendMulticast 持续通过 ifi 向 group 发送 packet，直到 ctx 结束
+func sendMulticast(t *testing.T, ctx context.Context, ifi *net.Interface, group string, packet []byte) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("创建发送连接失败: %v", err)
+	}
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetMulticastInterface(ifi); err != nil {
+		conn.Close()
+		t.Skipf("不支持在回环网卡上发送组播: %v", err)
+	}
+	pc.SetMulticastLoopback(true)
+	dst, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer conn.Close()
+		ticker := time.NewTicker(2 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pc.WriteTo(packet, nil, dst)
+			}
+		}
+	}()
+}
+
+// tsDatagram 返回由 7 个 TS 包组成的数据包，第一个包为 PAT
+func tsDatagram() []byte {
+	pkt := make([]byte, 0, 7*tsPacketSize)
+	pat := make([]byte, tsPacketSize)
+	copy(pat, []byte{tsSyncByte, 0x40, 0x00, 0x10, 0x00})
+	pkt = append(pkt, pat...)
+	for i := 1; i < 7; i++ {
+		null := make([]byte, tsPacketSize)
+		copy(null, []byte{tsSyncByte, 0x1f, 0xff, 0x10})
+		pkt = append(pkt, null...)
+	}
+	return pkt
+}
+
+func TestValidateURL_Multicast(t *testing.T) {
+	ifi := loopbackInterface(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := tsDatagram()
+	rtp := append([]byte{0x80, 0x21, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 1}, ts...)
+	sendMulticast(t, ctx, ifi, "239.255.42.1:15001", ts)
+	sendMulticast(t, ctx, ifi, "239.255.42.2:15002", rtp)
+	sendMulticast(t, ctx, ifi, "239.255.42.3:15003", []byte("<html>not a stream</html>"))
+
+	for _, url := range []string{"udp://@239.255.42.1:15001", "rtp://@239.255.42.2:15002", "udp://239.255.42.2:15002"} {
+		res := ValidateURL(context.Background(), url, nil, 500*time.Millisecond)
+		if !res.Valid || res.Container != types.ContainerMPEGTS || res.Throughput <= 0 || !res.Live {
+			t.Errorf("%s 应验证通过并得到码率: %+v", url, res)
+		}
+	}
+
+	if res := ValidateURL(context.Background(), "udp://@239.255.42.3:15003", nil, 500*time.Millisecond); res.Valid ||
+		res.ErrorClass != types.ProbeErrorBadContent {
+		t.Errorf("不是 TS 的组播数据应判为 bad_content: %+v", res)
+	}
+	if res := ValidateURL(context.Background(), "udp://@239.255.42.4:15004", nil, 300*time.Millisecond); res.Valid ||
+		res.ErrorClass != types.ProbeErrorTimeout {
+		t.Errorf("没有数据的组播组应判为超时: %+v", res)
+	}
+	// 指定了其它源地址时不接收该组的数据
+	if res := ValidateURL(context.Background(), "udp://10.255.255.1@239.255.42.1:15001", nil, 300*time.Millisecond); res.Valid {
+		t.Errorf("其它源发送的数据不应计入: %+v", res)
+	}
+}
+
+func TestParseMulticastURL(t *testing.T) {
+	group, err := parseMulticastURL("rtp://10.0.0.1@239.1.2.3:5000")
+	if err != nil || group.addr.String() != "239.1.2.3:5000" || !group.source.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("解析结果不符合预期: %+v, %v", group, err)
+	}
+	for _, url := range []string{"udp://@10.0.0.1:5000", "udp://@239.1.2.3", "udp://bad@239.1.2.3:5000"} {
+		if _, err := parseMulticastURL(url); err == nil {
+			t.Errorf("%s 应解析失败", url)
+		}
+	}
+}
+
+func TestRTPPayload(t *testing.T) {
+	// 带 1 个 CSRC、1 个字的扩展头和 2 字节填充
+	pkt := []byte{0xb1, 0x21, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 2, 0xbe, 0xde, 0, 1, 1, 2, 3, 4, tsSyncByte, 0xff, 0, 2}
+	if payload, ok := rtpPayload(pkt); !ok || len(payload) != 2 || payload[0] != tsSyncByte {
+		t.Errorf("RTP 负载不符合预期: %v, %v", payload, ok)
+	}
+	if _, ok := rtpPayload([]byte{tsSyncByte, 0, 0}); ok {
+		t.Error("TS 数据不应识别为 RTP")
+	}
+}
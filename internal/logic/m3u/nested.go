@@ -0,0 +1,226 @@
+package m3u
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"tv-server/utils/httpclient"
+)
+
+// DefaultMaxDepth 嵌套播放列表默认的最大展开深度
+const DefaultMaxDepth = 3
+
+// nestedFetchTimeout 获取嵌套播放列表的超时时间
+const nestedFetchTimeout = 15 * time.Second
+
+// IsPlaylistContent 判断内容是否为频道列表，而不是 HLS 播放列表或媒体数据
+// HLS 播放列表同样以 #EXTM3U 开头，但一定包含 #EXT-X- 开头的标签
+func IsPlaylistContent(head []byte) bool {
+	if bytes.Contains(head, []byte("#EXT-X-")) {
+		return false
+	}
+	if bytes.Contains(head, []byte("#EXTINF")) {
+		return true
+	}
+	return DetectFormat(head) == FormatTXT
+}
+
+// isNestedCandidate 判断解析时是否预先获取条目的内容，检查是否指向另一个频道列表
+// 只预先获取扩展名为 .m3u 和 .txt 的地址，.m3u8 绝大多数是 HLS 播放列表，逐个请求代价太大；
+// 其余地址在验证时根据探测到的内容识别，见 Expander.Expand
+func isNestedCandidate(rawURL string) bool {
+	if !ProbeSupported(rawURL) {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(path.Ext(u.Path)) {
+	case ".m3u", ".txt":
+		return true
+	}
+	return false
+}
+
+// Expander 在流式解析时逐条展开指向其它频道列表的条目，嵌套列表同样以流式方式解析
+type Expander struct {
+	ctx      context.Context
+	maxDepth int
+	root     []string        // 顶层播放列表的地址
+	expanded map[string]bool // 已展开过的播放列表
+	warningList
+}
+
+// NewExpander 创建展开器，source 为顶层播放列表的地址，用于检测循环引用，可以为空
+// maxDepth 为最大嵌套深度，小于等于 0 时不展开；ctx 用于取消嵌套列表的获取
+func NewExpander(ctx context.Context, source string, maxDepth int) *Expander {
+	e := &Expander{
+		ctx:      ctx,
+		maxDepth: maxDepth,
+		expanded: make(map[string]bool),
+	}
+	if source != "" {
+		e.root = []string{playlistKey(source)}
+		e.expanded[playlistKey(source)] = true
+	}
+	return e
+}
+
+// Wrap 返回交给 ScanReader 等函数的回调，嵌套列表的条目被替换为其中的条目后交给 fn，其余条目直接交给 fn
+func (e *Expander) Wrap(fn func(Entry) error) func(Entry) error {
+	return func(entry Entry) error {
+		return e.emit(entry, e.root, 0, fn)
+	}
+}
+
+// AddWarnings 将展开过程中的警告追加到 playlist 原有的警告之后，这些警告没有对应的行号
+func (e *Expander) AddWarnings(playlist *Playlist) {
+	for _, w := range e.Warnings() {
+		if len(playlist.Warnings) < MaxWarnings {
+			playlist.Warnings = append(playlist.Warnings, w)
+		}
+	}
+	playlist.WarningCount += e.WarningCount()
+}
+
+// emit 展开 entry 指向的嵌套列表并将得到的条目交给 fn，不是嵌套列表时直接交给 fn
+// ancestors 为当前列表及其上层列表的地址，用于检测循环引用；depth 为当前列表的嵌套深度
+func (e *Expander) emit(entry Entry, ancestors []string, depth int, fn func(Entry) error) error {
+	if e.maxDepth <= 0 || !isNestedCandidate(entry.URL) {
+		return fn(entry)
+	}
+	handled, err := e.expand(entry, ancestors, depth, fn)
+	if handled || err != nil {
+		return err
+	}
+	return fn(entry)
+}
+
+// Expand 展开已从内容确认为频道列表的条目，如验证时探测到的返回频道列表的 .m3u8 或动态地址，不检查扩展名
+// 展开得到的条目交给 fn；条目所在列表已达到最大嵌套深度、已展开过或获取失败时不做处理
+func (e *Expander) Expand(entry Entry, fn func(Entry) error) error {
+	if e.maxDepth <= 0 {
+		return nil
+	}
+	ancestors := e.root
+	if entry.Source != "" {
+		ancestors = append(ancestors[:len(ancestors):len(ancestors)], playlistKey(entry.Source))
+	}
+	_, err := e.expand(entry, ancestors, entry.Depth, fn)
+	return err
+}
+
+// expand 获取并展开 entry 指向的嵌套列表，返回 entry 是否已处理：已展开，或因循环引用、重复而跳过
+// 返回 false 时 entry 应按普通播放地址处理
+func (e *Expander) expand(entry Entry, ancestors []string, depth int, fn func(Entry) error) (bool, error) {
+	key := playlistKey(entry.URL)
+	if containsString(ancestors, key) {
+		e.warn(0, fmt.Sprintf("嵌套播放列表存在循环引用，已跳过: %s", entry.URL))
+		return true, nil
+	}
+	if e.expanded[key] {
+		e.warn(0, fmt.Sprintf("嵌套播放列表已展开过，已跳过: %s", entry.URL))
+		return true, nil
+	}
+	if depth >= e.maxDepth {
+		e.warn(0, fmt.Sprintf("超过最大嵌套深度 %d，未展开: %s", e.maxDepth, entry.URL))
+		return false, nil
+	}
+
+	ancestors = append(ancestors[:len(ancestors):len(ancestors)], key)
+	count := 0
+	var emitErr error
+	e.expanded[key] = true
+	ok, err := e.fetch(entry, func(child Entry) error {
+		child.Source, child.Depth = entry.URL, depth+1
+		if child.Origin == "" {
+			child.Origin = entry.Origin
+		}
+		count++
+		emitErr = e.emit(child, ancestors, depth+1, fn)
+		return emitErr
+	})
+	if emitErr != nil {
+		return true, emitErr
+	}
+	if err := e.ctx.Err(); err != nil {
+		return true, err
+	}
+	if !ok {
+		// 获取失败或不是频道列表，按普通播放地址处理
+		delete(e.expanded, key)
+		if err != nil {
+			e.warn(0, fmt.Sprintf("获取嵌套播放列表失败: %v", err))
+		}
+		return false, nil
+	}
+	if err != nil {
+		e.warn(0, fmt.Sprintf("%s 未完整读取: %v", entry.URL, err))
+	}
+	fmt.Printf("展开嵌套播放列表 %s，获取到 %d 个条目\n", entry.URL, count)
+	return true, nil
+}
+
+// fetch 获取条目指向的内容，是频道列表时流式解析并将其中的条目交给 fn，返回内容是否为频道列表
+// 开始解析后出错时仍返回 true，已交给 fn 的条目保留；按条目所在播放列表的代理设置获取
+func (e *Expander) fetch(entry Entry, fn func(Entry) error) (bool, error) {
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodGet, entry.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	applyOption(req, entry.Options)
+
+	client := httpclient.New(httpclient.Options{Timeout: nestedFetchTimeout, Sources: proxySources(entry)})
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("%s: HTTP %d", entry.URL, resp.StatusCode)
+	}
+
+	r, _, err := NewUTF8Reader(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", entry.URL, err)
+	}
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, _ := br.Peek(sniffSize)
+	if !IsPlaylistContent(head) {
+		return false, nil
+	}
+
+	playlist, err := ScanReader(br, resp.Request.URL.String(), fn)
+	if playlist == nil {
+		return false, fmt.Errorf("%s: %w", entry.URL, err)
+	}
+	for _, w := range playlist.Warnings {
+		e.warn(0, fmt.Sprintf("%s 第 %d 行: %s", entry.URL, w.Line, w.Message))
+	}
+	return true, err
+}
+
+// playlistKey 用于比较播放列表地址，忽略片段
+func playlistKey(rawURL string) string {
+	if i := strings.IndexByte(rawURL, '#'); i >= 0 {
+		rawURL = rawURL[:i]
+	}
+	return rawURL
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
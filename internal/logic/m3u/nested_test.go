@@ -0,0 +1,168 @@
+package m3u
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+func TestExpander(t *testing.T) {
+	pages := map[string]string{
+		"/root.m3u": `#EXTM3U
+#EXTINF:-1 group-title="聚合",子列表
+/a.m3u
+#EXTINF:-1 group-title="直播",本地频道
+/live.m3u8
+`,
+		"/a.m3u": `#EXTM3U
+#EXTINF:-1 group-title="新闻",新闻频道
+http://example.com/news.m3u8
+#EXTINF:-1,深层列表
+/b.txt
+#EXTINF:-1,回到根列表
+/root.m3u
+`,
+		"/b.txt": "体育,#genre#\n体育频道,http://example.com/sports.m3u8\n更深,/c.m3u\n",
+		"/c.m3u": "#EXTM3U\n#EXTINF:-1,不应展开\nhttp://example.com/deep.m3u8\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	root := server.URL + "/root.m3u"
+	expander := NewExpander(context.Background(), root, 2)
+	var entries []Entry
+	playlist, err := ScanURL(context.Background(), root, expander.Wrap(func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expander.AddWarnings(playlist)
+	playlist.Entries = entries
+
+	want := []struct {
+		url    string
+		source string
+		depth  int
+	}{
+		{"http://example.com/news.m3u8", server.URL + "/a.m3u", 1},
+		{"http://example.com/sports.m3u8", server.URL + "/b.txt", 2},
+		{server.URL + "/c.m3u", server.URL + "/b.txt", 2},
+		{server.URL + "/live.m3u8", "", 0},
+	}
+	if len(playlist.Entries) != len(want) {
+		t.Fatalf("期望 %d 个条目，实际 %d 个: %+v", len(want), len(playlist.Entries), playlist.Entries)
+	}
+	for i, w := range want {
+		got := playlist.Entries[i]
+		if got.URL != w.url || got.Source != w.source || got.Depth != w.depth {
+			t.Errorf("第 %d 个条目应为 %+v，实际为 %s %s %d", i, w, got.URL, got.Source, got.Depth)
+		}
+	}
+
+	var cycle, depth bool
+	for _, w := range playlist.Warnings {
+		cycle = cycle || strings.Contains(w.Message, "循环引用")
+		depth = depth || strings.Contains(w.Message, "最大嵌套深度")
+	}
+	if !cycle || !depth {
+		t.Errorf("应产生循环引用和嵌套深度警告: %v", playlist.Warnings)
+	}
+
+	// 验证阶段不应把频道列表当作可播放的媒体流
+	if res := ValidateURL(context.Background(), server.URL+"/c.m3u", nil, time.Second); res.Valid {
+		t.Error("指向频道列表的地址不应验证通过")
+	}
+}
+
+func TestScanURL_Cancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/root.m3u" {
+			w.Write([]byte("#EXTM3U\n#EXTINF:-1,子列表\n/hang.m3u\n"))
+			return
+		}
+		// 一直不返回，直到请求被取消
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := ParseURL(ctx, server.URL+"/hang.m3u"); err == nil {
+		t.Error("取消后应返回错误")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("取消后应立即停止获取播放列表")
+	}
+
+	// 展开嵌套列表时同样可以取消
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	expander := NewExpander(ctx, server.URL+"/root.m3u", 2)
+	if _, err := ScanURL(context.Background(), server.URL+"/root.m3u", expander.Wrap(func(Entry) error { return nil })); err == nil {
+		t.Error("取消后应停止展开并返回错误")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("取消后应立即停止获取嵌套列表")
+	}
+}
+
+func TestValidateAndUnique_ExpandsByContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/agg.m3u8":
+			w.Write([]byte("#EXTM3U\n#EXTINF:-1,聚合频道\n/a.ts\n#EXTINF:-1,动态列表\n/get.php?type=m3u\n"))
+		case "/get.php":
+			w.Write([]byte("#EXTM3U\n#EXTINF:-1,动态频道\n/b.ts\n#EXTINF:-1,回到聚合列表\n/agg.m3u8\n"))
+		case "/a.ts", "/b.ts":
+			w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	entries := []Entry{{URL: server.URL + "/agg.m3u8"}}
+	result, err := ValidateAndUnique(context.Background(), nil, entries, ValidateOptions{MaxLatency: time.Second, MaxDepth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for _, entry := range result.Unique {
+		urls = append(urls, strings.TrimPrefix(entry.URL, server.URL))
+	}
+	if strings.Join(urls, " ") != "/a.ts /b.ts" && strings.Join(urls, " ") != "/b.ts /a.ts" {
+		t.Fatalf("应按内容展开 .m3u8 和动态地址返回的频道列表: %v", urls)
+	}
+	for _, entry := range result.Unique {
+		if entry.Source == "" || entry.Depth == 0 {
+			t.Errorf("展开的条目应记录所在列表: %+v", entry)
+		}
+	}
+	if len(result.Expanded) != 3 {
+		t.Errorf("应展开 3 个条目，实际 %d 个", len(result.Expanded))
+	}
+
+	// 不展开时按失败处理
+	result, err = ValidateAndUnique(context.Background(), nil, entries, ValidateOptions{MaxLatency: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unique) != 0 || len(result.Probes) != 1 || result.Probes[0].ErrorClass != types.ProbeErrorNestedList {
+		t.Errorf("不展开时应识别为嵌套列表: %+v", result.Probes)
+	}
+}
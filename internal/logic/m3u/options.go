@@ -0,0 +1,176 @@
+package m3u
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"tv-server/internal/model/types"
+)
+
+// 条目级别的选项行前缀
+const (
+	prefixVLCOpt   = "#EXTVLCOPT:"
+	prefixKodiProp = "#KODIPROP:"
+	prefixExtHTTP  = "#EXTHTTP:"
+)
+
+// DefaultUserAgent 播放地址未指定 User-Agent 时使用的默认值
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// isOptionLine 判断是否为 #EXTVLCOPT/#KODIPROP/#EXTHTTP 选项行
+func isOptionLine(line string) bool {
+	for _, prefix := range []string{prefixVLCOpt, prefixKodiProp, prefixExtHTTP} {
+		if _, ok := cutPrefixFold(line, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOptionLine 解析选项行并合并到 opt 中
+func parseOptionLine(opt *types.StreamOption, line string) error {
+	line = strings.TrimSpace(line)
+
+	if rest, ok := cutPrefixFold(line, prefixVLCOpt); ok {
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			return fmt.Errorf("无效的 #EXTVLCOPT 选项: %s", rest)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "http-user-agent":
+			opt.UserAgent = value
+		case "http-referrer", "http-referer":
+			opt.Referrer = value
+		default:
+			if opt.VLCOpts == nil {
+				opt.VLCOpts = make(map[string]string)
+			}
+			opt.VLCOpts[key] = value
+		}
+		return nil
+	}
+
+	if rest, ok := cutPrefixFold(line, prefixKodiProp); ok {
+		key, value, found := strings.Cut(rest, "=")
+		if !found {
+			return fmt.Errorf("无效的 #KODIPROP 选项: %s", rest)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if opt.KodiProps == nil {
+			opt.KodiProps = make(map[string]string)
+		}
+		opt.KodiProps[key] = value
+
+		// inputstream.adaptive 的请求头格式为 Name=Value&Name=Value
+		if strings.HasSuffix(key, ".stream_headers") || strings.HasSuffix(key, ".manifest_headers") {
+			for _, pair := range strings.Split(value, "&") {
+				name, v, found := strings.Cut(pair, "=")
+				if !found || name == "" {
+					continue
+				}
+				if decoded, err := url.QueryUnescape(v); err == nil {
+					v = decoded
+				}
+				setOptionHeader(opt, name, v)
+			}
+		}
+		return nil
+	}
+
+	if rest, ok := cutPrefixFold(line, prefixExtHTTP); ok {
+		var headers map[string]interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(rest)), &headers); err != nil {
+			return fmt.Errorf("无效的 #EXTHTTP 内容: %w", err)
+		}
+		for name, v := range headers {
+			setOptionHeader(opt, name, fmt.Sprint(v))
+		}
+		return nil
+	}
+
+	return fmt.Errorf("未知的选项行: %s", line)
+}
+
+// setOptionHeader 设置请求头，User-Agent 和 Referer 写入对应字段
+func setOptionHeader(opt *types.StreamOption, name, value string) {
+	switch http.CanonicalHeaderKey(name) {
+	case "User-Agent":
+		opt.UserAgent = value
+	case "Referer", "Referrer":
+		opt.Referrer = value
+	default:
+		if opt.Headers == nil {
+			opt.Headers = make(map[string]string)
+		}
+		opt.Headers[http.CanonicalHeaderKey(name)] = value
+	}
+}
+
+// isEmptyOption 判断选项是否没有任何内容
+func isEmptyOption(opt *types.StreamOption) bool {
+	return opt == nil || (opt.UserAgent == "" && opt.Referrer == "" &&
+		len(opt.Headers) == 0 && len(opt.VLCOpts) == 0 && len(opt.KodiProps) == 0)
+}
+
+// applyOption 将播放地址的选项应用到请求上
+func applyOption(req *http.Request, opt *types.StreamOption) {
+	req.Header.Set("User-Agent", DefaultUserAgent)
+	if opt == nil {
+		return
+	}
+	for name, value := range opt.Headers {
+		req.Header.Set(name, value)
+	}
+	if opt.UserAgent != "" {
+		req.Header.Set("User-Agent", opt.UserAgent)
+	}
+	if opt.Referrer != "" {
+		req.Header.Set("Referer", opt.Referrer)
+	}
+}
+
+// optionLines 将选项还原为 M3U 中的选项行
+func optionLines(opt *types.StreamOption) []string {
+	if isEmptyOption(opt) {
+		return nil
+	}
+
+	// 选项值中的换行会破坏播放列表的结构
+	line := lineReplacer.Replace
+
+	var lines []string
+	if opt.UserAgent != "" {
+		lines = append(lines, prefixVLCOpt+"http-user-agent="+line(opt.UserAgent))
+	}
+	if opt.Referrer != "" {
+		lines = append(lines, prefixVLCOpt+"http-referrer="+line(opt.Referrer))
+	}
+	for _, key := range sortedKeys(opt.VLCOpts) {
+		lines = append(lines, prefixVLCOpt+line(key)+"="+line(opt.VLCOpts[key]))
+	}
+	for _, key := range sortedKeys(opt.KodiProps) {
+		lines = append(lines, prefixKodiProp+line(key)+"="+line(opt.KodiProps[key]))
+	}
+	if len(opt.Headers) > 0 {
+		if data, err := json.Marshal(opt.Headers); err == nil {
+			lines = append(lines, prefixExtHTTP+string(data))
+		}
+	}
+	return lines
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
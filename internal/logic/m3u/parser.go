@@ -1,109 +1,310 @@
 package m3u
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"regexp"
 	"strings"
+	"time"
+	"tv-server/internal/model/types"
+	"tv-server/utils/httpclient"
 )
 
+// playlistFetchTimeout 获取远程播放列表的超时时间，包括读取全部内容
+const playlistFetchTimeout = 60 * time.Second
+
 type Entry struct {
-	Metadata string `json:"Metadata"`
-	URL      string `json:"URL"`
+	Metadata string              `json:"Metadata"`
+	URL      string              `json:"URL"`
+	Options  *types.StreamOption `json:"Options,omitempty"` // #EXTVLCOPT/#KODIPROP/#EXTHTTP 选项
+	Info     *ExtInf             `json:"-"`                 // 解析后的 #EXTINF 信息，为空时从 Metadata 解析
+
+	// EPGURLs 条目所属播放列表头中声明的节目单地址
+	EPGURLs []string `json:"EPGURLs,omitempty"`
+
+	// Source 条目来自嵌套播放列表时为该列表的地址，直接位于导入的播放列表中时为空
+	// Depth 为条目所在列表的嵌套深度
+	Source string `json:"Source,omitempty"`
+	Depth  int    `json:"Depth,omitempty"`
+
+	// Origin 条目所属的远程播放列表地址，用于按来源选择代理，来自上传的文件时为空
+	Origin string `json:"Origin,omitempty"`
+
+	// Probe 验证后的探测结果
+	Probe *types.ProbeResult `json:"Probe,omitempty"`
+
+	// Priority 验证的优先级，由 PrioritizeEntries 设置，数值小的先验证
+	Priority int `json:"-"`
+
+	// Unverified 为 true 表示验证器无法探测该地址的协议，条目未经验证直接保留
+	Unverified bool `json:"Unverified,omitempty"`
+}
+
+// Playlist 定义一次解析的结果
+type Playlist struct {
+	Format       Format    `json:"format"`
+	Charset      string    `json:"charset"` // 原始内容的字符集，解析前已统一转换为 UTF-8
+	Header       *Header   `json:"header,omitempty"`
+	Entries      []Entry   `json:"entries"`
+	Warnings     []Warning `json:"warnings"`
+	WarningCount int       `json:"warningCount"`
 }
 
 type ParsedEntry struct {
-	Channel string `json:"channel"`
-	Title   string `json:"title"`
-	URL     string `json:"url"`
-	Logo    string `json:"logo"`
+	Channel       string            `json:"channel"`
+	Title         string            `json:"title"`
+	URL           string            `json:"url"`
+	Logo          string            `json:"logo"`
+	Duration      float64           `json:"duration"`
+	TvgID         string            `json:"tvgId,omitempty"`
+	TvgName       string            `json:"tvgName,omitempty"`
+	TvgChno       string            `json:"tvgChno,omitempty"`
+	TvgLanguage   string            `json:"tvgLanguage,omitempty"`
+	TvgCountry    string            `json:"tvgCountry,omitempty"`
+	Radio         string            `json:"radio,omitempty"`
+	Catchup       string            `json:"catchup,omitempty"`
+	CatchupSource string            `json:"catchupSource,omitempty"`
+	CatchupDays   string            `json:"catchupDays,omitempty"`
+	Attrs         map[string]string `json:"attrs,omitempty"` // 其余未识别的属性
 }
 
+// Parse 解析字符串形式的 M3U 内容
 func Parse(content string) []Entry {
 	var entries []Entry
-	var currentMetadata string
+	scanner := NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		entries = append(entries, scanner.Entry())
+	}
+	return entries
+}
+
+// ParseReader 以流式方式解析播放列表，自动识别字符集以及 M3U、TXT、XSPF、PLS、JSON 格式，并收集带行号的警告
+// baseURL 为播放列表自身的地址，用于解析其中的相对地址，可以为空
+// 所有条目都保存在返回的 Playlist 中，很大的播放列表应使用 ScanReader
+func ParseReader(r io.Reader, baseURL string) (*Playlist, error) {
+	return parseReader(r, baseURL, "")
+}
+
+// parseReader contentType 为 HTTP 响应的 Content-Type，用于确定字符集
+func parseReader(r io.Reader, baseURL, contentType string) (*Playlist, error) {
+	return collect(func(fn func(Entry) error) (*Playlist, error) {
+		return scanReader(r, baseURL, contentType, fn)
+	})
+}
+
+// ScanReader 同 ParseReader，但每解析出一个条目就交给 fn 处理，内存占用与播放列表大小无关
+// 返回的 Playlist 不包含条目，fn 返回错误时停止解析并返回该错误
+func ScanReader(r io.Reader, baseURL string, fn func(Entry) error) (*Playlist, error) {
+	return scanReader(r, baseURL, "", fn)
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(content))
+// scanReader 同 ScanReader，contentType 见 parseReader
+func scanReader(r io.Reader, baseURL, contentType string, fn func(Entry) error) (*Playlist, error) {
+	r, charset, err := NewUTF8Reader(r, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %w", err)
+	}
+	scanner, format, err := newFormatScanner(r, baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %w", err)
+	}
+	playlist := &Playlist{Format: format, Charset: charset}
 	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#EXTM3U") {
-			entries = append(entries, Entry{Metadata: line})
-			continue
-		}
-		if strings.HasPrefix(line, "#EXTINF") {
-			currentMetadata = line
-			continue
-		}
-		if strings.HasPrefix(line, "http") {
-			entries = append(entries, Entry{
-				Metadata: currentMetadata,
-				URL:      line,
-			})
+		if err = fn(scanner.Entry()); err != nil {
+			break
 		}
 	}
-	return entries
+	// 开头都是 ASCII 时字符集在读取过程中才识别出来
+	if late, ok := r.(*lateSniffReader); ok {
+		playlist.Charset = late.Charset()
+	}
+	playlist.Header = scanner.Header()
+	playlist.Warnings = scanner.Warnings()
+	playlist.WarningCount = scanner.WarningCount()
+	if err != nil {
+		return playlist, err
+	}
+	if err := scanner.Err(); err != nil {
+		return playlist, err
+	}
+	return playlist, nil
+}
+
+// collect 调用 scan 并将所有条目保存到返回的 Playlist 中
+func collect(scan func(fn func(Entry) error) (*Playlist, error)) (*Playlist, error) {
+	var entries []Entry
+	playlist, err := scan(func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if playlist != nil {
+		playlist.Entries = entries
+	}
+	return playlist, err
 }
 
 // ParseEntry 解析 Entry 数据并返回 ParsedEntry 列表
+// 没有 #EXTINF 信息的条目（如 #EXTM3U 头）会被跳过
 func ParseEntry(entries []Entry) []ParsedEntry {
 	parsedEntries := make([]ParsedEntry, 0, len(entries))
-	// 正则表达式匹配规则
-	re := regexp.MustCompile(`#EXTINF:-1((?:\s+tvg-[^=]+="([^"]*)")*)(?:\s+group-title="([^"]+)"),([^,]+)`)
-
 	for _, entry := range entries {
-		// 使用正则表达式解析 Metadata 字段
-		matches := re.FindStringSubmatch(entry.Metadata)
-		// 仅当 matches 有足够的结果时才打印和处理
-		if len(matches) > 0 {
-			// 如果匹配结果大于 4，意味着我们可以获取到频道、标题、URL 和 Logo
-			if len(matches) >= 5 {
-				// 将解析结果存入 parsedEntries
-				parsedEntries = append(parsedEntries, ParsedEntry{
-					Channel: matches[3], // 频道名称
-					Title:   matches[4], // 标题
-					URL:     entry.URL,  // 原 URL
-					Logo:    matches[2], // Logo URL
-				})
-			}
+		if entry.URL == "" || entry.Metadata == "" {
+			continue
 		}
+
+		// 属性格式不规范时仍使用已解析出的部分
+		info := entry.Info
+		if info == nil {
+			info, _ = ParseExtInf(entry.Metadata)
+		}
+		if info == nil {
+			continue
+		}
+		parsedEntries = append(parsedEntries, newParsedEntry(info, entry.URL))
 	}
 	return parsedEntries
 }
 
+// newParsedEntry 将 ExtInf 中的已知属性拆分到对应字段，其余属性保留在 Attrs 中
+func newParsedEntry(info *ExtInf, url string) ParsedEntry {
+	attrs := make(map[string]string, len(info.Attrs))
+	for k, v := range info.Attrs {
+		attrs[k] = v
+	}
+	take := func(key string) string {
+		v := attrs[key]
+		delete(attrs, key)
+		return v
+	}
+
+	pe := ParsedEntry{
+		URL:           url,
+		Duration:      info.Duration,
+		Channel:       take(AttrGroupTitle),
+		Logo:          take(AttrTvgLogo),
+		TvgID:         take(AttrTvgID),
+		TvgName:       take(AttrTvgName),
+		TvgChno:       take(AttrTvgChno),
+		TvgLanguage:   take(AttrTvgLanguage),
+		TvgCountry:    take(AttrTvgCountry),
+		Radio:         take(AttrRadio),
+		Catchup:       take(AttrCatchup),
+		CatchupSource: take(AttrCatchupSource),
+		CatchupDays:   take(AttrCatchupDays),
+		Title:         info.Title,
+	}
+	if pe.Channel == "" {
+		pe.Channel = DefaultGroup
+	}
+	if pe.Title == "" {
+		pe.Title = pe.TvgName
+	}
+	if pe.Title == "" {
+		pe.Title = url
+	}
+	if len(attrs) > 0 {
+		pe.Attrs = attrs
+	}
+	return pe
+}
+
+// EntryFromStream 根据数据库中的媒体流信息构造 url 对应的条目
+func EntryFromStream(stream *types.MediaStream, url string) Entry {
+	attrs := make(map[string]string, len(stream.Attrs)+12)
+	for k, v := range stream.Attrs {
+		attrs[k] = v
+	}
+	set := func(key, value string) {
+		if value != "" {
+			attrs[key] = value
+		}
+	}
+	set(AttrTvgID, stream.TvgID)
+	set(AttrTvgName, stream.TvgName)
+	set(AttrTvgChno, stream.TvgChno)
+	set(AttrTvgLogo, stream.StreamLogo)
+	set(AttrTvgLanguage, stream.TvgLanguage)
+	set(AttrTvgCountry, stream.TvgCountry)
+	set(AttrGroupTitle, stream.ChannelName)
+	set(AttrRadio, stream.Radio)
+	set(AttrCatchup, stream.Catchup)
+	set(AttrCatchupSource, stream.CatchupSource)
+	set(AttrCatchupDays, stream.CatchupDays)
+
+	info := &ExtInf{Duration: -1, Attrs: attrs, Title: stream.StreamName}
+	entry := Entry{
+		Metadata: formatExtInf(info),
+		URL:      url,
+		Info:     info,
+		EPGURLs:  MergeEPGURLs(nil, stream.EpgUrl),
+	}
+	if urlInfo := stream.UrlInfo[url]; urlInfo != nil {
+		entry.Options = urlInfo.Options
+		entry.Source = urlInfo.Source
+		entry.Origin = urlInfo.Origin
+	}
+	return entry
+}
+
 // ParseFile 从文件解析M3U
-func ParseFile(filename string) ([]Entry, error) {
+func ParseFile(filename string) (*Playlist, error) {
+	return collect(func(fn func(Entry) error) (*Playlist, error) {
+		return ScanFile(filename, fn)
+	})
+}
+
+// ScanFile 以流式方式解析文件，每个条目交给 fn 处理，见 ScanReader
+func ScanFile(filename string, fn func(Entry) error) (*Playlist, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-
-	// 打印文件内容
-	fmt.Printf("文件内容:\n%s\n", string(content))
+	return ScanReader(file, "", fn)
+}
 
-	return Parse(string(content)), nil
+// ParseURL 从URL解析M3U，按该地址的代理设置获取，解析出的条目以该地址为来源
+// ctx 被取消或超过 playlistFetchTimeout 时停止获取
+func ParseURL(ctx context.Context, url string) (*Playlist, error) {
+	return collect(func(fn func(Entry) error) (*Playlist, error) {
+		return ScanURL(ctx, url, fn)
+	})
 }
 
-// ParseURL 从URL解析M3U
-func ParseURL(url string) ([]Entry, error) {
-	resp, err := http.Get(url)
+// ScanURL 以流式方式解析远程播放列表，每个条目交给 fn 处理，见 ScanReader 和 ParseURL
+func ScanURL(ctx context.Context, url string, fn func(Entry) error) (*Playlist, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	content, err := io.ReadAll(resp.Body)
+	client := httpclient.New(httpclient.Options{Timeout: playlistFetchTimeout, Sources: []string{url}})
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("获取播放列表失败: HTTP %d", resp.StatusCode)
+	}
 
-	return Parse(string(content)), nil
+	// 重定向后的最终地址作为相对地址的基准
+	return scanReader(resp.Body, resp.Request.URL.String(), resp.Header.Get("Content-Type"), func(entry Entry) error {
+		entry.Origin = url
+		return fn(entry)
+	})
+}
+
+// proxySources 返回选择代理时使用的条目来源，嵌套列表优先于顶层播放列表
+func proxySources(entry Entry) []string {
+	var sources []string
+	for _, source := range []string{entry.Source, entry.Origin} {
+		if source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources
 }
@@ -1,7 +1,16 @@
 package m3u
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"tv-server/internal/model/types"
 )
 
 func TestParseEntry_SingleEntry(t *testing.T) {
@@ -11,3 +20,254 @@ func TestParseEntry_SingleEntry(t *testing.T) {
 
 	_ = ParseEntry([]Entry{inputEntry})
 }
+
+func TestParseEntry_Attributes(t *testing.T) {
+	entries := []Entry{
+		{
+			Metadata: `#EXTINF:0 group-title="新闻" tvg-chno="13" tvg-id="cctv13" radio="false" catchup="append" catchup-days="7" catchup-source="?playseek={utc}" x-custom="a,b",CCTV-13 新闻`,
+			URL:      "http://example.com/cctv13.m3u8",
+		},
+		{
+			Metadata: `#EXTINF:-1,无分组频道`,
+			URL:      "http://example.com/nogroup.m3u8",
+		},
+		{
+			Metadata: "#EXTM3U",
+		},
+	}
+
+	parsed := ParseEntry(entries)
+	if len(parsed) != 2 {
+		t.Fatalf("期望解析出 2 个条目，实际 %d 个", len(parsed))
+	}
+
+	first := parsed[0]
+	if first.Title != "CCTV-13 新闻" || first.Channel != "新闻" || first.Duration != 0 {
+		t.Errorf("标题/分组/时长解析错误: %+v", first)
+	}
+	if first.TvgID != "cctv13" || first.TvgChno != "13" || first.Radio != "false" {
+		t.Errorf("tvg 属性解析错误: %+v", first)
+	}
+	if first.Catchup != "append" || first.CatchupDays != "7" || first.CatchupSource != "?playseek={utc}" {
+		t.Errorf("回看属性解析错误: %+v", first)
+	}
+	if first.Attrs["x-custom"] != "a,b" || len(first.Attrs) != 1 {
+		t.Errorf("未知属性解析错误: %v", first.Attrs)
+	}
+
+	if parsed[1].Channel != DefaultGroup || parsed[1].Title != "无分组频道" {
+		t.Errorf("无分组条目解析错误: %+v", parsed[1])
+	}
+}
+
+func TestParseAttributes_Malformed(t *testing.T) {
+	attrs, err := ParseAttributes(`tvg-id="a" broken tvg-name="unterminated`)
+	if err == nil {
+		t.Fatal("期望返回格式错误")
+	}
+	if attrs["tvg-id"] != "a" || attrs["tvg-name"] != "unterminated" {
+		t.Errorf("应保留可解析的属性: %v", attrs)
+	}
+}
+
+func TestParse_EntryOptions(t *testing.T) {
+	content := `#EXTM3U
+#EXTINF:-1 group-title="体育",体育频道
+#EXTVLCOPT:http-user-agent=AptvPlayer/1.0
+#EXTVLCOPT:http-referrer=http://example.com/
+#EXTVLCOPT:network-caching=1000
+#EXTHTTP:{"cookie":"token=abc"}
+http://example.com/sports.m3u8
+#EXTINF:-1 group-title="体育",无选项频道
+http://example.com/plain.m3u8
+`
+	entries := Parse(content)
+	if len(entries) != 2 {
+		t.Fatalf("期望 2 个条目，实际 %d 个", len(entries))
+	}
+
+	opt := entries[0].Options
+	if opt == nil {
+		t.Fatal("选项未解析")
+	}
+	if opt.UserAgent != "AptvPlayer/1.0" || opt.Referrer != "http://example.com/" {
+		t.Errorf("UA/Referer 解析错误: %+v", opt)
+	}
+	if opt.VLCOpts["network-caching"] != "1000" || opt.Headers["Cookie"] != "token=abc" {
+		t.Errorf("其余选项解析错误: %+v", opt)
+	}
+	if entries[1].Options != nil {
+		t.Errorf("选项不应延续到下一个条目: %+v", entries[1].Options)
+	}
+}
+
+func TestValidateURL_SendsOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != "AptvPlayer/1.0" || r.Referer() != "http://example.com/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	opt := &types.StreamOption{UserAgent: "AptvPlayer/1.0", Referrer: "http://example.com/"}
+	if res := ValidateURL(context.Background(), server.URL, opt, time.Second); !res.Valid {
+		t.Errorf("携带选项的请求应验证通过: %s", res.Error)
+	}
+	if res := ValidateURL(context.Background(), server.URL, nil, time.Second); res.Valid {
+		t.Error("缺少选项的请求不应验证通过")
+	}
+}
+
+func TestParseReader_Warnings(t *testing.T) {
+	content := `#EXTM3U
+#EXTINF:-1 group-title="新闻",孤立条目
+#EXTINF:-1 tvg-name="未闭合,频道
+http://example.com/a.m3u8
+http://example.com/b.m3u8
+#EXTINF:-1,结尾条目
+`
+	playlist, err := ParseReader(strings.NewReader(content), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlist.Entries) != 2 {
+		t.Fatalf("期望 2 个条目，实际 %d 个", len(playlist.Entries))
+	}
+	if playlist.Entries[1].Metadata != "" {
+		t.Errorf("元数据不应延续到下一个地址: %q", playlist.Entries[1].Metadata)
+	}
+
+	wantLines := []int{2, 3, 5, 6}
+	if len(playlist.Warnings) != len(wantLines) {
+		t.Fatalf("期望 %d 条警告，实际: %v", len(wantLines), playlist.Warnings)
+	}
+	for i, line := range wantLines {
+		if playlist.Warnings[i].Line != line {
+			t.Errorf("第 %d 条警告行号应为 %d，实际为 %v", i, line, playlist.Warnings[i])
+		}
+	}
+}
+
+func TestScanReader_Stop(t *testing.T) {
+	content := "#EXTM3U\n#EXTINF:-1,一\nhttp://a/1\n#EXTINF:-1,二\nhttp://a/2\n#EXTINF:-1,三\nhttp://a/3\n"
+	stop := errors.New("stop")
+	var urls []string
+	playlist, err := ScanReader(strings.NewReader(content), "", func(entry Entry) error {
+		urls = append(urls, entry.URL)
+		if len(urls) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(urls) != 2 {
+		t.Fatalf("fn 返回错误后应停止解析: %v, %v", urls, err)
+	}
+	if playlist == nil || playlist.Header == nil || len(playlist.Entries) != 0 {
+		t.Errorf("返回的 Playlist 应包含头信息但不包含条目: %+v", playlist)
+	}
+}
+
+func TestParseReader_SchemesAndRelative(t *testing.T) {
+	content := `#EXTM3U
+#EXTINF:-1,RTMP
+RTMP://live.example.com/app/stream
+#EXTINF:-1,RTP
+rtp://239.1.1.1:5000
+#EXTINF:-1,相对地址
+live/channel.m3u8
+#EXTINF:-1,根路径
+/hls/other.m3u8
+`
+	playlist, err := ParseReader(strings.NewReader(content), "http://example.com/lists/tv.m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"rtmp://live.example.com/app/stream",
+		"rtp://239.1.1.1:5000",
+		"http://example.com/lists/live/channel.m3u8",
+		"http://example.com/hls/other.m3u8",
+	}
+	if len(playlist.Entries) != len(want) {
+		t.Fatalf("期望 %d 个条目，实际 %d 个", len(want), len(playlist.Entries))
+	}
+	for i, url := range want {
+		if playlist.Entries[i].URL != url {
+			t.Errorf("第 %d 个地址应为 %s，实际为 %s", i, url, playlist.Entries[i].URL)
+		}
+	}
+
+	// 没有基准地址时，相对地址被跳过并给出警告
+	playlist, _ = ParseReader(strings.NewReader(content), "")
+	if len(playlist.Entries) != 2 || playlist.WarningCount != 2 {
+		t.Errorf("无基准地址时应跳过相对地址: entries=%d warnings=%v", len(playlist.Entries), playlist.Warnings)
+	}
+}
+
+func TestValidateAndUnique_UnsupportedScheme(t *testing.T) {
+	entries := []Entry{{Metadata: "#EXTINF:-1,RTSP", URL: "rtsp://example.com/live"}}
+	result, err := ValidateAndUnique(context.Background(), nil, entries, ValidateOptions{MaxLatency: time.Second, Workers: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unique) != 1 || !result.Unique[0].Unverified {
+		t.Errorf("不支持探测的地址应被标记并保留: %+v", result.Unique)
+	}
+	if len(result.Probes) != 0 {
+		t.Errorf("未探测的地址不应有探测结果: %+v", result.Probes)
+	}
+}
+
+func TestParseReader_HeaderDefaults(t *testing.T) {
+	content := `#EXTM3U x-tvg-url="http://epg.example.com/a.xml,http://epg.example.com/b.xml" url-tvg="http://epg.example.com/a.xml" tvg-shift="8" catchup="default" catchup-days="3"
+#EXTINF:-1 group-title="新闻",使用默认值
+http://example.com/a.m3u8
+#EXTINF:-1 group-title="新闻" catchup-days="7",覆盖默认值
+http://example.com/b.m3u8
+`
+	playlist, err := ParseReader(strings.NewReader(content), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Header == nil || len(playlist.Header.EPGURLs) != 2 {
+		t.Fatalf("节目单地址解析错误: %+v", playlist.Header)
+	}
+
+	parsed := ParseEntry(playlist.Entries)
+	if parsed[0].Catchup != "default" || parsed[0].CatchupDays != "3" || parsed[0].Attrs["tvg-shift"] != "8" {
+		t.Errorf("默认属性未生效: %+v", parsed[0])
+	}
+	if parsed[1].CatchupDays != "7" {
+		t.Errorf("条目属性应覆盖默认值: %+v", parsed[1])
+	}
+	if len(playlist.Entries[0].EPGURLs) != 2 {
+		t.Errorf("条目应记录节目单地址: %v", playlist.Entries[0].EPGURLs)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, playlist.Entries); err != nil {
+		t.Fatal(err)
+	}
+	header, _, _ := strings.Cut(buf.String(), "\n")
+	if header != `#EXTM3U x-tvg-url="http://epg.example.com/a.xml,http://epg.example.com/b.xml"` {
+		t.Errorf("输出的头信息不符合预期: %s", header)
+	}
+}
+
+func TestParseReader_LowercaseDirectives(t *testing.T) {
+	content := "#extm3u catchup=\"default\"\n#extinf:-1 group-title=\"新闻\",小写条目\nhttp://example.com/a.m3u8\n"
+	playlist, err := ParseReader(strings.NewReader(content), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Header == nil || len(playlist.Entries) != 1 || playlist.WarningCount != 0 {
+		t.Fatalf("小写的指令应正常解析: %+v", playlist)
+	}
+	parsed := ParseEntry(playlist.Entries)
+	if len(parsed) != 1 || parsed[0].Title != "小写条目" || parsed[0].Channel != "新闻" || parsed[0].Catchup != "default" {
+		t.Errorf("元数据不符合预期: %+v", parsed)
+	}
+}
@@ -0,0 +1,388 @@
+package m3u
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"syscall"
+	"time"
+
+	"tv-server/internal/model/types"
+	"tv-server/utils/httpclient"
+)
+
+const (
+	// maxPlaylistSize HLS 播放列表最多读取的长度
+	maxPlaylistSize = 1024 * 1024
+	// segmentReadSize 分片或媒体流最多读取的长度，用于测量下载速度
+	segmentReadSize = 512 * 1024
+	// maxStaleWait 检查直播列表是否更新时最多等待的时间
+	maxStaleWait = 10 * time.Second
+	// defaultTargetDuration 直播列表未声明分片时长时使用的默认值
+	defaultTargetDuration = 6 * time.Second
+	// defaultSampleTime 未设置超时时间时测量下载速度的最长时间
+	defaultSampleTime = time.Second
+)
+
+// probeError 带有失败分类的探测错误
+type probeError struct {
+	class string
+	err   error
+}
+
+func (e *probeError) Error() string { return e.err.Error() }
+func (e *probeError) Unwrap() error { return e.err }
+
+// badContent 返回内容不是可播放媒体流的错误
+func badContent(format string, args ...interface{}) error {
+	return &probeError{class: types.ProbeErrorBadContent, err: fmt.Errorf(format, args...)}
+}
+
+// statusError 服务器返回了非 2xx 状态码
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string { return fmt.Sprintf("HTTP %d", e.code) }
+
+// classifyError 判断探测失败的原因
+func classifyError(err error) string {
+	var pe *probeError
+	if errors.As(err, &pe) {
+		return pe.class
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		switch {
+		case se.code >= 400 && se.code < 500:
+			return types.ProbeErrorHTTP4xx
+		case se.code >= 500:
+			return types.ProbeErrorHTTP5xx
+		}
+		return types.ProbeErrorOther
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return types.ProbeErrorDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return types.ProbeErrorRefused
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return types.ProbeErrorTimeout
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return types.ProbeErrorReset
+	}
+	return types.ProbeErrorOther
+}
+
+// isTransient 判断失败是否可能是暂时的，只有这类失败才值得重试
+func isTransient(class string) bool {
+	switch class {
+	case types.ProbeErrorTimeout, types.ProbeErrorReset, types.ProbeErrorHTTP5xx:
+		return true
+	}
+	return false
+}
+
+// prober 探测单个播放地址，一次探测中的请求共用同一个 client、请求选项和 ctx
+type prober struct {
+	ctx        context.Context
+	client     *http.Client
+	opt        *types.StreamOption
+	maxLatency time.Duration // 单个地址的最大延迟，组播地址在该时间内等待第一个数据包
+	sampleTime time.Duration // 测量下载速度的最长时间
+	skipStale  bool          // 不检查直播列表是否更新
+
+	start  time.Time
+	result *types.ProbeResult
+}
+
+// newProber 创建探测器，使用 opts 中的最大延迟和是否检查直播列表更新
+// sources 为地址所属的播放列表，用于选择代理，dns 为 nil 时不缓存解析结果
+func newProber(ctx context.Context, opt *types.StreamOption, opts ValidateOptions, sources []string, dns *httpclient.DNSCache) *prober {
+	maxLatency := opts.MaxLatency
+	sampleTime := maxLatency
+	if sampleTime <= 0 {
+		sampleTime = defaultSampleTime
+	}
+	return &prober{
+		ctx: ctx,
+		client: httpclient.New(httpclient.Options{
+			Timeout:               maxLatency * 2,
+			ResponseHeaderTimeout: maxLatency * 2,
+			DisableKeepAlives:     true,
+			Sources:               sources,
+			DNS:                   dns,
+		}),
+		opt:        opt,
+		maxLatency: maxLatency,
+		sampleTime: sampleTime,
+		skipStale:  opts.SkipStaleCheck,
+	}
+}
+
+// staleBudget 返回检查直播列表是否更新时最多等待的时间，与单个请求的超时时间相同，为最大延迟的两倍
+// 单独计算，不占用获取列表和分片的时间，否则默认设置下大多数直播列表都来不及检查；未设置最大延迟时为 maxStaleWait
+func (p *prober) staleBudget() time.Duration {
+	if p.maxLatency <= 0 {
+		return maxStaleWait
+	}
+	return p.maxLatency * 2
+}
+
+// run 探测 rawURL 并返回结果
+func (p *prober) run(rawURL string) *types.ProbeResult {
+	p.start = time.Now()
+	p.result = &types.ProbeResult{URL: rawURL, ProbedAt: p.start.Unix()}
+
+	var err error
+	if isMulticastURL(rawURL) {
+		err = p.probeMulticast(rawURL)
+	} else {
+		err = p.probe(rawURL)
+	}
+	if p.result.Latency == 0 {
+		p.result.Latency = time.Since(p.start).Milliseconds()
+	}
+	if err != nil {
+		p.result.Error = err.Error()
+		p.result.ErrorClass = classifyError(err)
+		return p.result
+	}
+	p.result.Valid = true
+	return p.result
+}
+
+// get 发送带请求选项的 GET 请求
+func (p *prober) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	applyOption(req, p.opt)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %w", err)
+	}
+	return resp, nil
+}
+
+// fetch 发送请求，非 2xx 状态码视为错误
+func (p *prober) fetch(rawURL string) (*http.Response, error) {
+	resp, err := p.get(p.ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// probe 请求地址，并根据返回的内容选择探测方式
+func (p *prober) probe(rawURL string) error {
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() {
+			p.result.TTFB = time.Since(p.start).Milliseconds()
+		},
+	}
+	resp, err := p.get(httptrace.WithClientTrace(p.ctx, trace), rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	p.result.StatusCode = resp.StatusCode
+	p.result.FinalURL = resp.Request.URL.String()
+	p.result.ContentType = resp.Header.Get("Content-Type")
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode}
+	}
+
+	received := time.Now()
+	br := bufio.NewReaderSize(resp.Body, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return fmt.Errorf("读取内容失败: %w", err)
+	}
+
+	switch {
+	case len(head) == 0:
+		return badContent("内容为空")
+	case IsPlaylistContent(head):
+		// 指向频道列表的地址返回 200 且有内容，但不是可播放的媒体流，由验证过程展开
+		return &probeError{class: types.ProbeErrorNestedList, err: errors.New("地址指向嵌套的频道列表")}
+	case isHLSContent(head):
+		data, err := io.ReadAll(io.LimitReader(br, maxPlaylistSize))
+		if err != nil {
+			return fmt.Errorf("读取播放列表失败: %w", err)
+		}
+		p.result.Container = types.ContainerHLS
+		return p.probeHLS(resp.Request.URL, data)
+	}
+
+	// 直接返回媒体数据的地址，识别封装格式后读取一段数据测量下载速度
+	sniffer, err := sniffMedia(head)
+	if err != nil {
+		return err
+	}
+	n, _ := readSample(sniffer.reader(br), segmentReadSize, p.sampleTime)
+	p.result.Throughput = throughput(n, time.Since(received))
+	sniffer.apply(p.result)
+	return nil
+}
+
+// probeHLS 主播放列表选择第一个码率，再获取媒体播放列表并下载第一个分片
+func (p *prober) probeHLS(base *url.URL, data []byte) error {
+	playlist, err := ParseHLS(data, base)
+	if err != nil {
+		return badContent("%v", err)
+	}
+
+	mediaURL := base.String()
+	if playlist.IsMaster() {
+		variant := playlist.Variants[0]
+		p.result.Bandwidth = variant.Bandwidth
+		p.result.Resolution = variant.Resolution
+		p.result.Codecs = variant.Codecs
+
+		mediaURL = variant.URI
+		if playlist, err = p.fetchHLS(mediaURL); err != nil {
+			return fmt.Errorf("获取码率播放列表失败: %w", err)
+		}
+		if playlist.IsMaster() {
+			return badContent("码率播放列表仍是主播放列表")
+		}
+	}
+	if len(playlist.Segments) == 0 {
+		return badContent("播放列表中没有分片")
+	}
+	p.result.Live = playlist.IsLive()
+
+	fetchedAt := time.Now()
+	if err := p.fetchSegment(playlist.Segments[0]); err != nil {
+		return fmt.Errorf("下载分片失败: %w", err)
+	}
+	p.result.Latency = time.Since(p.start).Milliseconds()
+
+	if !playlist.IsLive() {
+		return nil
+	}
+	if p.skipStale {
+		p.result.StaleUnchecked = true
+		return nil
+	}
+
+	// 直播列表至少每个分片时长更新一次，等待后重新获取，序号不变说明源已停止更新
+	// 等待时间不能超过 staleBudget，不够等待一个分片时长时无法判断，不做检查并在结果中注明
+	wait := defaultTargetDuration
+	if playlist.TargetDuration > 0 {
+		wait = time.Duration(playlist.TargetDuration * float64(time.Second))
+	}
+	wait = min(wait, maxStaleWait) - time.Since(fetchedAt)
+	if wait > p.staleBudget() {
+		p.result.StaleUnchecked = true
+		return nil
+	}
+	select {
+	case <-time.After(wait):
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+
+	next, err := p.fetchHLS(mediaURL)
+	if err != nil {
+		return fmt.Errorf("重新获取播放列表失败: %w", err)
+	}
+	if !next.advancedFrom(playlist) {
+		p.result.Stale = true
+		return badContent("直播播放列表未更新")
+	}
+	return nil
+}
+
+// fetchHLS 获取并解析 HLS 播放列表
+func (p *prober) fetchHLS(rawURL string) (*HLSPlaylist, error) {
+	resp, err := p.fetch(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize))
+	if err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %w", err)
+	}
+	if !isHLSContent(data) {
+		return nil, badContent("不是 HLS 播放列表")
+	}
+	playlist, err := ParseHLS(data, resp.Request.URL)
+	if err != nil {
+		return nil, badContent("%v", err)
+	}
+	return playlist, nil
+}
+
+// fetchSegment 下载分片的开头部分，确认其为媒体数据并测量下载速度和识别编码
+func (p *prober) fetchSegment(rawURL string) error {
+	resp, err := p.fetch(rawURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	received := time.Now()
+	br := bufio.NewReaderSize(resp.Body, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return fmt.Errorf("读取分片失败: %w", err)
+	}
+	sniffer, err := sniffMedia(head)
+	if err != nil {
+		return err
+	}
+	n, _ := readSample(sniffer.reader(br), segmentReadSize, p.sampleTime)
+	p.result.Throughput = throughput(n, time.Since(received))
+	sniffer.apply(p.result)
+	return nil
+}
+
+// readSample 最多读取 limit 字节或持续 maxTime，返回读取的字节数
+// 读取到部分数据后出错（如超时、流被关闭）不视为失败
+func readSample(r io.Reader, limit int64, maxTime time.Duration) (int64, error) {
+	start := time.Now()
+	buf := make([]byte, 32*1024)
+	var n int64
+	for n < limit && time.Since(start) < maxTime {
+		m, err := r.Read(buf)
+		n += int64(m)
+		if err != nil {
+			if err == io.EOF || n > 0 {
+				return n, nil
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// throughput 计算下载速度，单位 kbps
+func throughput(n int64, elapsed time.Duration) int64 {
+	ms := elapsed.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	return n * 8 / ms
+}
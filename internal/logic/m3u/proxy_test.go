@@ -0,0 +1,133 @@
+package m3u
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"tv-server/utils/core"
+	"tv-server/utils/httpclient"
+)
+
+// serveSOCKS5 运行一个只支持无认证 CONNECT 的 SOCKS5 代理，所有连接都转发到 backend，返回请求的目标地址
+func serveSOCKS5(t *testing.T, backend string) (addr string, targets func() []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	var requested []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 262)
+				// 协商认证方式
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				io.ReadFull(conn, buf[:buf[1]])
+				conn.Write([]byte{0x05, 0x00})
+
+				// CONNECT 请求，只处理域名地址
+				if _, err := io.ReadFull(conn, buf[:5]); err != nil || buf[3] != 0x03 {
+					return
+				}
+				host := make([]byte, buf[4])
+				io.ReadFull(conn, host)
+				io.ReadFull(conn, buf[:2])
+				mu.Lock()
+				requested = append(requested, fmt.Sprintf("%s:%d", host, binary.BigEndian.Uint16(buf[:2])))
+				mu.Unlock()
+
+				upstream, err := net.Dial("tcp", backend)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+				go io.Copy(upstream, conn)
+				io.Copy(conn, upstream)
+			}(conn)
+		}
+	}()
+
+	return ln.Addr().String(), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestProxy_SourceAndHostRules(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/list.m3u" {
+			fmt.Fprint(w, "#EXTM3U\n#EXTINF:-1,A\nhttp://stream.test/a.ts\n#EXTINF:-1,B\nhttp://b.socks.test/b.ts\n")
+			return
+		}
+		w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+	})
+	backend := httptest.NewServer(handler)
+	defer backend.Close()
+
+	// HTTP 代理收到的是完整的目标地址，直接由同一个 handler 处理
+	var mu sync.Mutex
+	var viaHTTP []string
+	httpProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		viaHTTP = append(viaHTTP, r.Host)
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	defer httpProxy.Close()
+	socksAddr, viaSOCKS := serveSOCKS5(t, backend.Listener.Addr().String())
+
+	if err := httpclient.Configure(core.ProxyConfig{
+		Hosts:   []core.ProxyRule{{Match: "*.socks.test", Proxy: "socks5h://" + socksAddr}},
+		Sources: []core.ProxyRule{{Match: "source.test", Proxy: httpProxy.URL}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer httpclient.Configure(core.ProxyConfig{})
+
+	// 播放列表和其中的地址按来源使用 HTTP 代理，主机规则优先于来源规则
+	playlist, err := ParseURL(context.Background(), "http://source.test/list.m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlist.Entries) != 2 || playlist.Entries[0].Origin != "http://source.test/list.m3u" {
+		t.Fatalf("解析结果不符合预期: %+v", playlist.Entries)
+	}
+	result, err := ValidateAndUnique(context.Background(), nil, playlist.Entries, ValidateOptions{MaxLatency: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unique) != 2 {
+		t.Errorf("通过代理的地址应验证通过: %+v", result.Probes)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(viaHTTP) != "[source.test stream.test]" {
+		t.Errorf("经过 HTTP 代理的请求不符合预期: %v", viaHTTP)
+	}
+	if got := viaSOCKS(); fmt.Sprint(got) != "[b.socks.test:80]" {
+		t.Errorf("经过 SOCKS5 代理的请求不符合预期: %v", got)
+	}
+
+	if err := httpclient.Configure(core.ProxyConfig{URL: "ftp://proxy"}); err == nil {
+		t.Error("不支持的代理协议应返回错误")
+	}
+}
@@ -0,0 +1,188 @@
+package m3u
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"tv-server/internal/model/types"
+)
+
+const (
+	// MaxWarnings 单次解析最多保留的警告条数，超出部分只计数
+	MaxWarnings = 1000
+	// maxLineSize 单行允许的最大长度
+	maxLineSize = 1024 * 1024
+)
+
+// Warning 定义解析过程中的警告信息，Line 为 0 表示警告不对应具体的行
+type Warning struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string {
+	if w.Line == 0 {
+		return w.Message
+	}
+	return fmt.Sprintf("第 %d 行: %s", w.Line, w.Message)
+}
+
+// Scanner 以流式方式逐条读取 M3U 条目，内存占用与文件大小无关
+type Scanner struct {
+	sc   *bufio.Scanner
+	line int
+	base *url.URL // 用于解析相对地址
+
+	entry Entry
+	err   error
+
+	// 当前条目已读取到的信息
+	metadata     string
+	metadataLine int
+	info         *ExtInf
+	options      *types.StreamOption
+
+	header *Header
+	warningList
+}
+
+// NewScanner 创建读取 r 的 Scanner
+func NewScanner(r io.Reader) *Scanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &Scanner{sc: sc}
+}
+
+// SetBaseURL 设置播放列表自身的地址，列表中的相对地址将基于它解析
+func (s *Scanner) SetBaseURL(base string) error {
+	if base == "" {
+		s.base = nil
+		return nil
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	s.base = u
+	return nil
+}
+
+// Scan 读取下一个条目，没有更多条目或出错时返回 false
+func (s *Scanner) Scan() bool {
+	for s.sc.Scan() {
+		s.line++
+		line := strings.TrimSpace(s.sc.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case hasPrefixFold(line, "#EXTM3U"):
+			// 合并多个播放列表时可能出现多个头，只使用第一个
+			if s.header == nil {
+				header, err := ParseHeader(line)
+				if err != nil {
+					s.warn(s.line, err.Error())
+				}
+				s.header = header
+			}
+		case hasPrefixFold(line, "#EXTINF"):
+			if s.metadata != "" {
+				s.warn(s.metadataLine, "#EXTINF 之后缺少播放地址")
+			}
+			info, err := ParseExtInf(line)
+			if err != nil {
+				s.warn(s.line, err.Error())
+			}
+			s.metadata, s.metadataLine, s.info = line, s.line, info
+		case isOptionLine(line):
+			if s.options == nil {
+				s.options = &types.StreamOption{}
+			}
+			if err := parseOptionLine(s.options, line); err != nil {
+				s.warn(s.line, err.Error())
+			}
+		case strings.HasPrefix(line, "#"):
+			// 其余注释或不支持的指令
+		default:
+			streamURL, err := resolveStreamURL(line, s.base)
+			if err != nil {
+				s.warn(s.line, fmt.Sprintf("%v，已跳过: %s", err, truncate(line, 80)))
+				s.metadata, s.metadataLine, s.info, s.options = "", 0, nil, nil
+				continue
+			}
+			if s.metadata == "" {
+				s.warn(s.line, "播放地址缺少 #EXTINF 信息")
+			}
+			s.entry = Entry{
+				Metadata: s.metadata,
+				URL:      streamURL,
+				Options:  s.options,
+				Info:     s.info,
+			}
+			s.header.apply(&s.entry)
+			// 元数据和选项只作用于紧随其后的一个地址
+			s.metadata, s.metadataLine, s.info, s.options = "", 0, nil, nil
+			return true
+		}
+	}
+
+	if s.metadata != "" {
+		s.warn(s.metadataLine, "#EXTINF 之后缺少播放地址")
+		s.metadata = ""
+	}
+	s.err = s.sc.Err()
+	if s.err == bufio.ErrTooLong {
+		s.err = fmt.Errorf("第 %d 行超出最大长度 %d 字节", s.line+1, maxLineSize)
+	}
+	return false
+}
+
+// Entry 返回最近一次 Scan 读取到的条目
+func (s *Scanner) Entry() Entry {
+	return s.entry
+}
+
+// Header 返回 #EXTM3U 头信息，没有头时返回 nil
+func (s *Scanner) Header() *Header {
+	return s.header
+}
+
+// Err 返回读取过程中遇到的错误
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// warningList 收集解析警告，供各格式的解析器复用
+type warningList struct {
+	warnings     []Warning
+	warningCount int
+}
+
+// Warnings 返回解析过程中产生的警告，最多保留 MaxWarnings 条
+func (l *warningList) Warnings() []Warning {
+	return l.warnings
+}
+
+// WarningCount 返回警告总数，包括未保留的部分
+func (l *warningList) WarningCount() int {
+	return l.warningCount
+}
+
+func (l *warningList) warn(line int, message string) {
+	l.warningCount++
+	if len(l.warnings) < MaxWarnings {
+		l.warnings = append(l.warnings, Warning{Line: line, Message: message})
+	}
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
@@ -0,0 +1,111 @@
+package m3u
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+// QuietHours 每天不进行后台验证的时间段，按本地时间计算，End 早于 Start 时跨越午夜
+type QuietHours struct {
+	Start time.Duration // 距零点的时间
+	End   time.Duration
+}
+
+// ParseQuietHours 解析 "HH:MM-HH:MM" 格式的时间段，空字符串返回 nil
+func ParseQuietHours(s string) (*QuietHours, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("时间段格式应为 HH:MM-HH:MM: %s", s)
+	}
+	var q QuietHours
+	var err error
+	if q.Start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if q.End, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// parseClock 解析 HH:MM，返回距零点的时间
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间 %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains 判断 t 是否在时间段内，q 为 nil 或起止相同时不包含任何时间
+func (q *QuietHours) Contains(t time.Time) bool {
+	if q == nil || q.Start == q.End {
+		return false
+	}
+	clock := sinceMidnight(t)
+	if q.Start < q.End {
+		return clock >= q.Start && clock < q.End
+	}
+	return clock >= q.Start || clock < q.End
+}
+
+// Remaining 返回 t 到时间段结束的时长，不在时间段内时返回 0
+func (q *QuietHours) Remaining(t time.Time) time.Duration {
+	if !q.Contains(t) {
+		return 0
+	}
+	remaining := q.End - sinceMidnight(t)
+	if remaining <= 0 {
+		remaining += 24 * time.Hour
+	}
+	return remaining
+}
+
+// sinceMidnight 返回 t 距当天零点的时间
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+}
+
+// PrioritizeEntries 按后台验证的优先级排序条目：收藏的地址最先，其次是 window 内最近一次验证失败的地址，
+// 同一优先级内上次探测越早越靠前，从未探测过的地址排在最前
+// favorites 和 last 的 key 为播放地址，last 为各地址最近一次的探测结果
+// 返回的条目记录所属的优先级，批量验证时只在同一优先级内按主机轮流排列，不打乱优先级的顺序
+func PrioritizeEntries(entries []Entry, favorites map[string]bool, last map[string]*types.ProbeResult, now time.Time, window time.Duration) []Entry {
+	tier := func(entry Entry) int {
+		if favorites[entry.URL] {
+			return 0
+		}
+		if probe := last[entry.URL]; probe != nil && !probe.Valid && now.Sub(time.Unix(probe.ProbedAt, 0)) <= window {
+			return 1
+		}
+		return 2
+	}
+	probedAt := func(entry Entry) int64 {
+		if probe := last[entry.URL]; probe != nil {
+			return probe.ProbedAt
+		}
+		return 0
+	}
+
+	sorted := make([]Entry, len(entries))
+	copy(sorted, entries)
+	for i := range sorted {
+		sorted[i].Priority = tier(sorted[i])
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, tj := sorted[i].Priority, sorted[j].Priority
+		if ti != tj {
+			return ti < tj
+		}
+		return probedAt(sorted[i]) < probedAt(sorted[j])
+	})
+	return sorted
+}
@@ -0,0 +1,76 @@
+package m3u
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+func TestQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.ParseInLocation("15:04", clock, time.Local)
+		return time.Date(2024, 1, 1, tm.Hour(), tm.Minute(), 0, 0, time.Local)
+	}
+
+	q, err := ParseQuietHours("23:30-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for clock, want := range map[string]bool{"23:29": false, "23:30": true, "02:00": true, "05:59": true, "06:00": false, "12:00": false} {
+		if got := q.Contains(at(clock)); got != want {
+			t.Errorf("%s 是否在静默时段: got %v, want %v", clock, got, want)
+		}
+	}
+	if got := q.Remaining(at("23:30")); got != 6*time.Hour+30*time.Minute {
+		t.Errorf("跨越午夜的剩余时间不符合预期: %v", got)
+	}
+	if got := q.Remaining(at("12:00")); got != 0 {
+		t.Errorf("不在静默时段时剩余时间应为 0: %v", got)
+	}
+
+	q, _ = ParseQuietHours("01:00-05:00")
+	if !q.Contains(at("01:00")) || q.Contains(at("05:00")) || q.Remaining(at("04:00")) != time.Hour {
+		t.Error("当天内的静默时段判断不符合预期")
+	}
+
+	if q, err := ParseQuietHours(""); q != nil || err != nil || q.Contains(at("02:00")) {
+		t.Error("未配置时不应有静默时段")
+	}
+	for _, s := range []string{"01:00", "25:00-06:00", "1:00-x"} {
+		if _, err := ParseQuietHours(s); err == nil {
+			t.Errorf("%q 应解析失败", s)
+		}
+	}
+}
+
+func TestPrioritizeEntries(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{URL: "http://a/old"}, {URL: "http://a/recent-fail"}, {URL: "http://a/fav"},
+		{URL: "http://a/never"}, {URL: "http://a/stale-fail"}, {URL: "http://a/newest"},
+	}
+	last := map[string]*types.ProbeResult{
+		"http://a/old":         {Valid: true, ProbedAt: now.Add(-48 * time.Hour).Unix()},
+		"http://a/recent-fail": {Valid: false, ProbedAt: now.Add(-time.Hour).Unix()},
+		"http://a/fav":         {Valid: true, ProbedAt: now.Unix()},
+		"http://a/stale-fail":  {Valid: false, ProbedAt: now.Add(-72 * time.Hour).Unix()},
+		"http://a/newest":      {Valid: true, ProbedAt: now.Unix()},
+	}
+	favorites := map[string]bool{"http://a/fav": true}
+
+	var urls []string
+	var priorities []int
+	for _, entry := range PrioritizeEntries(entries, favorites, last, now, 24*time.Hour) {
+		urls = append(urls, strings.TrimPrefix(entry.URL, "http://a/"))
+		priorities = append(priorities, entry.Priority)
+	}
+	want := "fav recent-fail never stale-fail old newest"
+	if got := strings.Join(urls, " "); got != want {
+		t.Errorf("验证顺序不符合预期:\n got: %s\nwant: %s", got, want)
+	}
+	if fmt.Sprint(priorities) != "[0 1 2 2 2 2]" {
+		t.Errorf("优先级不符合预期: %v", priorities)
+	}
+}
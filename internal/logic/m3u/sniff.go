@@ -0,0 +1,411 @@
+package m3u
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"tv-server/internal/model/types"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	// m2tsPacketSize 蓝光等使用的 M2TS 格式，每个包前有 4 字节时间码
+	m2tsPacketSize = 192
+	// tsMaxParseSize 查找 PAT/PMT 时最多解析的长度，超过后不再解析
+	tsMaxParseSize = 1024 * 1024
+)
+
+// mediaSniffer 根据内容开头识别媒体流的封装格式，MPEG-TS 在读取样本时继续解析 PAT/PMT
+type mediaSniffer struct {
+	container string
+	video     []string
+	audio     []string
+	ts        *tsParser
+}
+
+// sniffMedia 识别媒体数据的封装格式，网页、JSON 等错误内容返回 bad_content 错误
+// 无法识别的二进制内容（如 MP4、音频流）不视为失败
+func sniffMedia(head []byte) (*mediaSniffer, error) {
+	switch {
+	case len(head) == 0:
+		return nil, badContent("内容为空")
+	case looksLikeHTML(head):
+		return nil, badContent("返回的是网页而不是媒体流")
+	case looksLikeJSON(head):
+		return nil, badContent("返回的是 JSON 而不是媒体流")
+	}
+
+	s := &mediaSniffer{}
+	if isFLV(head) {
+		s.container = types.ContainerFLV
+		s.video, s.audio = parseFLVTags(head)
+		return s, nil
+	}
+	if stride, offset, ok := findTSSync(head); ok {
+		s.container = types.ContainerMPEGTS
+		s.ts = newTSParser(stride, offset)
+		return s, nil
+	}
+	if head[0] == tsSyncByte && len(head) >= 3*tsPacketSize {
+		return nil, badContent("MPEG-TS 同步字节不连续")
+	}
+	return s, nil
+}
+
+// reader 返回读取样本用的 reader，MPEG-TS 读取的数据同时交给解析器
+func (s *mediaSniffer) reader(r io.Reader) io.Reader {
+	if s.ts == nil {
+		return r
+	}
+	return io.TeeReader(r, s.ts)
+}
+
+// apply 将识别出的格式和编码写入探测结果，已有的封装格式（如 HLS）不会被覆盖
+func (s *mediaSniffer) apply(result *types.ProbeResult) {
+	if result.Container == "" {
+		result.Container = s.container
+	}
+	video, audio := s.video, s.audio
+	if s.ts != nil {
+		video, audio = s.ts.video, s.ts.audio
+	}
+	if len(video) > 0 {
+		result.VideoCodecs = video
+	}
+	if len(audio) > 0 {
+		result.AudioCodecs = audio
+	}
+}
+
+// looksLikeHTML 判断内容是否为网页，常见于鉴权失败或已下线的地址
+func looksLikeHTML(head []byte) bool {
+	head = bytes.ToLower(trimText(head))
+	for _, prefix := range []string{"<!doctype html", "<html", "<head", "<body"} {
+		if bytes.HasPrefix(head, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeJSON 判断内容是否为 JSON，常见于接口返回的错误信息
+func looksLikeJSON(head []byte) bool {
+	head = trimText(head)
+	if len(head) < 2 {
+		return false
+	}
+	next := bytes.TrimLeft(head[1:], " \t\r\n")
+	if len(next) == 0 {
+		return false
+	}
+	switch head[0] {
+	case '{':
+		return next[0] == '"' || next[0] == '}'
+	case '[':
+		return next[0] == '{' || next[0] == '"' || next[0] == ']'
+	}
+	return false
+}
+
+// trimText 去掉文本开头的 BOM 和两端的空白
+func trimText(head []byte) []byte {
+	return bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+}
+
+// findTSSync 查找连续出现在固定间隔上的同步字节，返回包长度和第一个包的偏移
+// 内容不足两个包时只检查第一个字节
+func findTSSync(head []byte) (stride, offset int, ok bool) {
+	if len(head) < 2*tsPacketSize {
+		return tsPacketSize, 0, head[0] == tsSyncByte
+	}
+	for _, stride := range []int{tsPacketSize, m2tsPacketSize} {
+		for offset := 0; offset < stride && offset+stride < len(head); offset++ {
+			if syncedAt(head, stride, offset) {
+				return stride, offset, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// syncedAt 判断从 offset 开始每隔 stride 字节都是同步字节
+func syncedAt(head []byte, stride, offset int) bool {
+	for i := offset; i < len(head); i += stride {
+		if head[i] != tsSyncByte {
+			return false
+		}
+	}
+	return true
+}
+
+// tsParser 从 MPEG-TS 数据中解析 PAT 和第一个节目的 PMT，得到音视频的编码
+// 只解析在单个包内开始的表，PAT/PMT 一般都在一个包内
+type tsParser struct {
+	stride int
+	skip   int // 下一个包之前需要跳过的字节数
+	buf    []byte
+	parsed int
+
+	pmtPIDs map[uint16]bool
+	video   []string
+	audio   []string
+	done    bool
+}
+
+func newTSParser(stride, offset int) *tsParser {
+	return &tsParser{stride: stride, skip: offset}
+}
+
+// Write 解析完整的包，不完整的部分留到下一次，总是返回成功以免影响样本读取
+func (t *tsParser) Write(p []byte) (int, error) {
+	n := len(p)
+	if t.done || t.parsed > tsMaxParseSize {
+		return n, nil
+	}
+	t.parsed += n
+	t.buf = append(t.buf, p...)
+
+	for !t.done {
+		if t.skip > 0 {
+			k := min(t.skip, len(t.buf))
+			t.buf = t.buf[k:]
+			t.skip -= k
+		}
+		if len(t.buf) < tsPacketSize {
+			break
+		}
+		if t.buf[0] != tsSyncByte {
+			// 失去同步，跳到下一个同步字节
+			i := bytes.IndexByte(t.buf[1:], tsSyncByte)
+			if i < 0 {
+				t.buf = t.buf[:0]
+				break
+			}
+			t.buf = t.buf[i+1:]
+			continue
+		}
+		t.parsePacket(t.buf[:tsPacketSize])
+		t.buf = t.buf[tsPacketSize:]
+		t.skip = t.stride - tsPacketSize
+	}
+	if t.done {
+		t.buf = nil
+	}
+	return n, nil
+}
+
+// parsePacket 解析一个 188 字节的包中开始的 PAT 或 PMT
+func (t *tsParser) parsePacket(pkt []byte) {
+	unitStart := pkt[1]&0x40 != 0
+	pid := binary.BigEndian.Uint16(pkt[1:3]) & 0x1fff
+	if !unitStart || (pid != 0 && !t.pmtPIDs[pid]) {
+		return
+	}
+
+	payload := pkt[4:]
+	adaptation := pkt[3] >> 4 & 0x03
+	if adaptation&0x01 == 0 {
+		return
+	}
+	if adaptation&0x02 != 0 {
+		if len(payload) == 0 || int(payload[0])+1 >= len(payload) {
+			return
+		}
+		payload = payload[payload[0]+1:]
+	}
+	pointer := int(payload[0])
+	if pointer+1 >= len(payload) {
+		return
+	}
+	section := payload[pointer+1:]
+	if len(section) < 3 {
+		return
+	}
+	// section_length 之后的内容，不含末尾 4 字节的 CRC
+	end := 3 + int(binary.BigEndian.Uint16(section[1:3])&0x0fff) - 4
+	if end > len(section) {
+		end = len(section)
+	}
+
+	switch {
+	case pid == 0 && section[0] == 0x00:
+		t.parsePAT(section, end)
+	case pid != 0 && section[0] == 0x02:
+		t.parsePMT(section, end)
+	}
+}
+
+// parsePAT 记录各节目 PMT 所在的 PID
+func (t *tsParser) parsePAT(section []byte, end int) {
+	pids := make(map[uint16]bool)
+	for i := 8; i+4 <= end; i += 4 {
+		program := binary.BigEndian.Uint16(section[i : i+2])
+		pid := binary.BigEndian.Uint16(section[i+2:i+4]) & 0x1fff
+		// 节目号 0 指向网络信息表
+		if program != 0 {
+			pids[pid] = true
+		}
+	}
+	if len(pids) > 0 {
+		t.pmtPIDs = pids
+	}
+}
+
+// parsePMT 根据各基本流的 stream_type 和描述符得到编码
+func (t *tsParser) parsePMT(section []byte, end int) {
+	if end < 12 {
+		return
+	}
+	i := 12 + int(binary.BigEndian.Uint16(section[10:12])&0x0fff)
+	for i+5 <= end {
+		streamType := section[i]
+		infoEnd := min(i+5+int(binary.BigEndian.Uint16(section[i+3:i+5])&0x0fff), end)
+		kind, codec := tsStreamCodec(streamType, section[i+5:infoEnd])
+		switch kind {
+		case "video":
+			t.video = appendUnique(t.video, codec)
+		case "audio":
+			t.audio = appendUnique(t.audio, codec)
+		}
+		i = infoEnd
+	}
+	t.done = true
+}
+
+// tsStreamCodec 返回 PMT 中 stream_type 对应的类型和编码，字幕、数据等返回空
+// 私有数据流（0x06）根据描述符识别 AC-3 和 E-AC-3
+func tsStreamCodec(streamType byte, descriptors []byte) (kind, codec string) {
+	switch streamType {
+	case 0x01:
+		return "video", "mpeg1"
+	case 0x02:
+		return "video", "mpeg2"
+	case 0x10:
+		return "video", "mpeg4"
+	case 0x1b:
+		return "video", "h264"
+	case 0x24:
+		return "video", "hevc"
+	case 0x42:
+		return "video", "avs"
+	case 0xd2:
+		return "video", "avs2"
+	case 0xd4:
+		return "video", "avs3"
+	case 0xea:
+		return "video", "vc1"
+	case 0x03, 0x04:
+		return "audio", "mp3"
+	case 0x0f:
+		return "audio", "aac"
+	case 0x11:
+		return "audio", "aac_latm"
+	case 0x81:
+		return "audio", "ac3"
+	case 0x87:
+		return "audio", "eac3"
+	case 0x06:
+		for i := 0; i+2 <= len(descriptors); i += 2 + int(descriptors[i+1]) {
+			switch descriptors[i] {
+			case 0x6a:
+				return "audio", "ac3"
+			case 0x7a:
+				return "audio", "eac3"
+			}
+		}
+	}
+	return "", ""
+}
+
+// isFLV 判断内容是否以 FLV 文件头开始
+func isFLV(head []byte) bool {
+	return len(head) >= 9 && bytes.HasPrefix(head, []byte("FLV")) && head[3] == 0x01
+}
+
+// parseFLVTags 从文件头之后的标签中得到第一个视频和音频标签的编码
+func parseFLVTags(head []byte) (video, audio []string) {
+	i := int(binary.BigEndian.Uint32(head[5:9])) + 4 // 跳过文件头和 PreviousTagSize0
+	for i+11 < len(head) && (video == nil || audio == nil) {
+		size := int(head[i+1])<<16 | int(head[i+2])<<8 | int(head[i+3])
+		data := head[i+11:]
+		switch head[i] & 0x1f {
+		case 8:
+			if audio == nil {
+				if codec := flvAudioCodec(data[0] >> 4); codec != "" {
+					audio = []string{codec}
+				}
+			}
+		case 9:
+			if video == nil {
+				if codec := flvVideoCodec(data); codec != "" {
+					video = []string{codec}
+				}
+			}
+		}
+		i += 11 + size + 4
+	}
+	return video, audio
+}
+
+// flvAudioCodec 返回 FLV 音频标签 SoundFormat 对应的编码
+func flvAudioCodec(format byte) string {
+	switch format {
+	case 2, 14:
+		return "mp3"
+	case 7:
+		return "pcma"
+	case 8:
+		return "pcmu"
+	case 10:
+		return "aac"
+	case 11:
+		return "speex"
+	}
+	return ""
+}
+
+// flvVideoCodec 返回 FLV 视频标签的编码，支持 Enhanced RTMP 的 FourCC 和国内常用的 HEVC 扩展（CodecID 12）
+func flvVideoCodec(data []byte) string {
+	if data[0]&0x80 != 0 {
+		if len(data) < 5 {
+			return ""
+		}
+		switch string(data[1:5]) {
+		case "avc1":
+			return "h264"
+		case "hvc1":
+			return "hevc"
+		case "av01":
+			return "av1"
+		case "vp09":
+			return "vp9"
+		}
+		return ""
+	}
+	switch data[0] & 0x0f {
+	case 2:
+		return "h263"
+	case 4:
+		return "vp6"
+	case 7:
+		return "h264"
+	case 12:
+		return "hevc"
+	}
+	return ""
+}
+
+// appendUnique 追加不在列表中的非空值
+func appendUnique(list []string, value string) []string {
+	if value == "" {
+		return list
+	}
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -0,0 +1,133 @@
+package m3u
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+// tsPacket 构造一个只有负载的 TS 包，不足部分用 0xff 填充
+func tsPacket(pid uint16, unitStart bool, payload ...byte) []byte {
+	pkt := bytes.Repeat([]byte{0xff}, tsPacketSize)
+	pkt[0] = tsSyncByte
+	pkt[1] = byte(pid>>8) & 0x1f
+	if unitStart {
+		pkt[1] |= 0x40
+	}
+	pkt[2] = byte(pid)
+	pkt[3] = 0x10
+	copy(pkt[4:], payload)
+	return pkt
+}
+
+// tsStream 构造 filler 个空包之后是 PAT 和包含 H.264、AAC 的 PMT 的 TS 数据
+func tsStream(filler int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < filler; i++ {
+		buf.Write(tsPacket(0x100, false))
+	}
+	buf.Write(tsPacket(0x0000, true,
+		0x00,                         // pointer_field
+		0x00, 0xb0, 0x0d, 0x00, 0x01, // table_id, section_length, transport_stream_id
+		0xc1, 0x00, 0x00,
+		0x00, 0x01, 0xf0, 0x00, // program 1 -> PMT PID 0x1000
+		0, 0, 0, 0, // CRC
+	))
+	buf.Write(tsPacket(0x1000, true,
+		0x00,
+		0x02, 0xb0, 0x17, 0x00, 0x01,
+		0xc1, 0x00, 0x00,
+		0xe1, 0x00, 0xf0, 0x00, // PCR PID, program_info_length
+		0x1b, 0xe1, 0x00, 0xf0, 0x00, // H.264
+		0x0f, 0xe1, 0x01, 0xf0, 0x00, // AAC
+		0, 0, 0, 0,
+	))
+	for i := 0; i < 5; i++ {
+		buf.Write(tsPacket(0x100, false))
+	}
+	return buf.Bytes()
+}
+
+func TestSniffMedia_MPEGTS(t *testing.T) {
+	// PAT/PMT 在识别用的开头之后，需要在读取样本时继续解析
+	data := tsStream(40)
+	// M2TS 每个包前有 4 字节时间码
+	var m2ts bytes.Buffer
+	for i := 0; i < len(data); i += tsPacketSize {
+		m2ts.Write([]byte{0, 0, 0, 0})
+		m2ts.Write(data[i : i+tsPacketSize])
+	}
+
+	for name, data := range map[string][]byte{"ts": data, "m2ts": m2ts.Bytes()} {
+		sniffer, err := sniffMedia(data[:sniffSize])
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := readSample(sniffer.reader(bytes.NewReader(data)), int64(len(data)), time.Second); err != nil {
+			t.Fatal(err)
+		}
+		result := &types.ProbeResult{}
+		sniffer.apply(result)
+		if result.Container != types.ContainerMPEGTS ||
+			strings.Join(result.VideoCodecs, ",") != "h264" || strings.Join(result.AudioCodecs, ",") != "aac" {
+			t.Errorf("%s: 识别结果不符合预期: %+v", name, result)
+		}
+	}
+
+	// 同步字节不按包长度出现
+	broken := append([]byte{tsSyncByte}, bytes.Repeat([]byte{0x00, 0x47, 0x12, 0x34, 0x56}, 200)...)
+	if _, err := sniffMedia(broken); classifyError(err) != types.ProbeErrorBadContent {
+		t.Errorf("同步字节不连续时应判为无效内容: %v", err)
+	}
+}
+
+func TestSniffMedia_FLV(t *testing.T) {
+	data := []byte("FLV\x01\x05\x00\x00\x00\x09\x00\x00\x00\x00")
+	// 视频标签：CodecID 7（H.264）
+	data = append(data, 0x09, 0x00, 0x00, 0x05, 0, 0, 0, 0, 0, 0, 0, 0x17, 0x00, 0x00, 0x00, 0x00, 0, 0, 0, 16)
+	// 音频标签：SoundFormat 10（AAC）
+	data = append(data, 0x08, 0x00, 0x00, 0x02, 0, 0, 0, 0, 0, 0, 0, 0xaf, 0x00, 0, 0, 0, 13)
+
+	sniffer, err := sniffMedia(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := &types.ProbeResult{}
+	sniffer.apply(result)
+	if result.Container != types.ContainerFLV ||
+		strings.Join(result.VideoCodecs, ",") != "h264" || strings.Join(result.AudioCodecs, ",") != "aac" {
+		t.Errorf("识别结果不符合预期: %+v", result)
+	}
+}
+
+func TestValidateURL_RejectsErrorBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/offline":
+			w.Write([]byte("\n  <html><body>频道已下线</body></html>"))
+		case "/json":
+			w.Header().Set("Content-Type", "video/mp2t")
+			w.Write([]byte(`{"code": 403, "msg": "token expired"}`))
+		case "/live.ts":
+			w.Write(tsStream(2))
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/offline", "/json"} {
+		if res := ValidateURL(context.Background(), server.URL+path, nil, time.Second); res.Valid ||
+			res.ErrorClass != types.ProbeErrorBadContent {
+			t.Errorf("%s 应判为无效内容: %+v", path, res)
+		}
+	}
+
+	res := ValidateURL(context.Background(), server.URL+"/live.ts", nil, time.Second)
+	if !res.Valid || res.Container != types.ContainerMPEGTS || len(res.VideoCodecs) != 1 || len(res.AudioCodecs) != 1 {
+		t.Errorf("应识别出 MPEG-TS 及其编码: %+v", res)
+	}
+}
@@ -0,0 +1,190 @@
+package m3u
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// genreMarker TXT 格式中分组标题行的标记
+const genreMarker = "#genre#"
+
+// TXTScanner 以流式方式读取 DIYP/TXT 格式的频道列表
+//
+//	央视频道,#genre#
+//	CCTV-1,http://example.com/cctv1.m3u8#http://backup.example.com/cctv1.m3u8
+type TXTScanner struct {
+	sc   *bufio.Scanner
+	line int
+	base *url.URL
+
+	group   string
+	pending []Entry // 同一行中以 # 分隔的多个地址
+	entry   Entry
+	err     error
+	warningList
+}
+
+// NewTXTScanner 创建读取 r 的 TXTScanner
+func NewTXTScanner(r io.Reader) *TXTScanner {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &TXTScanner{sc: sc, group: DefaultGroup}
+}
+
+// SetBaseURL 设置频道列表自身的地址，列表中的相对地址将基于它解析
+func (s *TXTScanner) SetBaseURL(base string) error {
+	if base == "" {
+		s.base = nil
+		return nil
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	s.base = u
+	return nil
+}
+
+// Scan 读取下一个条目，没有更多条目或出错时返回 false
+func (s *TXTScanner) Scan() bool {
+	for len(s.pending) == 0 {
+		if !s.sc.Scan() {
+			s.err = s.sc.Err()
+			if s.err == bufio.ErrTooLong {
+				s.err = fmt.Errorf("第 %d 行超出最大长度 %d 字节", s.line+1, maxLineSize)
+			}
+			return false
+		}
+		s.line++
+		s.parseLine(strings.TrimSpace(s.sc.Text()))
+	}
+
+	s.entry, s.pending = s.pending[0], s.pending[1:]
+	return true
+}
+
+func (s *TXTScanner) parseLine(line string) {
+	if line == "" {
+		return
+	}
+
+	name, value, found := strings.Cut(line, ",")
+	if !found {
+		if !strings.HasPrefix(line, "#") {
+			s.warn(s.line, fmt.Sprintf("无法识别的行: %s", truncate(line, 80)))
+		}
+		return
+	}
+	name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+	if strings.EqualFold(value, genreMarker) {
+		s.group = name
+		if s.group == "" {
+			s.group = DefaultGroup
+		}
+		return
+	}
+	if strings.HasPrefix(name, "#") {
+		return
+	}
+	if name == "" {
+		s.warn(s.line, "频道名称为空")
+		return
+	}
+
+	for _, raw := range splitTXTURLs(value) {
+		streamURL, err := resolveStreamURL(raw, s.base)
+		if err != nil {
+			s.warn(s.line, fmt.Sprintf("%v，已跳过: %s", err, truncate(raw, 80)))
+			continue
+		}
+		info := newExtInf(-1, name, s.group, "")
+		s.pending = append(s.pending, Entry{
+			Metadata: formatExtInf(info),
+			URL:      streamURL,
+			Info:     info,
+		})
+	}
+}
+
+// Entry 返回最近一次 Scan 读取到的条目
+func (s *TXTScanner) Entry() Entry {
+	return s.entry
+}
+
+// Header TXT 格式没有头信息，始终返回 nil
+func (s *TXTScanner) Header() *Header {
+	return nil
+}
+
+// Err 返回读取过程中遇到的错误
+func (s *TXTScanner) Err() error {
+	return s.err
+}
+
+// splitTXTURLs 拆分以 # 连接的多个地址，并去掉 DIYP 的 $线路说明 后缀
+// 只有 # 之后紧跟协议的部分才视为新的地址，其余 # 保留在原地址中
+func splitTXTURLs(value string) []string {
+	var urls []string
+	for _, part := range strings.Split(value, "#") {
+		if len(urls) > 0 && !schemeRe.MatchString(strings.TrimSpace(part)) {
+			urls[len(urls)-1] += "#" + part
+			continue
+		}
+		urls = append(urls, part)
+	}
+
+	result := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if i := strings.LastIndex(u, "$"); i > 0 {
+			u = u[:i]
+		}
+		if u = strings.TrimSpace(u); u != "" {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+// WriteTXT 以 DIYP/TXT 格式输出条目，分组按首次出现的顺序排列
+func WriteTXT(w io.Writer, entries []Entry) error {
+	var groups []string
+	byGroup := make(map[string][]string)
+
+	for _, entry := range entries {
+		if entry.URL == "" {
+			continue
+		}
+		info := entry.Info
+		if info == nil {
+			info, _ = ParseExtInf(entry.Metadata)
+		}
+		if info == nil {
+			info = &ExtInf{}
+		}
+		pe := newParsedEntry(info, entry.URL)
+
+		group := txtField(pe.Channel)
+		if _, ok := byGroup[group]; !ok {
+			groups = append(groups, group)
+		}
+		byGroup[group] = append(byGroup[group], fmt.Sprintf("%s,%s", txtField(pe.Title), entry.URL))
+	}
+
+	writer := bufio.NewWriter(w)
+	for _, group := range groups {
+		fmt.Fprintf(writer, "%s,%s\n", group, genreMarker)
+		for _, line := range byGroup[group] {
+			fmt.Fprintln(writer, line)
+		}
+	}
+	return writer.Flush()
+}
+
+// txtField TXT 格式以逗号分隔字段，名称中的逗号和换行需要替换掉
+func txtField(s string) string {
+	return strings.NewReplacer(",", "，", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,67 @@
+package m3u
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseReader_TXT(t *testing.T) {
+	content := `央视频道,#genre#
+CCTV-1,http://example.com/cctv1.m3u8#http://backup.example.com/cctv1.m3u8$线路2
+CCTV-2,http://example.com/cctv2.m3u8
+
+卫视频道,#genre#
+湖南卫视,live/hunan.m3u8
+无效行
+`
+	playlist, err := ParseReader(strings.NewReader(content), "http://example.com/tv.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Format != FormatTXT {
+		t.Fatalf("格式识别错误: %s", playlist.Format)
+	}
+
+	parsed := ParseEntry(playlist.Entries)
+	want := []ParsedEntry{
+		{Channel: "央视频道", Title: "CCTV-1", URL: "http://example.com/cctv1.m3u8"},
+		{Channel: "央视频道", Title: "CCTV-1", URL: "http://backup.example.com/cctv1.m3u8"},
+		{Channel: "央视频道", Title: "CCTV-2", URL: "http://example.com/cctv2.m3u8"},
+		{Channel: "卫视频道", Title: "湖南卫视", URL: "http://example.com/live/hunan.m3u8"},
+	}
+	if len(parsed) != len(want) {
+		t.Fatalf("期望 %d 个条目，实际 %d 个", len(want), len(parsed))
+	}
+	for i, w := range want {
+		got := parsed[i]
+		if got.Channel != w.Channel || got.Title != w.Title || got.URL != w.URL {
+			t.Errorf("第 %d 个条目应为 %+v，实际为 %+v", i, w, got)
+		}
+	}
+	if playlist.WarningCount != 1 || playlist.Warnings[0].Line != 7 {
+		t.Errorf("警告不符合预期: %v", playlist.Warnings)
+	}
+}
+
+func TestWriteTXT_RoundTrip(t *testing.T) {
+	entries := Parse(`#EXTM3U
+#EXTINF:-1 group-title="新闻",新闻,频道
+http://example.com/news.m3u8
+#EXTINF:-1 group-title="体育",体育频道
+http://example.com/sports.m3u8
+`)
+
+	var buf bytes.Buffer
+	if err := WriteTXT(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	want := "新闻,#genre#\n新闻，频道,http://example.com/news.m3u8\n体育,#genre#\n体育频道,http://example.com/sports.m3u8\n"
+	if buf.String() != want {
+		t.Errorf("输出不符合预期:\n%s", buf.String())
+	}
+
+	if DetectFormat(buf.Bytes()) != FormatTXT {
+		t.Error("输出内容应被识别为 TXT 格式")
+	}
+}
@@ -0,0 +1,53 @@
+package m3u
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// schemeRe 匹配 "scheme://" 形式的地址前缀
+var schemeRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.\-]*)://`)
+
+// errNoBase 相对地址缺少可用于解析的基准地址
+var errNoBase = errors.New("相对地址缺少基准地址")
+
+// resolveStreamURL 规范化播放地址
+// 带协议的地址统一将协议转为小写，相对地址基于 base 解析为绝对地址
+func resolveStreamURL(raw string, base *url.URL) (string, error) {
+	if strings.ContainsAny(raw, " \t") {
+		return "", fmt.Errorf("地址中包含空白字符")
+	}
+
+	if m := schemeRe.FindStringSubmatch(raw); m != nil {
+		return strings.ToLower(m[1]) + raw[len(m[1]):], nil
+	}
+
+	ref, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("无效的地址: %w", err)
+	}
+	if base == nil {
+		return "", errNoBase
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// URLScheme 返回播放地址的协议（小写），无法识别时返回空字符串
+func URLScheme(rawURL string) string {
+	if m := schemeRe.FindStringSubmatch(rawURL); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// ProbeSupported 判断验证器是否能探测该地址
+func ProbeSupported(rawURL string) bool {
+	switch URLScheme(rawURL) {
+	case "http", "https", "udp", "rtp":
+		return true
+	}
+	return false
+}
@@ -1,86 +1,274 @@
 package m3u
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"sync"
 	"time"
+	"tv-server/internal/model/types"
 	"tv-server/utils"
+	"tv-server/utils/httpclient"
 
 	"github.com/panjf2000/ants/v2"
 )
 
-var (
-	processCount int
-	totalCount   int
-	processLock  sync.RWMutex
-)
+// ValidateResult 批量验证的结果
+type ValidateResult struct {
+	Entries  []Entry              // 所有完成验证的条目，包括失败的
+	Valid    []Entry              // 验证通过或未经验证的条目
+	Unique   []Entry              // Valid 按地址去重后的条目，保持首次出现的顺序
+	Probes   []*types.ProbeResult // 经过探测的地址的结果，每个地址一条，同一地址有一次通过即视为通过
+	Expanded []Entry              // 验证时从返回频道列表的地址中展开的条目，已包含在 Entries 中
+	Hosts    []HostReport         // 有失败的主机，不可用的在前
+}
+
+// HealthPolicy 根据历次验证的统计决定是否保留地址
+type HealthPolicy struct {
+	MinSuccessRatio        float64 // 最低成功比例
+	MaxConsecutiveFailures int     // 连续失败达到该次数时不再保留，0 不限制
+}
+
+// keep 判断探测过的地址是否保留，没有统计时以本次探测结果为准
+func (p HealthPolicy) keep(probe *types.ProbeResult, stats *types.ProbeStats) bool {
+	if stats == nil || stats.Checks == 0 {
+		return probe.Valid
+	}
+	if p.MaxConsecutiveFailures > 0 && stats.ConsecutiveFailures >= p.MaxConsecutiveFailures {
+		return false
+	}
+	return stats.SuccessRatio() >= p.MinSuccessRatio
+}
+
+// Select 按历次验证的统计重新选出保留的条目，stats 的 key 为播放地址
+// 偶尔超时的地址只要成功比例足够仍会保留，未经验证的条目总是保留
+func (r *ValidateResult) Select(stats map[string]*types.ProbeStats, policy HealthPolicy) {
+	r.filter(func(entry Entry) bool {
+		return entry.Unverified || (entry.Probe != nil && policy.keep(entry.Probe, stats[entry.URL]))
+	})
+}
+
+// Recorded 返回应计入验证统计、历史和归档判断的探测结果
+// 主机不可用时跳过的地址并未实际探测，一次解析故障不应累计到该主机的每个地址上
+func (r *ValidateResult) Recorded() []*types.ProbeResult {
+	probes := make([]*types.ProbeResult, 0, len(r.Probes))
+	for _, probe := range r.Probes {
+		if probe.ErrorClass != types.ProbeErrorHostDown {
+			probes = append(probes, probe)
+		}
+	}
+	return probes
+}
+
+// Exclude 从 Valid 和 Unique 中去掉 urls 中的地址，如本次验证后被归档的地址
+func (r *ValidateResult) Exclude(urls map[string]bool) {
+	if len(urls) == 0 {
+		return
+	}
+	without := func(entries []Entry) []Entry {
+		result := make([]Entry, 0, len(entries))
+		for _, entry := range entries {
+			if !urls[entry.URL] {
+				result = append(result, entry)
+			}
+		}
+		return result
+	}
+	r.Valid, r.Unique = without(r.Valid), without(r.Unique)
+}
+
+// filter 用 keep 从所有条目中选出 Valid，并按地址去重得到 Unique
+func (r *ValidateResult) filter(keep func(Entry) bool) {
+	r.Valid = make([]Entry, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		if keep(entry) {
+			r.Valid = append(r.Valid, entry)
+		}
+	}
+
+	seen := make(map[string]bool, len(r.Valid))
+	r.Unique = make([]Entry, 0, len(r.Valid))
+	for _, entry := range r.Valid {
+		if seen[entry.URL] {
+			continue
+		}
+		seen[entry.URL] = true
+		r.Unique = append(r.Unique, entry)
+	}
+}
 
 type validateTask struct {
-	entry      Entry
-	maxLatency time.Duration
-	results    chan<- Entry
-	process    chan<- int
+	ctx     context.Context
+	entry   Entry
+	opts    ValidateOptions
+	limiter *hostLimiter
+	hosts   *hostHealth
+	dns     *httpclient.DNSCache
+	results chan<- Entry
 }
 
 func validateWorker(task interface{}) {
 	t := task.(*validateTask)
-	valid, err := ValidateURL(t.entry.URL, t.maxLatency)
-	if valid && err == nil {
-		select {
-		case t.results <- t.entry:
-		default:
-			fmt.Printf("警告: 无法发送结果: %s\n", t.entry.URL)
-		}
+	probe := t.probe()
+	// 已取消时不再探测；被取消中断的探测失败不代表地址失效，不计入结果
+	if probe == nil || (!probe.Valid && t.ctx.Err() != nil) {
+		return
 	}
+	if probe.ErrorClass != types.ProbeErrorHostDown {
+		t.hosts.observe(hostPortOf(t.entry.URL), probe)
+	}
+	t.entry.Probe = probe
 	select {
-	case t.process <- 1:
+	case t.results <- t.entry:
 	default:
-		fmt.Printf("警告: 无法更新进度: %s\n", t.entry.URL)
+		fmt.Printf("警告: 无法发送结果: %s\n", t.entry.URL)
 	}
 }
 
-func ValidateAndUnique(allEntries []Entry, maxLatency time.Duration, workerCount int) ([]Entry, []Entry, error) {
-	if workerCount > len(allEntries) {
-		workerCount = len(allEntries)
+// probe 探测地址，暂时性失败按 opts 退避重试，每次探测都重新占用主机名额
+// 主机已被判为不可用时不再探测，直接返回失败；探测开始前 ctx 已被取消时返回 nil
+func (t *validateTask) probe() *types.ProbeResult {
+	host, origin := hostOf(t.entry.URL), hostPortOf(t.entry.URL)
+	var result *types.ProbeResult
+	for attempt := 0; attempt <= t.opts.Retries; attempt++ {
+		if attempt > 0 {
+			if err := SleepContext(t.ctx, t.opts.backoff(attempt)); err != nil {
+				break
+			}
+		}
+		if skipped := t.hosts.skip(origin, t.entry.URL); skipped != nil {
+			return skipped
+		}
+		if err := t.limiter.acquire(t.ctx, host); err != nil {
+			break
+		}
+		// 等待名额期间主机可能已被判为不可用
+		if skipped := t.hosts.skip(origin, t.entry.URL); skipped != nil {
+			t.limiter.release(host)
+			return skipped
+		}
+		result = validateURL(t.ctx, t.entry.URL, t.entry.Options, t.opts, proxySources(t.entry), t.dns)
+		t.limiter.release(host)
+		result.Attempts = attempt + 1
+		if result.Valid || !isTransient(result.ErrorClass) {
+			break
+		}
+	}
+	return result
+}
+
+// ValidateAndUnique 并发验证所有条目并按地址去重，进度记录到 job 中，job 可以为 nil
+// 对同一主机的并发数和请求频率按 opts 限制，域名解析结果在本次验证内缓存
+// 同一主机连续 opts.HostFailures 次解析失败或拒绝连接后，剩余地址直接判为失败
+// 探测到返回频道列表的地址时按 opts.MaxDepth 展开，展开得到的条目在下一轮验证
+// ctx 被取消后不再开始新的探测，并中断进行中的探测，返回已完成部分的结果和 ctx.Err()
+func ValidateAndUnique(ctx context.Context, job *Job, allEntries []Entry, opts ValidateOptions) (*ValidateResult, error) {
+	job.addTotal(len(allEntries))
+	if len(allEntries) == 0 {
+		return &ValidateResult{}, nil
+	}
+
+	v := &batchValidator{
+		ctx:     ctx,
+		job:     job,
+		opts:    opts,
+		limiter: newHostLimiter(opts),
+		hosts:   newHostHealth(opts.HostFailures),
+		dns:     httpclient.NewDNSCache(),
+		result:  &ValidateResult{Entries: make([]Entry, 0, len(allEntries))},
+		probed:  make(map[string]int),
+	}
+	result := v.result
+	expander := NewExpander(ctx, "", opts.MaxDepth)
+	for pending := allEntries; len(pending) > 0 && ctx.Err() == nil; {
+		nested, err := v.run(pending)
+		if err != nil {
+			return nil, err
+		}
+		pending = nil
+		for _, entry := range nested {
+			expander.Expand(entry, func(child Entry) error {
+				// 已验证过的地址不再验证，也避免嵌套列表互相引用时重复获取
+				if _, ok := v.probed[child.URL]; !ok {
+					pending = append(pending, child)
+				}
+				return nil
+			})
+		}
+		result.Expanded = append(result.Expanded, pending...)
+		job.addTotal(len(pending))
+	}
+	for _, w := range expander.Warnings() {
+		fmt.Printf("展开嵌套播放列表: %s\n", w.Message)
+	}
+
+	result.filter(func(entry Entry) bool {
+		return entry.Unverified || (entry.Probe != nil && entry.Probe.Valid)
+	})
+	result.Hosts = v.hosts.report()
+
+	if err := ctx.Err(); err != nil {
+		fmt.Printf("验证已取消，完成 %d 个链接\n", len(result.Probes))
+		return result, err
+	}
+	fmt.Println("验证完成！")
+	return result, nil
+}
+
+// batchValidator 一次批量验证中各轮共用的主机限制、解析缓存和结果
+type batchValidator struct {
+	ctx     context.Context
+	job     *Job
+	opts    ValidateOptions
+	limiter *hostLimiter
+	hosts   *hostHealth
+	dns     *httpclient.DNSCache
+	result  *ValidateResult
+	probed  map[string]int // 已记录的地址在 result.Probes 中的位置
+}
+
+// run 验证一轮条目并将结果记录到 result，返回探测出指向频道列表的条目
+func (v *batchValidator) run(entries []Entry) ([]Entry, error) {
+	workerCount := v.opts.Workers
+	if workerCount <= 0 {
+		workerCount = DefaultWorkers
+	}
+	if workerCount > len(entries) {
+		workerCount = len(entries)
 	}
 
 	pool, err := ants.NewPool(workerCount)
 	if err != nil {
-		return nil, nil, fmt.Errorf("创建协程池失败: %w", err)
+		return nil, fmt.Errorf("创建协程池失败: %w", err)
 	}
 	defer pool.Release()
 
-	results := make(chan Entry, len(allEntries))
-	process := make(chan int, len(allEntries))
-	validEntries := make([]Entry, 0, len(allEntries))
+	results := make(chan Entry, len(entries))
 	var wg sync.WaitGroup
 
-	fmt.Printf("开始批量验证，总共链接数:%d，并发协程数: %d, 预计耗时:%s\n",
-		len(allEntries), workerCount,
-		utils.CalculateTotalTimeToString(maxLatency, workerCount, len(allEntries)))
-
-	processLock.Lock()
-	processCount = 0
-	totalCount = len(allEntries)
-	processLock.Unlock()
+	fmt.Printf("开始批量验证，总共链接数:%d，并发协程数: %d, 每个主机并发数: %d, 最长耗时:%s\n",
+		len(entries), workerCount, v.opts.PerHost,
+		utils.CalculateTotalTimeToString(v.opts.MaxLatency, workerCount, len(entries)))
 
-	go func() {
-		for range process {
-			processLock.Lock()
-			processCount++
-			processLock.Unlock()
+	for _, entry := range interleaveByHost(entries) {
+		if v.ctx.Err() != nil {
+			break
+		}
+		// 无法探测的协议（如 rtmp、rtsp）不做验证，标记后直接保留
+		if !ProbeSupported(entry.URL) {
+			entry.Unverified = true
+			results <- entry
+			continue
 		}
-	}()
 
-	for _, entry := range allEntries {
 		wg.Add(1)
 		task := &validateTask{
-			entry:      entry,
-			maxLatency: maxLatency,
-			results:    results,
-			process:    process,
+			ctx:     v.ctx,
+			entry:   entry,
+			opts:    v.opts,
+			limiter: v.limiter,
+			hosts:   v.hosts,
+			dns:     v.dns,
+			results: results,
 		}
 
 		if err := pool.Submit(func() {
@@ -96,70 +284,41 @@ func ValidateAndUnique(allEntries []Entry, maxLatency time.Duration, workerCount
 	go func() {
 		wg.Wait()
 		close(results)
-		close(process)
 	}()
 
+	var nested []Entry
+	result := v.result
 	for entry := range results {
-		validEntries = append(validEntries, entry)
-	}
-
-	// 去重
-	urlMap := make(map[string]Entry)
-	for _, entry := range validEntries {
-		urlMap[entry.URL] = entry
-	}
-
-	finalValidEntries := make([]Entry, 0, len(urlMap))
-	for _, entry := range urlMap {
-		finalValidEntries = append(finalValidEntries, entry)
+		v.job.record(entry)
+		result.Entries = append(result.Entries, entry)
+		if entry.Probe == nil {
+			continue
+		}
+		if entry.Probe.ErrorClass == types.ProbeErrorNestedList {
+			nested = append(nested, entry)
+		}
+		// 同一地址可能在列表中出现多次，统计时只算一次
+		if i, ok := v.probed[entry.URL]; ok {
+			if !result.Probes[i].Valid && entry.Probe.Valid {
+				result.Probes[i] = entry.Probe
+			}
+			continue
+		}
+		v.probed[entry.URL] = len(result.Probes)
+		result.Probes = append(result.Probes, entry.Probe)
 	}
-
-	fmt.Println("验证完成！")
-	return validEntries, finalValidEntries, nil
+	return nested, nil
 }
 
-func ValidateURL(url string, maxLatency time.Duration) (bool, error) {
-	fmt.Printf("正在验证: %s\n", url)
-	client := &http.Client{
-		Timeout: maxLatency * 2,
-		Transport: &http.Transport{
-			DisableKeepAlives:     true,
-			IdleConnTimeout:       maxLatency * 2,
-			ResponseHeaderTimeout: maxLatency * 2,
-		},
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return false, fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("请求失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return false, nil
-	}
-
-	buffer := make([]byte, 1024)
-	n, err := resp.Body.Read(buffer)
-	if err != nil && err != io.EOF {
-		return false, fmt.Errorf("读取内容失败: %w", err)
-	}
-
-	return n > 0, nil
+// ValidateURL 探测播放地址是否可以播放，opt 中的请求头会随请求一起发送
+// HLS 地址会依次获取主播放列表、一个码率的媒体播放列表和第一个分片，直播列表还会检查是否在更新
+func ValidateURL(ctx context.Context, url string, opt *types.StreamOption, maxLatency time.Duration) *types.ProbeResult {
+	return validateURL(ctx, url, opt, ValidateOptions{MaxLatency: maxLatency}, nil, nil)
 }
 
-func GetProcess() float64 {
-	processLock.RLock()
-	defer processLock.RUnlock()
-	if totalCount == 0 {
-		return 0
-	}
-	return float64(processCount) / float64(totalCount) * 100
+// validateURL 同 ValidateURL，使用 opts 中的最大延迟和是否检查直播列表更新
+// sources 为地址所属的播放列表，用于选择代理，dns 为解析结果的缓存
+func validateURL(ctx context.Context, url string, opt *types.StreamOption, opts ValidateOptions, sources []string, dns *httpclient.DNSCache) *types.ProbeResult {
+	fmt.Printf("正在验证: %s\n", url)
+	return newProber(ctx, opt, opts, sources, dns).run(url)
 }
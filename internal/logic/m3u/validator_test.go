@@ -0,0 +1,88 @@
+package m3u
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tv-server/internal/model/types"
+)
+
+func TestValidateAndUnique_Retry(t *testing.T) {
+	var flaky, missing int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky":
+			// 前两次返回 503，第三次恢复
+			if atomic.AddInt64(&flaky, 1) <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/missing":
+			atomic.AddInt64(&missing, 1)
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte{0x47, 0x40, 0x00, 0x10})
+	}))
+	defer server.Close()
+
+	entries := []Entry{{URL: server.URL + "/flaky"}, {URL: server.URL + "/missing"}}
+	result, err := ValidateAndUnique(context.Background(), nil, entries, ValidateOptions{
+		MaxLatency:   time.Second,
+		Retries:      2,
+		RetryBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Unique) != 1 || result.Unique[0].URL != entries[0].URL {
+		t.Fatalf("重试后应验证通过: %+v", result.Unique)
+	}
+	if attempts := result.Unique[0].Probe.Attempts; attempts != 3 {
+		t.Errorf("应探测 3 次，实际为 %d", attempts)
+	}
+	// 4xx 不是暂时性失败，不应重试
+	if n := atomic.LoadInt64(&missing); n != 1 {
+		t.Errorf("4xx 不应重试，实际请求 %d 次", n)
+	}
+}
+
+func TestValidateResult_Select(t *testing.T) {
+	probe := func(url string, valid bool) Entry {
+		return Entry{URL: url, Probe: &types.ProbeResult{URL: url, Valid: valid}}
+	}
+	result := &ValidateResult{Entries: []Entry{
+		probe("http://a/flaky", false), // 偶尔失败，成功比例高
+		probe("http://a/dying", true),  // 本次通过，但历史上大多失败
+		probe("http://a/down", false),  // 连续失败
+		probe("http://a/new", true),    // 没有统计
+		probe("http://a/flaky", false), // 重复的地址
+		{URL: "rtsp://a/live", Unverified: true},
+	}}
+	stats := map[string]*types.ProbeStats{
+		"http://a/flaky": {Checks: 10, Successes: 9, ConsecutiveFailures: 1},
+		"http://a/dying": {Checks: 10, Successes: 2},
+		"http://a/down":  {Checks: 10, Successes: 8, ConsecutiveFailures: 3},
+	}
+	result.Select(stats, HealthPolicy{MinSuccessRatio: 0.5, MaxConsecutiveFailures: 3})
+
+	var urls []string
+	for _, entry := range result.Unique {
+		urls = append(urls, entry.URL)
+	}
+	want := []string{"http://a/flaky", "http://a/new", "rtsp://a/live"}
+	if len(urls) != len(want) {
+		t.Fatalf("保留的地址不符合预期: %v", urls)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Fatalf("保留的地址不符合预期: %v", urls)
+		}
+	}
+	if len(result.Valid) != 4 {
+		t.Errorf("Valid 应包含重复的条目: %d", len(result.Valid))
+	}
+}
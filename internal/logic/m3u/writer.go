@@ -3,9 +3,105 @@ package m3u
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// attrOrder 输出 #EXTINF 时常用属性的顺序，其余属性按名称排列在后面
+var attrOrder = []string{
+	AttrTvgID, AttrTvgName, AttrTvgChno, AttrTvgLogo, AttrTvgLanguage, AttrTvgCountry,
+	AttrTvgShift, AttrGroupTitle, AttrRadio, AttrCatchup, AttrCatchupDays, AttrCatchupSource,
+}
+
+// attrKeyRe 可以输出的属性名，其余属性名会破坏 #EXTINF 行的结构
+var attrKeyRe = regexp.MustCompile(`^[A-Za-z0-9_.:\-]+$`)
+
+// lineReplacer 去掉单行字段中的换行
+var lineReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// Writer 输出 M3U 播放列表
+// 条目的 #EXTINF 行根据结构化的 ExtInf 重新生成，不直接输出原始的 Metadata
+type Writer struct {
+	w             *bufio.Writer
+	headerWritten bool
+}
+
+// NewWriter 创建输出到 w 的 Writer
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// WriteHeader 输出 #EXTM3U 头，需在第一个条目之前调用
+// 未调用时，第一次 WriteEntry 会先输出不带属性的头
+func (w *Writer) WriteHeader(h *Header) error {
+	if w.headerWritten {
+		return fmt.Errorf("#EXTM3U 头已输出")
+	}
+	w.headerWritten = true
+	_, err := fmt.Fprintln(w.w, FormatHeader(h))
+	return err
+}
+
+// WriteEntry 输出一个条目，依次为 #EXTINF、选项行和播放地址
+func (w *Writer) WriteEntry(entry Entry) error {
+	if entry.URL == "" {
+		return nil
+	}
+	if strings.ContainsAny(entry.URL, "\r\n") {
+		return fmt.Errorf("播放地址中包含换行: %q", entry.URL)
+	}
+	if !w.headerWritten {
+		if err := w.WriteHeader(nil); err != nil {
+			return err
+		}
+	}
+
+	info := entry.Info
+	if info == nil && entry.Metadata != "" {
+		// 属性格式不规范时仍使用已解析出的部分
+		info, _ = ParseExtInf(entry.Metadata)
+	}
+	if info == nil {
+		info = &ExtInf{Duration: -1, Title: entry.URL}
+	}
+
+	fmt.Fprintln(w.w, formatExtInf(info))
+	for _, line := range optionLines(entry.Options) {
+		fmt.Fprintln(w.w, line)
+	}
+	_, err := fmt.Fprintln(w.w, entry.URL)
+	return err
+}
+
+// Flush 将缓冲的内容写入底层的 io.Writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Write 输出完整的播放列表，头中合并各条目来源播放列表的节目单地址
+func Write(w io.Writer, entries []Entry) error {
+	var epgURLs []string
+	for _, entry := range entries {
+		epgURLs = MergeEPGURLs(epgURLs, entry.EPGURLs...)
+	}
+
+	writer := NewWriter(w)
+	if err := writer.WriteHeader(&Header{EPGURLs: epgURLs}); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := writer.WriteEntry(entry); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// WriteToFile 将播放列表写入文件
 func WriteToFile(entries []Entry, filename string) error {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -13,14 +109,72 @@ func WriteToFile(entries []Entry, filename string) error {
 	}
 	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	for _, entry := range entries {
-		if entry.Metadata != "" {
-			fmt.Fprintln(writer, entry.Metadata)
+	if err := Write(file, entries); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// FormatHeader 生成 #EXTM3U 行，节目单地址输出为 x-tvg-url，h 为空时只输出 #EXTM3U
+func FormatHeader(h *Header) string {
+	if h == nil {
+		return "#EXTM3U"
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U")
+	if len(h.EPGURLs) > 0 {
+		writeAttr(&b, AttrXTvgURL, strings.Join(h.EPGURLs, ","))
+	}
+	for _, key := range sortedKeys(h.Attrs) {
+		if key == AttrXTvgURL || key == AttrURLTvg {
+			continue
+		}
+		writeAttr(&b, key, h.Attrs[key])
+	}
+	return b.String()
+}
+
+// formatExtInf 根据结构化信息生成 #EXTINF 行
+// 常用属性按 attrOrder 排列，其余属性按名称排序；值中的双引号会被转义，换行会被去掉
+func formatExtInf(info *ExtInf) string {
+	var b strings.Builder
+	b.WriteString("#EXTINF:")
+	b.WriteString(strconv.FormatFloat(info.Duration, 'f', -1, 64))
+	for _, key := range orderedAttrKeys(info.Attrs) {
+		writeAttr(&b, key, info.Attrs[key])
+	}
+	b.WriteString(",")
+	b.WriteString(strings.TrimSpace(lineReplacer.Replace(info.Title)))
+	return b.String()
+}
+
+// writeAttr 输出 key="value"，非法的属性名会被跳过
+func writeAttr(b *strings.Builder, key, value string) {
+	if !attrKeyRe.MatchString(key) {
+		return
+	}
+	value = strings.ReplaceAll(lineReplacer.Replace(value), `"`, `\"`)
+	fmt.Fprintf(b, ` %s="%s"`, key, value)
+}
+
+// orderedAttrKeys 返回按输出顺序排列的属性名
+func orderedAttrKeys(attrs map[string]string) []string {
+	keys := make([]string, 0, len(attrs))
+	known := make(map[string]bool, len(attrOrder))
+	for _, key := range attrOrder {
+		known[key] = true
+		if _, ok := attrs[key]; ok {
+			keys = append(keys, key)
 		}
-		if entry.URL != "" {
-			fmt.Fprintln(writer, entry.URL)
+	}
+
+	var others []string
+	for key := range attrs {
+		if !known[key] {
+			others = append(others, key)
 		}
 	}
-	return writer.Flush()
+	sort.Strings(others)
+	return append(keys, others...)
 }
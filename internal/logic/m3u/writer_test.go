@@ -0,0 +1,69 @@
+package m3u
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"tv-server/internal/model/types"
+)
+
+func TestWrite_Canonical(t *testing.T) {
+	stream := &types.MediaStream{
+		StreamName:  "CCTV-1 \"综合\"",
+		ChannelName: "央视, 高清",
+		StreamLogo:  "http://example.com/cctv1.png",
+		TvgID:       "cctv1",
+		Catchup:     "append",
+		Attrs:       map[string]string{"x-custom": "a\nb", "bad key": "x"},
+		EpgUrl:      "http://epg.example.com/e.xml",
+		UrlInfo: map[string]*types.StreamUrlInfo{
+			"http://example.com/cctv1.m3u8": {Options: &types.StreamOption{UserAgent: "AptvPlayer/1.0"}},
+		},
+	}
+	entries := []Entry{
+		EntryFromStream(stream, "http://example.com/cctv1.m3u8"),
+		{Metadata: `#EXTINF:-1 group-title="新闻",,新闻频道`, URL: "http://example.com/news.m3u8"},
+		{URL: "http://example.com/bare.m3u8"},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	want := `#EXTM3U x-tvg-url="http://epg.example.com/e.xml"
+#EXTINF:-1 tvg-id="cctv1" tvg-logo="http://example.com/cctv1.png" group-title="央视, 高清" catchup="append" x-custom="a b",CCTV-1 "综合"
+#EXTVLCOPT:http-user-agent=AptvPlayer/1.0
+http://example.com/cctv1.m3u8
+#EXTINF:-1 group-title="新闻",,新闻频道
+http://example.com/news.m3u8
+#EXTINF:-1,http://example.com/bare.m3u8
+http://example.com/bare.m3u8
+`
+	if buf.String() != want {
+		t.Errorf("输出不符合预期:\n%s", buf.String())
+	}
+
+	// 输出的内容应能原样解析回来
+	playlist, err := ParseReader(strings.NewReader(buf.String()), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.WarningCount != 0 {
+		t.Errorf("输出内容不应产生解析警告: %v", playlist.Warnings)
+	}
+	parsed := ParseEntry(playlist.Entries)
+	if parsed[0].Channel != stream.ChannelName || parsed[0].Title != stream.StreamName || parsed[0].TvgID != "cctv1" {
+		t.Errorf("解析结果不符合预期: %+v", parsed[0])
+	}
+	if opt := playlist.Entries[0].Options; opt == nil || opt.UserAgent != "AptvPlayer/1.0" {
+		t.Errorf("选项应保留: %+v", opt)
+	}
+}
+
+func TestWriter_RejectsNewlineURL(t *testing.T) {
+	writer := NewWriter(&bytes.Buffer{})
+	if err := writer.WriteEntry(Entry{URL: "http://example.com/a\n#EXTINF:-1,注入"}); err == nil {
+		t.Error("包含换行的地址应返回错误")
+	}
+}
@@ -25,6 +25,16 @@ func (r *m3uRepository) collection() *mongo.Collection {
 	return r.client.Database("tv-server").Collection("m3u")
 }
 
+// urlCollection 保存各播放地址的附加信息，以 url 为唯一键
+func (r *m3uRepository) urlCollection() *mongo.Collection {
+	return r.client.Database("tv-server").Collection("stream_urls")
+}
+
+// healthCollection 保存各播放地址的验证记录
+func (r *m3uRepository) healthCollection() *mongo.Collection {
+	return r.client.Database("tv-server").Collection("url_health")
+}
+
 func (r *m3uRepository) Save(ctx *core.Context, stream *types.MediaStream) error {
 	now := time.Now().Unix()
 	if stream.CreatedAt == 0 {
@@ -38,21 +48,14 @@ func (r *m3uRepository) Save(ctx *core.Context, stream *types.MediaStream) error
 		"channelName": stream.ChannelName,
 	}
 
-	update := bson.M{
-		"$addToSet": bson.M{
-			"streamUrl": bson.M{
-				"$each": stream.StreamUrl,
-			},
-		},
-		"$set": bson.M{
-			"updatedAt":  stream.UpdatedAt,
-			"streamLogo": stream.StreamLogo,
-		},
-	}
+	update := streamUpdate(stream)
 
 	opts := options.Update().SetUpsert(true)
-	_, err := collection.UpdateOne(ctx.StdCtx, filter, update, opts)
-	return err
+	if _, err := collection.UpdateOne(ctx.StdCtx, filter, update, opts); err != nil {
+		return err
+	}
+
+	return r.saveUrlInfo(ctx, []*types.MediaStream{stream})
 }
 
 func (r *m3uRepository) BatchSave(ctx *core.Context, streams []*types.MediaStream) error {
@@ -83,17 +86,7 @@ func (r *m3uRepository) BatchSave(ctx *core.Context, streams []*types.MediaStrea
 				"channelName": stream.ChannelName,
 			}
 
-			update := bson.M{
-				"$addToSet": bson.M{
-					"streamUrl": bson.M{
-						"$each": stream.StreamUrl,
-					},
-				},
-				"$set": bson.M{
-					"updatedAt":  stream.UpdatedAt,
-					"streamLogo": stream.StreamLogo,
-				},
-			}
+			update := streamUpdate(stream)
 
 			operations = append(operations, mongo.NewUpdateOneModel().
 				SetFilter(filter).
@@ -107,11 +100,242 @@ func (r *m3uRepository) BatchSave(ctx *core.Context, streams []*types.MediaStrea
 				return fmt.Errorf("批量写入失败: %v", err)
 			}
 		}
+
+		if err := r.saveUrlInfo(ctx, batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveUrlInfo 写入各播放地址的请求选项和来源
+func (r *m3uRepository) saveUrlInfo(ctx *core.Context, streams []*types.MediaStream) error {
+	var operations []mongo.WriteModel
+	for _, stream := range streams {
+		for _, url := range stream.StreamUrl {
+			var (
+				opt            *types.StreamOption
+				source, origin string
+			)
+			if info := stream.UrlInfo[url]; info != nil {
+				opt, source, origin = info.Options, info.Source, info.Origin
+			}
+			set := bson.M{
+				"source":    source,
+				"origin":    origin,
+				"updatedAt": stream.UpdatedAt,
+			}
+			// 来自不带选项的播放列表（如 TXT）时保留原有的选项，以免丢失请求头导致无法播放
+			if !opt.IsEmpty() {
+				set["options"] = opt
+			}
+			operations = append(operations, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"url": url}).
+				SetUpdate(bson.M{"$set": set}).
+				SetUpsert(true))
+		}
+	}
+	if len(operations) == 0 {
+		return nil
+	}
+
+	_, err := r.urlCollection().BulkWrite(ctx.StdCtx, operations, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("写入播放地址信息失败: %v", err)
+	}
+	return nil
+}
+
+func (r *m3uRepository) SaveProbeResults(ctx *core.Context, results []*types.ProbeResult) (map[string]*types.ProbeStats, error) {
+	var operations []mongo.WriteModel
+	var urls []string
+	var history []interface{}
+	now := time.Now().Unix()
+	for _, result := range results {
+		history = append(history, types.NewHealthPoint(result))
+		set := bson.M{
+			"probe":     result,
+			"updatedAt": now,
+		}
+		inc := bson.M{"stats.checks": 1}
+		if result.Valid {
+			inc["stats.successes"] = 1
+			set["stats.consecutiveFailures"] = 0
+			set["stats.lastSuccessAt"] = now
+		} else {
+			inc["stats.consecutiveFailures"] = 1
+		}
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"url": result.URL}).
+			SetUpdate(bson.M{"$set": set, "$inc": inc, "$min": bson.M{"stats.firstCheckedAt": now}}).
+			SetUpsert(true))
+		urls = append(urls, result.URL)
+	}
+	stats := make(map[string]*types.ProbeStats, len(results))
+	if len(operations) == 0 {
+		return stats, nil
+	}
+
+	_, err := r.urlCollection().BulkWrite(ctx.StdCtx, operations, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return nil, fmt.Errorf("写入探测结果失败: %v", err)
+	}
+	if _, err := r.healthCollection().InsertMany(ctx.StdCtx, history, options.InsertMany().SetOrdered(false)); err != nil {
+		return nil, fmt.Errorf("写入验证记录失败: %v", err)
+	}
+
+	// 读回累计后的统计
+	cursor, err := r.urlCollection().Find(ctx.StdCtx, bson.M{"url": bson.M{"$in": urls}},
+		options.Find().SetProjection(bson.M{"url": 1, "stats": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("读取验证统计失败: %v", err)
+	}
+	defer cursor.Close(ctx.StdCtx)
+
+	var infos []*types.StreamUrlInfo
+	if err := cursor.All(ctx.StdCtx, &infos); err != nil {
+		return nil, fmt.Errorf("读取验证统计失败: %v", err)
+	}
+	for _, info := range infos {
+		if info.Stats != nil {
+			stats[info.URL] = info.Stats
+		}
+	}
+	return stats, nil
+}
+
+func (r *m3uRepository) GetHealthHistory(ctx *core.Context, urls []string, since int64) ([]*types.HealthPoint, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	return r.findHealth(ctx, bson.M{"url": bson.M{"$in": urls}, "time": bson.M{"$gte": since}})
+}
+
+// findHealth 按条件查询验证记录，按地址和时间排列
+func (r *m3uRepository) findHealth(ctx *core.Context, filter bson.M) ([]*types.HealthPoint, error) {
+	cursor, err := r.healthCollection().Find(ctx.StdCtx, filter,
+		options.Find().SetSort(bson.D{{Key: "url", Value: 1}, {Key: "time", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("读取验证记录失败: %v", err)
+	}
+	defer cursor.Close(ctx.StdCtx)
+
+	var points []*types.HealthPoint
+	if err := cursor.All(ctx.StdCtx, &points); err != nil {
+		return nil, fmt.Errorf("读取验证记录失败: %v", err)
+	}
+	return points, nil
+}
+
+func (r *m3uRepository) CompactHealthHistory(ctx *core.Context, rawBefore, span, expireBefore int64) error {
+	// 只汇总完整的时间段，避免同一时间段被拆成多条汇总记录
+	rawBefore -= rawBefore % span
+	rawFilter := bson.M{"span": 0, "time": bson.M{"$lt": rawBefore}}
+
+	raw, err := r.findHealth(ctx, rawFilter)
+	if err != nil {
+		return err
+	}
+	if len(raw) > 0 {
+		var merged []interface{}
+		for _, p := range types.DownsampleHealth(raw, span) {
+			merged = append(merged, p)
+		}
+		// 先写入汇总记录再删除原始记录，中途失败时最多重复计入，不会丢失
+		if _, err := r.healthCollection().InsertMany(ctx.StdCtx, merged, options.InsertMany().SetOrdered(false)); err != nil {
+			return fmt.Errorf("写入汇总记录失败: %v", err)
+		}
+		if _, err := r.healthCollection().DeleteMany(ctx.StdCtx, rawFilter); err != nil {
+			return fmt.Errorf("删除原始记录失败: %v", err)
+		}
+	}
+
+	if _, err := r.healthCollection().DeleteMany(ctx.StdCtx, bson.M{"time": bson.M{"$lt": expireBefore}}); err != nil {
+		return fmt.Errorf("删除过期记录失败: %v", err)
+	}
+	return nil
+}
+
+// loadUrlInfo 查询并填充各媒体流播放地址的附加信息
+func (r *m3uRepository) loadUrlInfo(ctx *core.Context, streams []*types.MediaStream) error {
+	var urls []string
+	for _, stream := range streams {
+		urls = append(urls, stream.StreamUrl...)
+		urls = append(urls, stream.ArchivedUrl...)
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	cursor, err := r.urlCollection().Find(ctx.StdCtx, bson.M{"url": bson.M{"$in": urls}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx.StdCtx)
+
+	var infos []*types.StreamUrlInfo
+	if err := cursor.All(ctx.StdCtx, &infos); err != nil {
+		return err
+	}
+
+	byURL := make(map[string]*types.StreamUrlInfo, len(infos))
+	for _, info := range infos {
+		byURL[info.URL] = info
+	}
+	for _, stream := range streams {
+		for _, url := range allUrls(stream) {
+			info, ok := byURL[url]
+			if !ok {
+				continue
+			}
+			if stream.UrlInfo == nil {
+				stream.UrlInfo = make(map[string]*types.StreamUrlInfo)
+			}
+			stream.UrlInfo[url] = info
+		}
 	}
 
 	return nil
 }
 
+// streamUpdate 构造媒体流的 upsert 更新语句
+func streamUpdate(stream *types.MediaStream) bson.M {
+	// 来自不带属性的播放列表（如 TXT、JSON、PLS）时保留原有的台标、EPG 和回看等信息
+	set := bson.M{"updatedAt": stream.UpdatedAt}
+	for field, value := range map[string]string{
+		"streamLogo":    stream.StreamLogo,
+		"tvgId":         stream.TvgID,
+		"tvgName":       stream.TvgName,
+		"tvgChno":       stream.TvgChno,
+		"tvgLanguage":   stream.TvgLanguage,
+		"tvgCountry":    stream.TvgCountry,
+		"radio":         stream.Radio,
+		"catchup":       stream.Catchup,
+		"catchupSource": stream.CatchupSource,
+		"catchupDays":   stream.CatchupDays,
+		"epgUrl":        stream.EpgUrl,
+	} {
+		if value != "" {
+			set[field] = value
+		}
+	}
+	if len(stream.Attrs) > 0 {
+		set["attrs"] = stream.Attrs
+	}
+	return bson.M{
+		"$addToSet": bson.M{
+			"streamUrl": bson.M{
+				"$each": stream.StreamUrl,
+			},
+		},
+		"$set": set,
+		"$setOnInsert": bson.M{
+			"createdAt": stream.CreatedAt,
+		},
+	}
+}
+
 func (r *m3uRepository) GetList(ctx *core.Context, filter *types.QueryFilter) ([]*types.MediaStream, error) {
 	collection := r.collection()
 
@@ -133,10 +357,167 @@ func (r *m3uRepository) GetList(ctx *core.Context, filter *types.QueryFilter) ([
 	if err := cursor.All(ctx.StdCtx, &streams); err != nil {
 		return nil, err
 	}
+	for _, stream := range streams {
+		excludeArchived(stream)
+	}
+
+	if err := r.loadUrlInfo(ctx, streams); err != nil {
+		return nil, err
+	}
 
 	return streams, nil
 }
 
+// excludeArchived 从 StreamUrl 中去掉已归档的地址，重新导入已归档的地址时两个数组中会同时存在该地址
+func excludeArchived(stream *types.MediaStream) {
+	if len(stream.ArchivedUrl) == 0 {
+		return
+	}
+	archived := make(map[string]bool, len(stream.ArchivedUrl))
+	for _, url := range stream.ArchivedUrl {
+		archived[url] = true
+	}
+	urls := make([]string, 0, len(stream.StreamUrl))
+	for _, url := range stream.StreamUrl {
+		if !archived[url] {
+			urls = append(urls, url)
+		}
+	}
+	stream.StreamUrl = urls
+}
+
+// allUrls 返回媒体流的所有播放地址，包括已归档的
+func allUrls(stream *types.MediaStream) []string {
+	urls := make([]string, 0, len(stream.StreamUrl)+len(stream.ArchivedUrl))
+	urls = append(urls, stream.StreamUrl...)
+	return append(urls, stream.ArchivedUrl...)
+}
+
+func (r *m3uRepository) ArchiveUrls(ctx *core.Context, urls []string, reason string) ([]string, error) {
+	archived, err := r.urlsMatching(ctx, urls, bson.M{"url": bson.M{"$in": urls}, "archive": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	served, err := r.servedAmong(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, url := range urls {
+		if served[url] && !archived[url] {
+			changed = append(changed, url)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	// 以往导入或从未验证过的地址可能没有地址记录，需要创建，否则之后无法恢复
+	archive := &types.UrlArchive{ArchivedAt: time.Now().Unix(), Reason: reason}
+	var operations []mongo.WriteModel
+	for _, url := range changed {
+		operations = append(operations, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"url": url}).
+			SetUpdate(bson.M{"$set": bson.M{"archive": archive}}).
+			SetUpsert(true))
+	}
+	if _, err := r.urlCollection().BulkWrite(ctx.StdCtx, operations, options.BulkWrite().SetOrdered(false)); err != nil {
+		return nil, fmt.Errorf("写入归档状态失败: %v", err)
+	}
+	if err := r.moveUrls(ctx, changed, "streamUrl", "archivedUrl"); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+func (r *m3uRepository) RestoreUrls(ctx *core.Context, urls []string, manual bool) ([]string, error) {
+	filter := bson.M{"url": bson.M{"$in": urls}, "archive": bson.M{"$exists": true}}
+	if !manual {
+		filter["archive.reason"] = bson.M{"$ne": types.ArchiveReasonManual}
+	}
+	archived, err := r.urlsMatching(ctx, urls, filter)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, url := range urls {
+		if archived[url] {
+			changed = append(changed, url)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	if _, err := r.urlCollection().UpdateMany(ctx.StdCtx, bson.M{"url": bson.M{"$in": changed}},
+		bson.M{"$unset": bson.M{"archive": ""}}); err != nil {
+		return nil, fmt.Errorf("清除归档状态失败: %v", err)
+	}
+	if err := r.moveUrls(ctx, changed, "archivedUrl", "streamUrl"); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// urlsMatching 返回 urls 中地址记录满足 filter 的地址
+func (r *m3uRepository) urlsMatching(ctx *core.Context, urls []string, filter bson.M) (map[string]bool, error) {
+	matched := make(map[string]bool)
+	if len(urls) == 0 {
+		return matched, nil
+	}
+	cursor, err := r.urlCollection().Find(ctx.StdCtx, filter, options.Find().SetProjection(bson.M{"url": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("读取归档状态失败: %v", err)
+	}
+	defer cursor.Close(ctx.StdCtx)
+
+	var infos []*types.StreamUrlInfo
+	if err := cursor.All(ctx.StdCtx, &infos); err != nil {
+		return nil, fmt.Errorf("读取归档状态失败: %v", err)
+	}
+	for _, info := range infos {
+		matched[info.URL] = true
+	}
+	return matched, nil
+}
+
+// servedAmong 返回 urls 中仍属于某个媒体流 StreamUrl 的地址
+func (r *m3uRepository) servedAmong(ctx *core.Context, urls []string) (map[string]bool, error) {
+	served := make(map[string]bool)
+	if len(urls) == 0 {
+		return served, nil
+	}
+	values, err := r.collection().Distinct(ctx.StdCtx, "streamUrl", bson.M{"streamUrl": bson.M{"$in": urls}})
+	if err != nil {
+		return nil, fmt.Errorf("读取播放地址失败: %v", err)
+	}
+	wanted := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		wanted[url] = true
+	}
+	for _, v := range values {
+		if url, ok := v.(string); ok && wanted[url] {
+			served[url] = true
+		}
+	}
+	return served, nil
+}
+
+// moveUrls 在所有媒体流中将 urls 从数组 from 移到数组 to
+func (r *m3uRepository) moveUrls(ctx *core.Context, urls []string, from, to string) error {
+	var operations []mongo.WriteModel
+	for _, url := range urls {
+		operations = append(operations, mongo.NewUpdateManyModel().
+			SetFilter(bson.M{from: url}).
+			SetUpdate(bson.M{"$pull": bson.M{from: url}, "$addToSet": bson.M{to: url}}))
+	}
+	_, err := r.collection().BulkWrite(ctx.StdCtx, operations, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("移动播放地址失败: %v", err)
+	}
+	return nil
+}
+
 func (r *m3uRepository) GetAllChannel(ctx *core.Context, filter *types.QueryFilter) ([]string, error) {
 	collection := r.collection()
 
@@ -189,3 +570,38 @@ func (r *m3uRepository) GetRecordNums(ctx *core.Context, filter *types.QueryFilt
 
 	return result, nil
 }
+
+func (r *m3uRepository) GetExistingUrls(ctx *core.Context, urls []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+	if len(urls) == 0 {
+		return result, nil
+	}
+
+	wanted := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		wanted[url] = true
+	}
+
+	// 已归档的地址同样视为已存在
+	cursor, err := r.collection().Find(ctx.StdCtx,
+		bson.M{"$or": []bson.M{{"streamUrl": bson.M{"$in": urls}}, {"archivedUrl": bson.M{"$in": urls}}}},
+		options.Find().SetProjection(bson.M{"streamUrl": 1, "archivedUrl": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx.StdCtx)
+
+	var streams []*types.MediaStream
+	if err := cursor.All(ctx.StdCtx, &streams); err != nil {
+		return nil, err
+	}
+	for _, stream := range streams {
+		for _, url := range allUrls(stream) {
+			if wanted[url] {
+				result[url] = true
+			}
+		}
+	}
+
+	return result, nil
+}
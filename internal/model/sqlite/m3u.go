@@ -2,7 +2,9 @@ package sqlite
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 	"tv-server/internal/model/types"
@@ -32,44 +34,10 @@ func (r *m3uRepository) Save(ctx *core.Context, stream *types.MediaStream) error
 	}
 	defer tx.Rollback()
 
-	// 插入或更新主记录
-	result, err := tx.ExecContext(ctx.StdCtx, `
-        INSERT INTO m3u (stream_name, channel_name, stream_logo, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?)
-        ON CONFLICT(stream_name, channel_name) DO UPDATE SET
-        stream_logo = ?,
-        updated_at = ?
-    `, stream.StreamName, stream.ChannelName, stream.StreamLogo, stream.CreatedAt, stream.UpdatedAt,
-		stream.StreamLogo, stream.UpdatedAt)
-	if err != nil {
+	if err := r.saveStream(ctx, tx, stream); err != nil {
 		return err
 	}
 
-	// 获取m3u记录的ID
-	var m3uID int64
-	if id, err := result.LastInsertId(); err == nil {
-		m3uID = id
-	} else {
-		// 如果是更新操作，需要查询ID
-		err = tx.QueryRowContext(ctx.StdCtx, `
-            SELECT id FROM m3u WHERE stream_name = ? AND channel_name = ?
-        `, stream.StreamName, stream.ChannelName).Scan(&m3uID)
-		if err != nil {
-			return err
-		}
-	}
-
-	// 插入URL记录
-	for _, url := range stream.StreamUrl {
-		_, err = tx.ExecContext(ctx.StdCtx, `
-            INSERT OR IGNORE INTO stream_urls (m3u_id, url)
-            VALUES (?, ?)
-        `, m3uID, url)
-		if err != nil {
-			return err
-		}
-	}
-
 	return tx.Commit()
 }
 
@@ -91,51 +59,99 @@ func (r *m3uRepository) BatchSave(ctx *core.Context, streams []*types.MediaStrea
 		}
 		stream.UpdatedAt = now
 
-		// 插入或更新主记录
-		result, err := tx.ExecContext(ctx.StdCtx, `
-            INSERT INTO m3u (stream_name, channel_name, stream_logo, created_at, updated_at)
-            VALUES (?, ?, ?, ?, ?)
-            ON CONFLICT(stream_name, channel_name) DO UPDATE SET
-            stream_logo = ?,
-            updated_at = ?
-        `, stream.StreamName, stream.ChannelName, stream.StreamLogo, stream.CreatedAt, stream.UpdatedAt,
-			stream.StreamLogo, stream.UpdatedAt)
-		if err != nil {
+		if err := r.saveStream(ctx, tx, stream); err != nil {
 			return err
 		}
+	}
 
-		// 获取m3u记录的ID
-		var m3uID int64
-		if id, err := result.LastInsertId(); err == nil {
-			m3uID = id
-		} else {
-			// 如果是更新操作，需要查询ID
-			err = tx.QueryRowContext(ctx.StdCtx, `
-                SELECT id FROM m3u WHERE stream_name = ? AND channel_name = ?
-            `, stream.StreamName, stream.ChannelName).Scan(&m3uID)
-			if err != nil {
-				return err
-			}
+	return tx.Commit()
+}
+
+// saveStream 在事务中插入或更新一条媒体流及其 URL 记录
+func (r *m3uRepository) saveStream(ctx *core.Context, tx *sql.Tx, stream *types.MediaStream) error {
+	var attrs string
+	if len(stream.Attrs) > 0 {
+		var err error
+		if attrs, err = marshalJSON(stream.Attrs); err != nil {
+			return err
 		}
+	}
+
+	// 插入或更新主记录，并取回记录ID
+	// 来自不带属性的播放列表（如 TXT、JSON、PLS）时保留原有的台标、EPG 和回看等信息
+	var m3uID int64
+	err := tx.QueryRowContext(ctx.StdCtx, `
+        INSERT INTO m3u (stream_name, channel_name, stream_logo, created_at, updated_at,
+            tvg_id, tvg_name, tvg_chno, tvg_language, tvg_country,
+            radio, catchup, catchup_source, catchup_days, attrs, epg_url)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT(stream_name, channel_name) DO UPDATE SET
+        updated_at = excluded.updated_at,
+        stream_logo = COALESCE(NULLIF(excluded.stream_logo, ''), stream_logo),
+        tvg_id = COALESCE(NULLIF(excluded.tvg_id, ''), tvg_id),
+        tvg_name = COALESCE(NULLIF(excluded.tvg_name, ''), tvg_name),
+        tvg_chno = COALESCE(NULLIF(excluded.tvg_chno, ''), tvg_chno),
+        tvg_language = COALESCE(NULLIF(excluded.tvg_language, ''), tvg_language),
+        tvg_country = COALESCE(NULLIF(excluded.tvg_country, ''), tvg_country),
+        radio = COALESCE(NULLIF(excluded.radio, ''), radio),
+        catchup = COALESCE(NULLIF(excluded.catchup, ''), catchup),
+        catchup_source = COALESCE(NULLIF(excluded.catchup_source, ''), catchup_source),
+        catchup_days = COALESCE(NULLIF(excluded.catchup_days, ''), catchup_days),
+        attrs = COALESCE(NULLIF(excluded.attrs, ''), attrs),
+        epg_url = COALESCE(NULLIF(excluded.epg_url, ''), epg_url)
+        RETURNING id
+    `, stream.StreamName, stream.ChannelName, stream.StreamLogo, stream.CreatedAt, stream.UpdatedAt,
+		stream.TvgID, stream.TvgName, stream.TvgChno, stream.TvgLanguage, stream.TvgCountry,
+		stream.Radio, stream.Catchup, stream.CatchupSource, stream.CatchupDays, attrs, stream.EpgUrl).Scan(&m3uID)
+	if err != nil {
+		return err
+	}
 
-		// 插入URL记录
-		for _, url := range stream.StreamUrl {
-			_, err = tx.ExecContext(ctx.StdCtx, `
-                INSERT OR IGNORE INTO stream_urls (m3u_id, url)
-                VALUES (?, ?)
-            `, m3uID, url)
-			if err != nil {
+	// 插入URL记录，同时更新其请求选项和来源
+	for _, url := range stream.StreamUrl {
+		var (
+			opt            *types.StreamOption
+			source, origin string
+		)
+		if info := stream.UrlInfo[url]; info != nil {
+			opt, source, origin = info.Options, info.Source, info.Origin
+		}
+		var options string
+		if !opt.IsEmpty() {
+			if options, err = marshalJSON(opt); err != nil {
 				return err
 			}
 		}
+
+		// 来自不带选项的播放列表（如 TXT）时保留原有的选项，以免丢失请求头导致无法播放
+		_, err = tx.ExecContext(ctx.StdCtx, `
+            INSERT INTO stream_urls (m3u_id, url, options, source, origin)
+            VALUES (?, ?, ?, ?, ?)
+            ON CONFLICT(m3u_id, url) DO UPDATE SET
+            options = COALESCE(NULLIF(excluded.options, ''), options),
+            source = excluded.source,
+            origin = excluded.origin
+        `, m3uID, url, options, source, origin)
+		if err != nil {
+			return err
+		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
+// urlSeparator GetList 中拼接播放地址使用的分隔符，即 SQL 中的 char(31)，播放地址可能包含逗号
+const urlSeparator = "\x1f"
+
 func (r *m3uRepository) GetList(ctx *core.Context, filter *types.QueryFilter) ([]*types.MediaStream, error) {
 	query := `
-        SELECT m.id, m.created_at, m.updated_at, m.stream_name, m.stream_logo, m.channel_name, GROUP_CONCAT(u.url) as urls
+        SELECT m.id, m.created_at, m.updated_at, m.stream_name, m.stream_logo, m.channel_name,
+            COALESCE(m.tvg_id, ''), COALESCE(m.tvg_name, ''), COALESCE(m.tvg_chno, ''),
+            COALESCE(m.tvg_language, ''), COALESCE(m.tvg_country, ''), COALESCE(m.radio, ''),
+            COALESCE(m.catchup, ''), COALESCE(m.catchup_source, ''), COALESCE(m.catchup_days, ''),
+            COALESCE(m.attrs, ''), COALESCE(m.epg_url, ''),
+            GROUP_CONCAT(CASE WHEN u.archived_at = 0 THEN u.url END, char(31)) as urls,
+            GROUP_CONCAT(CASE WHEN u.archived_at > 0 THEN u.url END, char(31)) as archived_urls
         FROM m3u m
         LEFT JOIN stream_urls u ON m.id = u.m3u_id
     `
@@ -176,16 +192,34 @@ func (r *m3uRepository) GetList(ctx *core.Context, filter *types.QueryFilter) ([
 	var streams []*types.MediaStream
 	for rows.Next() {
 		var stream types.MediaStream
-		var urls string
+		var attrs string
+		var urls, archivedUrls sql.NullString
 		if err := rows.Scan(&stream.ID, &stream.CreatedAt, &stream.UpdatedAt,
-			&stream.StreamName, &stream.StreamLogo, &stream.ChannelName, &urls); err != nil {
+			&stream.StreamName, &stream.StreamLogo, &stream.ChannelName,
+			&stream.TvgID, &stream.TvgName, &stream.TvgChno,
+			&stream.TvgLanguage, &stream.TvgCountry, &stream.Radio,
+			&stream.Catchup, &stream.CatchupSource, &stream.CatchupDays,
+			&attrs, &stream.EpgUrl, &urls, &archivedUrls); err != nil {
 			return nil, err
 		}
-		if urls != "" {
-			stream.StreamUrl = strings.Split(urls, ",")
+		if err := unmarshalJSON(attrs, &stream.Attrs); err != nil {
+			return nil, err
+		}
+		if urls.String != "" {
+			stream.StreamUrl = strings.Split(urls.String, urlSeparator)
+		}
+		if archivedUrls.String != "" {
+			stream.ArchivedUrl = strings.Split(archivedUrls.String, urlSeparator)
 		}
 		streams = append(streams, &stream)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadUrlInfo(ctx, streams); err != nil {
+		return nil, err
+	}
 
 	return streams, nil
 }
@@ -257,3 +291,393 @@ func (r *m3uRepository) GetRecordNums(ctx *core.Context, filter *types.QueryFilt
 
 	return result, nil
 }
+
+func (r *m3uRepository) GetExistingUrls(ctx *core.Context, urls []string) (map[string]bool, error) {
+	result := make(map[string]bool)
+
+	// 分批查询，避免超出 SQLite 的参数个数限制
+	const batchSize = 500
+	for i := 0; i < len(urls); i += batchSize {
+		end := i + batchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		batch := make([]interface{}, 0, end-i)
+		for _, url := range urls[i:end] {
+			batch = append(batch, url)
+		}
+
+		rows, err := r.db.QueryContext(ctx.StdCtx, fmt.Sprintf(`
+            SELECT DISTINCT url FROM stream_urls WHERE url IN (%s)
+        `, placeholders(len(batch))), batch...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var url string
+			if err := rows.Scan(&url); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result[url] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (r *m3uRepository) SaveProbeResults(ctx *core.Context, results []*types.ProbeResult) (map[string]*types.ProbeStats, error) {
+	stats := make(map[string]*types.ProbeStats, len(results))
+	if len(results) == 0 {
+		return stats, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx.StdCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	probeStmt, err := tx.PrepareContext(ctx.StdCtx, `UPDATE stream_urls SET probe = ? WHERE url = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer probeStmt.Close()
+
+	// 统计按地址保存，同一地址出现在多个频道中时共用一份
+	statsStmt, err := tx.PrepareContext(ctx.StdCtx, `
+        INSERT INTO url_stats (url, checks, successes, consecutive_failures, first_checked_at, last_success_at, updated_at)
+        VALUES (?, 1, ?, 1 - ?, ?, ?, ?)
+        ON CONFLICT(url) DO UPDATE SET
+            checks = checks + 1,
+            successes = successes + excluded.successes,
+            consecutive_failures = CASE WHEN excluded.successes > 0 THEN 0 ELSE consecutive_failures + 1 END,
+            first_checked_at = CASE WHEN first_checked_at = 0 THEN excluded.first_checked_at ELSE first_checked_at END,
+            last_success_at = CASE WHEN excluded.successes > 0 THEN excluded.last_success_at ELSE last_success_at END,
+            updated_at = excluded.updated_at
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer statsStmt.Close()
+
+	readStmt, err := tx.PrepareContext(ctx.StdCtx, `
+        SELECT checks, successes, consecutive_failures, first_checked_at, last_success_at FROM url_stats WHERE url = ?
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer readStmt.Close()
+
+	historyStmt, err := tx.PrepareContext(ctx.StdCtx, insertHealthSQL)
+	if err != nil {
+		return nil, err
+	}
+	defer historyStmt.Close()
+
+	now := time.Now().Unix()
+	for _, result := range results {
+		probe, err := marshalJSON(result)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := probeStmt.ExecContext(ctx.StdCtx, probe, result.URL); err != nil {
+			return nil, err
+		}
+
+		success, lastSuccess := 0, int64(0)
+		if result.Valid {
+			success, lastSuccess = 1, now
+		}
+		if _, err := statsStmt.ExecContext(ctx.StdCtx, result.URL, success, success, now, lastSuccess, now); err != nil {
+			return nil, err
+		}
+		s := &types.ProbeStats{}
+		if err := readStmt.QueryRowContext(ctx.StdCtx, result.URL).Scan(&s.Checks, &s.Successes, &s.ConsecutiveFailures,
+			&s.FirstCheckedAt, &s.LastSuccessAt); err != nil {
+			return nil, err
+		}
+		stats[result.URL] = s
+
+		if err := insertHealthPoint(ctx, historyStmt, types.NewHealthPoint(result)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// insertHealthSQL 写入一条验证记录，参数顺序见 insertHealthPoint
+const insertHealthSQL = `
+    INSERT INTO url_health (url, time, span, checks, successes, latency, error_class, failed_at)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+// insertHealthPoint 使用 insertHealthSQL 准备的语句写入一条验证记录
+func insertHealthPoint(ctx *core.Context, stmt *sql.Stmt, p *types.HealthPoint) error {
+	_, err := stmt.ExecContext(ctx.StdCtx, p.URL, p.Time, p.Span, p.Checks, p.Successes, p.Latency, p.ErrorClass, p.FailedAt)
+	return err
+}
+
+func (r *m3uRepository) GetHealthHistory(ctx *core.Context, urls []string, since int64) ([]*types.HealthPoint, error) {
+	var points []*types.HealthPoint
+
+	// 分批查询，避免超出 SQLite 的参数个数限制
+	const batchSize = 500
+	for i := 0; i < len(urls); i += batchSize {
+		end := i + batchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		args := []interface{}{since}
+		for _, url := range urls[i:end] {
+			args = append(args, url)
+		}
+
+		batch, err := r.queryHealth(ctx, fmt.Sprintf(`
+            WHERE time >= ? AND url IN (%s)
+        `, placeholders(end-i)), args...)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, batch...)
+	}
+
+	sort.SliceStable(points, func(i, j int) bool {
+		if points[i].URL != points[j].URL {
+			return points[i].URL < points[j].URL
+		}
+		return points[i].Time < points[j].Time
+	})
+	return points, nil
+}
+
+// queryHealth 按条件查询 url_health 中的验证记录，按地址和时间排列
+func (r *m3uRepository) queryHealth(ctx *core.Context, where string, args ...interface{}) ([]*types.HealthPoint, error) {
+	rows, err := r.db.QueryContext(ctx.StdCtx, `
+        SELECT url, time, span, checks, successes, latency, COALESCE(error_class, ''), failed_at
+        FROM url_health
+    `+where+" ORDER BY url, time", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []*types.HealthPoint
+	for rows.Next() {
+		p := &types.HealthPoint{}
+		if err := rows.Scan(&p.URL, &p.Time, &p.Span, &p.Checks, &p.Successes, &p.Latency, &p.ErrorClass, &p.FailedAt); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+func (r *m3uRepository) CompactHealthHistory(ctx *core.Context, rawBefore, span, expireBefore int64) error {
+	// 只汇总完整的时间段，避免同一时间段被拆成多条汇总记录
+	rawBefore -= rawBefore % span
+
+	raw, err := r.queryHealth(ctx, "WHERE span = 0 AND time < ?", rawBefore)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTx(ctx.StdCtx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(raw) > 0 {
+		if _, err := tx.ExecContext(ctx.StdCtx, `DELETE FROM url_health WHERE span = 0 AND time < ?`, rawBefore); err != nil {
+			return err
+		}
+		stmt, err := tx.PrepareContext(ctx.StdCtx, insertHealthSQL)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, p := range types.DownsampleHealth(raw, span) {
+			if err := insertHealthPoint(ctx, stmt, p); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx.StdCtx, `DELETE FROM url_health WHERE time < ?`, expireBefore); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *m3uRepository) ArchiveUrls(ctx *core.Context, urls []string, reason string) ([]string, error) {
+	return r.setArchived(ctx, urls, "archived_at = 0", time.Now().Unix(), reason)
+}
+
+func (r *m3uRepository) RestoreUrls(ctx *core.Context, urls []string, manual bool) ([]string, error) {
+	cond := "archived_at > 0"
+	if !manual {
+		cond += fmt.Sprintf(" AND archive_reason <> '%s'", types.ArchiveReasonManual)
+	}
+	return r.setArchived(ctx, urls, cond, 0, "")
+}
+
+// setArchived 将 urls 中满足 cond 的播放地址的归档状态设置为 archivedAt 和 reason，返回被更新的地址
+func (r *m3uRepository) setArchived(ctx *core.Context, urls []string, cond string, archivedAt int64, reason string) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx.StdCtx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var changed []string
+	// 分批处理，避免超出 SQLite 的参数个数限制
+	const batchSize = 500
+	for i := 0; i < len(urls); i += batchSize {
+		end := i + batchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		batch := make([]interface{}, 0, end-i)
+		for _, url := range urls[i:end] {
+			batch = append(batch, url)
+		}
+		where := fmt.Sprintf("%s AND url IN (%s)", cond, placeholders(len(batch)))
+
+		rows, err := tx.QueryContext(ctx.StdCtx, "SELECT DISTINCT url FROM stream_urls WHERE "+where, batch...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var url string
+			if err := rows.Scan(&url); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			changed = append(changed, url)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		args := append([]interface{}{archivedAt, reason}, batch...)
+		if _, err := tx.ExecContext(ctx.StdCtx, "UPDATE stream_urls SET archived_at = ?, archive_reason = ? WHERE "+where, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// loadUrlInfo 查询并填充各媒体流播放地址的附加信息
+func (r *m3uRepository) loadUrlInfo(ctx *core.Context, streams []*types.MediaStream) error {
+	byID := make(map[string]*types.MediaStream, len(streams))
+	ids := make([]interface{}, 0, len(streams))
+	for _, stream := range streams {
+		byID[stream.ID] = stream
+		ids = append(ids, stream.ID)
+	}
+
+	// 分批查询，避免超出 SQLite 的参数个数限制
+	const batchSize = 500
+	for i := 0; i < len(ids); i += batchSize {
+		end := i + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[i:end]
+
+		rows, err := r.db.QueryContext(ctx.StdCtx, fmt.Sprintf(`
+            SELECT u.m3u_id, u.url, COALESCE(u.options, ''), COALESCE(u.source, ''), COALESCE(u.origin, ''),
+                COALESCE(u.probe, ''), u.archived_at, COALESCE(u.archive_reason, ''),
+                COALESCE(s.checks, 0), COALESCE(s.successes, 0), COALESCE(s.consecutive_failures, 0),
+                COALESCE(s.first_checked_at, 0), COALESCE(s.last_success_at, 0)
+            FROM stream_urls u
+            LEFT JOIN url_stats s ON s.url = u.url
+            WHERE u.m3u_id IN (%s)
+        `, placeholders(len(batch))), batch...)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var m3uID, options, probe string
+			var stats types.ProbeStats
+			var archive types.UrlArchive
+			info := &types.StreamUrlInfo{}
+			if err := rows.Scan(&m3uID, &info.URL, &options, &info.Source, &info.Origin, &probe,
+				&archive.ArchivedAt, &archive.Reason,
+				&stats.Checks, &stats.Successes, &stats.ConsecutiveFailures,
+				&stats.FirstCheckedAt, &stats.LastSuccessAt); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := unmarshalJSON(options, &info.Options); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := unmarshalJSON(probe, &info.Probe); err != nil {
+				rows.Close()
+				return err
+			}
+			if stats.Checks > 0 {
+				info.Stats = &stats
+			}
+			if archive.ArchivedAt > 0 {
+				info.Archive = &archive
+			}
+
+			stream := byID[m3uID]
+			if stream == nil {
+				continue
+			}
+			if stream.UrlInfo == nil {
+				stream.UrlInfo = make(map[string]*types.StreamUrlInfo)
+			}
+			stream.UrlInfo[info.URL] = info
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placeholders 生成 n 个以逗号分隔的 SQL 占位符
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// marshalJSON 将附加数据序列化为 JSON 文本，空值存为空字符串
+func marshalJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	if string(data) == "null" {
+		return "", nil
+	}
+	return string(data), nil
+}
+
+// unmarshalJSON 解析 JSON 文本，空字符串视为无数据
+func unmarshalJSON(data string, v interface{}) error {
+	if data == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), v)
+}
@@ -70,6 +70,17 @@ func (p *sqliteProvider) createTables(db *sql.DB) error {
             stream_name TEXT NOT NULL,
             stream_logo TEXT,
             channel_name TEXT NOT NULL,
+            tvg_id TEXT,
+            tvg_name TEXT,
+            tvg_chno TEXT,
+            tvg_language TEXT,
+            tvg_country TEXT,
+            radio TEXT,
+            catchup TEXT,
+            catchup_source TEXT,
+            catchup_days TEXT,
+            attrs TEXT,
+            epg_url TEXT,
             UNIQUE(stream_name, channel_name)
         );
 
@@ -77,14 +88,121 @@ func (p *sqliteProvider) createTables(db *sql.DB) error {
             id INTEGER PRIMARY KEY AUTOINCREMENT,
             m3u_id INTEGER NOT NULL,
             url TEXT NOT NULL,
+            options TEXT,
+            source TEXT,
+            origin TEXT,
+            probe TEXT,
+            archived_at INTEGER NOT NULL DEFAULT 0,
+            archive_reason TEXT,
             FOREIGN KEY(m3u_id) REFERENCES m3u(id) ON DELETE CASCADE,
             UNIQUE(m3u_id, url)
         );
 
+        CREATE TABLE IF NOT EXISTS url_stats (
+            url TEXT PRIMARY KEY,
+            checks INTEGER NOT NULL DEFAULT 0,
+            successes INTEGER NOT NULL DEFAULT 0,
+            consecutive_failures INTEGER NOT NULL DEFAULT 0,
+            first_checked_at INTEGER NOT NULL DEFAULT 0,
+            last_success_at INTEGER NOT NULL DEFAULT 0,
+            updated_at INTEGER NOT NULL
+        );
+
+        CREATE TABLE IF NOT EXISTS url_health (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            url TEXT NOT NULL,
+            time INTEGER NOT NULL,
+            span INTEGER NOT NULL DEFAULT 0,
+            checks INTEGER NOT NULL,
+            successes INTEGER NOT NULL,
+            latency INTEGER NOT NULL DEFAULT 0,
+            error_class TEXT,
+            failed_at INTEGER NOT NULL DEFAULT 0
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_url_health_url_time ON url_health(url, time);
+        CREATE INDEX IF NOT EXISTS idx_url_health_span_time ON url_health(span, time);
         CREATE INDEX IF NOT EXISTS idx_m3u_channel_name ON m3u(channel_name);
         CREATE INDEX IF NOT EXISTS idx_m3u_stream_name ON m3u(stream_name);
     `)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// 为旧版本创建的表补充新增的列
+	if err = p.addMissingColumns(db, "stream_urls", []columnDef{
+		{"options", "TEXT"},
+		{"source", "TEXT"},
+		{"origin", "TEXT"},
+		{"probe", "TEXT"},
+		{"archived_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"archive_reason", "TEXT"},
+	}); err != nil {
+		return err
+	}
+	if err = p.addMissingColumns(db, "url_stats", []columnDef{
+		{"first_checked_at", "INTEGER NOT NULL DEFAULT 0"},
+		{"last_success_at", "INTEGER NOT NULL DEFAULT 0"},
+	}); err != nil {
+		return err
+	}
+	return p.addMissingColumns(db, "m3u", []columnDef{
+		{"tvg_id", "TEXT"},
+		{"tvg_name", "TEXT"},
+		{"tvg_chno", "TEXT"},
+		{"tvg_language", "TEXT"},
+		{"tvg_country", "TEXT"},
+		{"radio", "TEXT"},
+		{"catchup", "TEXT"},
+		{"catchup_source", "TEXT"},
+		{"catchup_days", "TEXT"},
+		{"attrs", "TEXT"},
+		{"epg_url", "TEXT"},
+	})
+}
+
+type columnDef struct {
+	name    string
+	typeDef string
+}
+
+// addMissingColumns 检查表结构，添加不存在的列
+func (p *sqliteProvider) addMissingColumns(db *sql.DB, table string, columns []columnDef) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, col := range columns {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, col.name, col.typeDef)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %v", table, col.name, err)
+		}
+	}
+	return nil
 }
 
 func (p *sqliteProvider) M3U() types.M3URepository {
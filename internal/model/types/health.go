@@ -0,0 +1,106 @@
+package types
+
+import "sort"
+
+// HealthPoint 播放地址的验证记录，原始记录为单次验证，降采样后为一个时间段内所有验证的汇总
+type HealthPoint struct {
+	URL        string `json:"url,omitempty" bson:"url"`
+	Time       int64  `json:"time" bson:"time"`                                 // 验证时间，降采样后为时间段的开始
+	Span       int64  `json:"span,omitempty" bson:"span"`                       // 时间段的秒数，原始记录为 0
+	Checks     int    `json:"checks" bson:"checks"`                             // 验证次数
+	Successes  int    `json:"successes" bson:"successes"`                       // 验证通过的次数
+	Latency    int64  `json:"latency,omitempty" bson:"latency"`                 // 验证通过时的平均耗时，毫秒
+	ErrorClass string `json:"errorClass,omitempty" bson:"errorClass,omitempty"` // 最后一次失败的原因
+	FailedAt   int64  `json:"failedAt,omitempty" bson:"failedAt,omitempty"`     // 最后一次失败的时间
+}
+
+// NewHealthPoint 将一次探测结果转换为原始验证记录
+func NewHealthPoint(result *ProbeResult) *HealthPoint {
+	p := &HealthPoint{URL: result.URL, Time: result.ProbedAt, Checks: 1}
+	if result.Valid {
+		p.Successes = 1
+		p.Latency = result.Latency
+	} else {
+		p.ErrorClass = result.ErrorClass
+		p.FailedAt = result.ProbedAt
+	}
+	return p
+}
+
+// add 将 other 累加到 p 中
+func (p *HealthPoint) add(other *HealthPoint) {
+	if successes := p.Successes + other.Successes; successes > 0 {
+		p.Latency = (p.Latency*int64(p.Successes) + other.Latency*int64(other.Successes)) / int64(successes)
+	}
+	p.Checks += other.Checks
+	p.Successes += other.Successes
+	if other.FailedAt > p.FailedAt {
+		p.FailedAt = other.FailedAt
+		p.ErrorClass = other.ErrorClass
+	}
+}
+
+// DownsampleHealth 将记录按地址和长度为 span 秒的时间段汇总，结果按地址和时间排列
+// 原有的汇总记录跨越多个时间段时计入其开始时间所在的时间段
+func DownsampleHealth(points []*HealthPoint, span int64) []*HealthPoint {
+	type key struct {
+		url  string
+		time int64
+	}
+	buckets := make(map[key]*HealthPoint)
+	var result []*HealthPoint
+	for _, p := range points {
+		k := key{p.URL, p.Time - p.Time%span}
+		bucket := buckets[k]
+		if bucket == nil {
+			bucket = &HealthPoint{URL: p.URL, Time: k.time, Span: span}
+			buckets[k] = bucket
+			result = append(result, bucket)
+		}
+		bucket.add(p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].URL != result[j].URL {
+			return result[i].URL < result[j].URL
+		}
+		return result[i].Time < result[j].Time
+	})
+	return result
+}
+
+// HealthSummary 一段时间内的可用性统计
+type HealthSummary struct {
+	Checks      int            `json:"checks"`
+	Successes   int            `json:"successes"`
+	Uptime      float64        `json:"uptime"`     // 验证通过的百分比，没有记录时为 0
+	AvgLatency  int64          `json:"avgLatency"` // 验证通过时的平均耗时，毫秒
+	LastFailure *HealthFailure `json:"lastFailure,omitempty"`
+}
+
+// HealthFailure 最近一次验证失败
+type HealthFailure struct {
+	URL        string `json:"url"`
+	Time       int64  `json:"time"`
+	ErrorClass string `json:"errorClass,omitempty"`
+}
+
+// SummarizeHealth 汇总记录的可用性，记录可以来自多个地址
+func SummarizeHealth(points []*HealthPoint) *HealthSummary {
+	total := &HealthPoint{}
+	var last *HealthPoint
+	for _, p := range points {
+		total.add(p)
+		if p.FailedAt > 0 && (last == nil || p.FailedAt > last.FailedAt) {
+			last = p
+		}
+	}
+
+	s := &HealthSummary{Checks: total.Checks, Successes: total.Successes, AvgLatency: total.Latency}
+	if total.Checks > 0 {
+		s.Uptime = float64(total.Successes) * 100 / float64(total.Checks)
+	}
+	if last != nil {
+		s.LastFailure = &HealthFailure{URL: last.URL, Time: last.FailedAt, ErrorClass: last.ErrorClass}
+	}
+	return s
+}
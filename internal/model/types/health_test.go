@@ -0,0 +1,46 @@
+package types
+
+import "testing"
+
+func TestDownsampleHealth(t *testing.T) {
+	probes := []*ProbeResult{
+		{URL: "http://a/1", Valid: true, Latency: 100, ProbedAt: 3600},
+		{URL: "http://a/1", Valid: false, ErrorClass: ProbeErrorTimeout, ProbedAt: 4000},
+		{URL: "http://a/1", Valid: true, Latency: 300, ProbedAt: 7100},
+		{URL: "http://a/1", Valid: false, ErrorClass: ProbeErrorRefused, ProbedAt: 7300},
+		{URL: "http://a/2", Valid: true, Latency: 50, ProbedAt: 3700},
+	}
+	var raw []*HealthPoint
+	for _, probe := range probes {
+		raw = append(raw, NewHealthPoint(probe))
+	}
+
+	points := DownsampleHealth(raw, 3600)
+	if len(points) != 3 {
+		t.Fatalf("应汇总为 3 个时间段: %+v", points)
+	}
+	first := points[0]
+	if first.URL != "http://a/1" || first.Time != 3600 || first.Span != 3600 || first.Checks != 3 || first.Successes != 2 ||
+		first.Latency != 200 || first.ErrorClass != ProbeErrorTimeout || first.FailedAt != 4000 {
+		t.Errorf("第一个时间段不符合预期: %+v", first)
+	}
+	if points[1].Time != 7200 || points[1].Checks != 1 || points[1].ErrorClass != ProbeErrorRefused {
+		t.Errorf("第二个时间段不符合预期: %+v", points[1])
+	}
+
+	// 汇总前后的统计应一致
+	before, after := SummarizeHealth(raw), SummarizeHealth(points)
+	if *before.LastFailure != *after.LastFailure || before.Checks != after.Checks || before.AvgLatency != after.AvgLatency {
+		t.Errorf("汇总前后的统计不一致: %+v, %+v", before, after)
+	}
+	if after.Checks != 5 || after.Successes != 3 || after.Uptime != 60 || after.AvgLatency != 150 {
+		t.Errorf("统计不符合预期: %+v", after)
+	}
+	if f := after.LastFailure; f.URL != "http://a/1" || f.Time != 7300 || f.ErrorClass != ProbeErrorRefused {
+		t.Errorf("最近一次失败不符合预期: %+v", f)
+	}
+
+	if s := SummarizeHealth(nil); s.Checks != 0 || s.Uptime != 0 || s.LastFailure != nil {
+		t.Errorf("没有记录时的统计不符合预期: %+v", s)
+	}
+}
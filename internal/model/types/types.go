@@ -21,13 +21,153 @@ type M3UEntry struct {
 
 // MediaStream 定义媒体流信息结构
 type MediaStream struct {
-	ID          string   `json:"id"`
-	CreatedAt   int64    `json:"createdAt"`
-	UpdatedAt   int64    `json:"updatedAt"`
-	StreamName  string   `json:"streamName"`
-	StreamLogo  string   `json:"streamLogo"`
-	ChannelName string   `json:"channelName"`
-	StreamUrl   []string `json:"streamUrl"`
+	ID          string   `json:"id" bson:"_id,omitempty"`
+	CreatedAt   int64    `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   int64    `json:"updatedAt" bson:"updatedAt"`
+	StreamName  string   `json:"streamName" bson:"streamName"`
+	StreamLogo  string   `json:"streamLogo" bson:"streamLogo"`
+	ChannelName string   `json:"channelName" bson:"channelName"`
+	StreamUrl   []string `json:"streamUrl" bson:"streamUrl"`
+
+	// ArchivedUrl 已归档的播放地址，不出现在 StreamUrl 中，也不会写入播放列表
+	ArchivedUrl []string `json:"archivedUrl,omitempty" bson:"archivedUrl,omitempty"`
+
+	// 以下为 #EXTINF 中的附加属性
+	TvgID         string            `json:"tvgId,omitempty" bson:"tvgId,omitempty"`
+	TvgName       string            `json:"tvgName,omitempty" bson:"tvgName,omitempty"`
+	TvgChno       string            `json:"tvgChno,omitempty" bson:"tvgChno,omitempty"`
+	TvgLanguage   string            `json:"tvgLanguage,omitempty" bson:"tvgLanguage,omitempty"`
+	TvgCountry    string            `json:"tvgCountry,omitempty" bson:"tvgCountry,omitempty"`
+	Radio         string            `json:"radio,omitempty" bson:"radio,omitempty"`
+	Catchup       string            `json:"catchup,omitempty" bson:"catchup,omitempty"`
+	CatchupSource string            `json:"catchupSource,omitempty" bson:"catchupSource,omitempty"`
+	CatchupDays   string            `json:"catchupDays,omitempty" bson:"catchupDays,omitempty"`
+	Attrs         map[string]string `json:"attrs,omitempty" bson:"attrs,omitempty"` // 其余未识别的属性
+
+	// EpgUrl 导入时播放列表头中声明的节目单地址，多个地址以逗号分隔
+	EpgUrl string `json:"epgUrl,omitempty" bson:"epgUrl,omitempty"`
+
+	// UrlInfo 各播放地址的附加信息，key 为播放地址
+	UrlInfo map[string]*StreamUrlInfo `json:"urlInfo,omitempty" bson:"-"`
+}
+
+// StreamUrlInfo 定义单个播放地址的附加信息
+type StreamUrlInfo struct {
+	URL     string        `json:"url" bson:"url"`
+	Options *StreamOption `json:"options,omitempty" bson:"options,omitempty"`
+
+	// Source 播放地址来自嵌套播放列表时为该列表的地址
+	Source string `json:"source,omitempty" bson:"source,omitempty"`
+
+	// Origin 播放地址所属的远程播放列表地址，用于按来源选择代理
+	Origin string `json:"origin,omitempty" bson:"origin,omitempty"`
+
+	// Probe 最近一次的探测结果
+	Probe *ProbeResult `json:"probe,omitempty" bson:"probe,omitempty"`
+
+	// Stats 历次验证的统计
+	Stats *ProbeStats `json:"stats,omitempty" bson:"stats,omitempty"`
+
+	// Archive 已归档时的归档信息
+	Archive *UrlArchive `json:"archive,omitempty" bson:"archive,omitempty"`
+}
+
+// UrlArchive 定义播放地址的归档信息
+type UrlArchive struct {
+	ArchivedAt int64  `json:"archivedAt" bson:"archivedAt"`
+	Reason     string `json:"reason" bson:"reason"`
+}
+
+// 归档的原因
+const (
+	ArchiveReasonFailures = "consecutive_failures" // 连续失败次数过多
+	ArchiveReasonDead     = "no_success"           // 长时间没有验证通过
+	ArchiveReasonManual   = "manual"               // 手动归档
+)
+
+// ProbeStats 定义播放地址历次验证的统计，每次验证（含重试）计一次
+type ProbeStats struct {
+	Checks              int `json:"checks" bson:"checks"`
+	Successes           int `json:"successes" bson:"successes"`
+	ConsecutiveFailures int `json:"consecutiveFailures" bson:"consecutiveFailures"`
+
+	FirstCheckedAt int64 `json:"firstCheckedAt,omitempty" bson:"firstCheckedAt,omitempty"` // 第一次验证的时间
+	LastSuccessAt  int64 `json:"lastSuccessAt,omitempty" bson:"lastSuccessAt,omitempty"`   // 最近一次验证通过的时间
+}
+
+// SuccessRatio 返回验证成功的比例，没有验证记录时返回 0
+func (s *ProbeStats) SuccessRatio() float64 {
+	if s == nil || s.Checks == 0 {
+		return 0
+	}
+	return float64(s.Successes) / float64(s.Checks)
+}
+
+// 探测失败的原因分类
+const (
+	ProbeErrorDNS        = "dns"         // 域名解析失败
+	ProbeErrorRefused    = "refused"     // 连接被拒绝
+	ProbeErrorTimeout    = "timeout"     // 连接或读取超时
+	ProbeErrorReset      = "reset"       // 连接被重置或提前关闭
+	ProbeErrorHTTP4xx    = "http_4xx"    // 服务器返回 4xx
+	ProbeErrorHTTP5xx    = "http_5xx"    // 服务器返回 5xx
+	ProbeErrorBadContent = "bad_content" // 返回的内容不是可播放的媒体流
+	ProbeErrorHostDown   = "host_down"   // 同一主机多次解析失败或拒绝连接，未探测直接判为失败
+	ProbeErrorNestedList = "nested_list" // 返回的是另一个频道列表，不是媒体流，验证时展开其中的条目
+	ProbeErrorOther      = "other"
+)
+
+// 从内容识别出的封装格式
+const (
+	ContainerHLS    = "hls"
+	ContainerMPEGTS = "mpegts"
+	ContainerFLV    = "flv"
+)
+
+// ProbeResult 定义单个播放地址的探测结果
+type ProbeResult struct {
+	URL         string `json:"url" bson:"url"`
+	Valid       bool   `json:"valid" bson:"valid"`
+	ErrorClass  string `json:"errorClass,omitempty" bson:"errorClass,omitempty"`
+	Error       string `json:"error,omitempty" bson:"error,omitempty"`
+	StatusCode  int    `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	FinalURL    string `json:"finalUrl,omitempty" bson:"finalUrl,omitempty"` // 重定向后的地址
+	ContentType string `json:"contentType,omitempty" bson:"contentType,omitempty"`
+
+	TTFB       int64 `json:"ttfb" bson:"ttfb"`             // 首字节时间，毫秒
+	Latency    int64 `json:"latency" bson:"latency"`       // 完成探测的总耗时，毫秒，不含等待直播列表更新的时间
+	Throughput int64 `json:"throughput" bson:"throughput"` // 下载速度，kbps
+
+	// 以下来自 HLS 主播放列表中选中码率的 EXT-X-STREAM-INF
+	Bandwidth  int64  `json:"bandwidth,omitempty" bson:"bandwidth,omitempty"`
+	Resolution string `json:"resolution,omitempty" bson:"resolution,omitempty"`
+	Codecs     string `json:"codecs,omitempty" bson:"codecs,omitempty"`
+
+	// 以下来自媒体数据的开头，HLS 为第一个分片中的编码
+	Container   string   `json:"container,omitempty" bson:"container,omitempty"`
+	VideoCodecs []string `json:"videoCodecs,omitempty" bson:"videoCodecs,omitempty"`
+	AudioCodecs []string `json:"audioCodecs,omitempty" bson:"audioCodecs,omitempty"`
+
+	Live           bool  `json:"live" bson:"live"`                                         // HLS 直播列表
+	Stale          bool  `json:"stale" bson:"stale"`                                       // 直播列表在两次获取之间没有更新
+	StaleUnchecked bool  `json:"staleUnchecked,omitempty" bson:"staleUnchecked,omitempty"` // 直播列表没有检查是否更新：设置了跳过检查，或分片时长超出可等待的时间
+	Attempts       int   `json:"attempts,omitempty" bson:"attempts,omitempty"`             // 包括重试在内的探测次数
+	ProbedAt       int64 `json:"probedAt" bson:"probedAt"`
+}
+
+// StreamOption 定义播放地址的请求选项，来自 #EXTVLCOPT、#KODIPROP 和 #EXTHTTP
+type StreamOption struct {
+	UserAgent string            `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	Referrer  string            `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty" bson:"headers,omitempty"`     // 额外的请求头
+	VLCOpts   map[string]string `json:"vlcOpts,omitempty" bson:"vlcOpts,omitempty"`     // 其余 #EXTVLCOPT 选项
+	KodiProps map[string]string `json:"kodiProps,omitempty" bson:"kodiProps,omitempty"` // #KODIPROP 选项
+}
+
+// IsEmpty 判断是否没有任何选项，nil 视为空
+func (o *StreamOption) IsEmpty() bool {
+	return o == nil || (o.UserAgent == "" && o.Referrer == "" &&
+		len(o.Headers) == 0 && len(o.VLCOpts) == 0 && len(o.KodiProps) == 0)
 }
 
 // QueryFilter 定义查询过滤条件
@@ -72,6 +212,25 @@ type M3URepository interface {
 
 	// GetRecordNums 获取各频道的记录数
 	GetRecordNums(ctx *core.Context, filter *QueryFilter) (map[string]int64, error)
+
+	// GetExistingUrls 返回 urls 中已存在于数据库的播放地址
+	GetExistingUrls(ctx *core.Context, urls []string) (map[string]bool, error)
+
+	// SaveProbeResults 按播放地址保存探测结果并累计验证统计，同时追加验证记录，返回更新后的统计，key 为播放地址
+	SaveProbeResults(ctx *core.Context, results []*ProbeResult) (map[string]*ProbeStats, error)
+
+	// GetHealthHistory 返回 urls 自 since 起的验证记录，按地址和时间排列
+	GetHealthHistory(ctx *core.Context, urls []string, since int64) ([]*HealthPoint, error)
+
+	// CompactHealthHistory 将 rawBefore 之前的原始验证记录按 span 秒汇总，并删除 expireBefore 之前的记录
+	CompactHealthHistory(ctx *core.Context, rawBefore, span, expireBefore int64) error
+
+	// ArchiveUrls 归档 urls 中尚未归档的播放地址，所有频道中的该地址都会移出 StreamUrl，返回本次归档的地址
+	ArchiveUrls(ctx *core.Context, urls []string, reason string) ([]string, error)
+
+	// RestoreUrls 恢复 urls 中已归档的播放地址，返回本次恢复的地址
+	// manual 为 false 时是验证通过后的自动恢复，手动归档的地址保持归档
+	RestoreUrls(ctx *core.Context, urls []string, manual bool) ([]string, error)
 }
 
 // FavoriteRepository 收藏管理接口
@@ -44,11 +44,23 @@ func registerPages(r *gin.Engine) {
 // 注册 API 路由
 func registerAPI(r *gin.Engine) {
 	r.GET(URLAPIIPTV, core.WrapHandler(handler.HandleM3U))
+	r.GET(URLAPIIPTVTxt, core.WrapHandler(handler.HandleTXT))
 	r.POST(URLAPIValidate, core.WrapHandler(handler.HandleValidate))
 	r.POST(URLAPIUpload, core.WrapHandler(handler.HandleUpload))
+	r.POST(URLAPIPreview, core.WrapHandler(handler.HandlePreview))
+	r.POST(URLAPIImport, core.WrapHandler(handler.HandleImport))
 	r.GET(URLAPIProcess, core.WrapHandler(handler.HandleProcess))
+	r.GET(URLAPIJobStatus, core.WrapHandler(handler.HandleJobStatus))
+	r.GET(URLAPIJobEvents, core.WrapHandler(handler.HandleJobEvents))
+	r.GET(URLAPIJobSocket, core.WrapHandler(handler.HandleJobSocket))
+	r.POST(URLAPIJobCancel, core.WrapHandler(handler.HandleJobCancel))
+	r.GET(URLAPIJobs, core.WrapHandler(handler.HandleJobList))
+	r.GET(URLAPISchedulerStatus, core.WrapHandler(handler.HandleSchedulerStatus))
 	r.GET(URLAPIChannels, core.WrapHandler(handler.HandleListAllChannel))
 	r.GET(URLAPIChannelRecordNum, core.WrapHandler(handler.HandleGetRecordNums))
 	r.POST(URLAPIChannelValidate, core.WrapHandler(handler.HandleChannelValidate))
 	r.GET(URLAPIChannelDetail, core.WrapHandler(handler.HandleChannelDetail))
+	r.GET(URLAPIStreamHealth, core.WrapHandler(handler.HandleStreamHealth))
+	r.POST(URLAPIStreamArchive, core.WrapHandler(handler.HandleArchive))
+	r.POST(URLAPIStreamRestore, core.WrapHandler(handler.HandleRestore))
 }
@@ -10,13 +10,25 @@ const (
 
 	// API 路由
 	URLAPIIPTV             = "/iptv.m3u"
+	URLAPIIPTVTxt          = "/iptv.txt"
 	URLAPIValidate         = "/api/validate"
 	URLAPIUpload           = "/api/upload"
+	URLAPIPreview          = "/api/preview"
+	URLAPIImport           = "/api/import"
 	URLAPIProcess          = "/api/process"
+	URLAPIJobStatus        = "/api/job/status"
+	URLAPIJobEvents        = "/api/job/events"
+	URLAPIJobCancel        = "/api/job/cancel"
+	URLAPIJobSocket        = "/api/job/ws"
+	URLAPIJobs             = "/api/jobs"
+	URLAPISchedulerStatus  = "/api/scheduler/status"
 	URLAPIChannels         = "/api/channels"
 	URLAPIChannelRecordNum = "/api/channel/get_record_num"
 	URLAPIChannelValidate  = "/api/channel/validate"
 	URLAPIChannelDetail    = "/api/channel/detail"
+	URLAPIStreamHealth     = "/api/stream/health"
+	URLAPIStreamArchive    = "/api/stream/archive"
+	URLAPIStreamRestore    = "/api/stream/restore"
 
 	// 其他路由分类可以在这里继续添加
 	// 例如：
@@ -13,6 +13,7 @@ var (
 	CacheMutex     sync.Mutex
 	CacheDir       = "/tmp/cache"
 	CacheFile      = filepath.Join(CacheDir, "validated.m3u")
+	CacheTxtFile   = filepath.Join(CacheDir, "validated.txt")
 )
 
 const (
@@ -33,8 +34,8 @@ func Cleanup() {
 
 	// 删除过期文件
 	for _, file := range files {
-		// 跳过 validated.m3u 文件
-		if file.Name() == filepath.Base(CacheFile) {
+		// 跳过 validated.m3u 和 validated.txt 文件
+		if file.Name() == filepath.Base(CacheFile) || file.Name() == filepath.Base(CacheTxtFile) {
 			continue
 		}
 
@@ -26,6 +26,92 @@ type Config struct {
 			Database string `json:"database"`
 		} `json:"mongodb"`
 	} `json:"db"`
+
+	Import struct {
+		// MaxNestedDepth 嵌套播放列表的最大展开深度，0 使用默认值，负数表示不展开
+		MaxNestedDepth int `json:"maxNestedDepth"`
+	} `json:"import"`
+
+	Validate struct {
+		// Workers 同时进行的探测数，0 使用默认值
+		Workers int `json:"workers"`
+		// PerHost 每个主机同时进行的探测数，0 不限制
+		PerHost int `json:"perHost"`
+		// HostRPS 每个主机每秒最多开始的探测数，0 不限制
+		HostRPS float64 `json:"hostRps"`
+		// JitterMs 每次探测前随机等待的最长毫秒数
+		JitterMs int `json:"jitterMs"`
+		// Retries 超时、连接重置和 5xx 等暂时性失败的重试次数
+		Retries int `json:"retries"`
+		// RetryBackoffMs 第一次重试前等待的毫秒数，之后每次加倍
+		RetryBackoffMs int `json:"retryBackoffMs"`
+		// MinSuccessRatio 历次验证中成功比例不低于该值的地址才会保留，0 使用默认值
+		MinSuccessRatio float64 `json:"minSuccessRatio"`
+		// MaxConsecutiveFailures 连续失败达到该次数的地址不再保留，0 使用默认值
+		MaxConsecutiveFailures int `json:"maxConsecutiveFailures"`
+		// HostFailures 同一主机在一次验证中连续解析失败或拒绝连接达到该次数后，剩余地址不再探测
+		// 0 使用默认值，负数表示总是逐个探测
+		HostFailures int `json:"hostFailures"`
+		// SkipStaleCheck 不再等待直播列表更新，只要能取到分片就视为有效
+		SkipStaleCheck bool `json:"skipStaleCheck"`
+	} `json:"validate"`
+
+	Scheduler struct {
+		// Enabled 是否定时在后台重新验证数据库中的所有播放地址
+		Enabled bool `json:"enabled"`
+		// IntervalMinutes 两次验证之间的间隔分钟数，0 使用默认值
+		IntervalMinutes int `json:"intervalMinutes"`
+		// QuietHours 不进行验证的时间段，格式为 HH:MM-HH:MM，可以跨越午夜
+		QuietHours string `json:"quietHours"`
+		// BatchSize 每次最多验证的地址数，按优先级选取，0 验证全部
+		BatchSize int `json:"batchSize"`
+		// MaxLatencyMs 单个地址的最大延迟毫秒数，0 使用默认值
+		MaxLatencyMs int `json:"maxLatencyMs"`
+	} `json:"scheduler"`
+
+	Health struct {
+		// RawHours 原始验证记录保留的小时数，之前的记录按 BucketMinutes 汇总，0 使用默认值
+		RawHours int `json:"rawHours"`
+		// BucketMinutes 汇总验证记录时每个时间段的分钟数，0 使用默认值
+		BucketMinutes int `json:"bucketMinutes"`
+		// RetentionDays 验证记录保留的天数，0 使用默认值
+		RetentionDays int `json:"retentionDays"`
+	} `json:"health"`
+
+	Archive struct {
+		// MaxConsecutiveFailures 连续失败达到该次数的地址自动归档，0 不按次数归档
+		MaxConsecutiveFailures int `json:"maxConsecutiveFailures"`
+		// MaxDeadDays 超过该天数没有验证通过的地址自动归档，0 不按时间归档
+		MaxDeadDays int `json:"maxDeadDays"`
+		// RecheckDays 后台验证时重新检查自动归档的地址的间隔天数，0 使用默认值
+		RecheckDays int `json:"recheckDays"`
+	} `json:"archive"`
+
+	Multicast struct {
+		// Interface 验证 udp:// 和 rtp:// 组播地址时加入组播组使用的网卡名称或网卡上的 IPv4 地址，为空时由系统按路由选择
+		Interface string `json:"interface"`
+	} `json:"multicast"`
+
+	Proxy ProxyConfig `json:"proxy"`
+}
+
+// ProxyConfig 获取播放列表和验证播放地址时使用的出站代理
+// 按主机、播放列表来源、全局的顺序选择第一个匹配的代理
+type ProxyConfig struct {
+	// URL 全局代理，支持 http://、https://、socks5:// 和 socks5h://，为空时使用环境变量中的代理
+	URL string `json:"url"`
+	// Hosts 按请求的主机名选择代理
+	Hosts []ProxyRule `json:"hosts"`
+	// Sources 按播放地址所属播放列表的主机名选择代理
+	Sources []ProxyRule `json:"sources"`
+}
+
+// ProxyRule 按主机名模式选择代理
+type ProxyRule struct {
+	// Match 主机名模式，如 example.com、*.example.com，支持 path.Match 的通配符
+	Match string `json:"match"`
+	// Proxy 代理地址，"direct" 表示直接连接
+	Proxy string `json:"proxy"`
 }
 
 var (
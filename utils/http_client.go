@@ -7,14 +7,17 @@ import (
 	"net/url"
 	"strings"
 	"time"
+
+	"tv-server/utils/httpclient"
 )
 
-var client = &http.Client{
-	Timeout: 3 * time.Second,
-	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+var client = func() *http.Client {
+	c := httpclient.New(httpclient.Options{Timeout: 3 * time.Second})
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
-	},
-}
+	}
+	return c
+}()
 
 func CheckURL(urlStr string) (int, int64, error) {
 	urlStr = normalizeURL(urlStr)
@@ -68,7 +71,7 @@ func normalizeURL(urlStr string) string {
 }
 
 func fetchContent(url string) (string, error) {
-	resp, err := http.Get(url)
+	resp, err := httpclient.New(httpclient.Options{}).Get(url)
 	if err != nil {
 		return "", err
 	}
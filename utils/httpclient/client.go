@@ -0,0 +1,271 @@
+// Package httpclient 创建出站请求使用的 http.Client，按配置为请求选择 HTTP 或 SOCKS5 代理
+// 获取播放列表、展开嵌套列表和验证播放地址都应通过 New 创建 client
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"tv-server/utils/core"
+
+	"golang.org/x/net/proxy"
+)
+
+// Direct 规则中表示直接连接、不使用代理
+const Direct = "direct"
+
+// dialTimeout 建立连接的超时时间，与 http.DefaultTransport 相同
+const dialTimeout = 30 * time.Second
+
+// Options 创建 client 的参数
+type Options struct {
+	Timeout               time.Duration // 整个请求的超时时间，0 不限制
+	ResponseHeaderTimeout time.Duration // 等待响应头的超时时间，0 不限制
+	DisableKeepAlives     bool
+
+	// Sources 请求所属的播放列表地址，用于按来源选择代理，靠前的优先
+	Sources []string
+
+	// DNS 直接连接时使用的解析缓存，nil 时每次连接都重新解析
+	DNS *DNSCache
+}
+
+// rule 解析后的代理规则
+type rule struct {
+	match string
+	proxy *url.URL // nil 表示直接连接
+}
+
+// settings 解析后的代理配置
+type settings struct {
+	global  *url.URL
+	hosts   []rule
+	sources []rule
+
+	httpProxies map[string]bool // HTTP 代理服务器的地址，连接代理服务器本身时不再选择代理
+}
+
+var (
+	mu      sync.RWMutex
+	current = &settings{}
+)
+
+// Configure 设置代理配置，代理地址无效时返回错误且不改变原有配置
+func Configure(cfg core.ProxyConfig) error {
+	s := &settings{}
+	var err error
+	if cfg.URL != "" {
+		if s.global, err = parseProxy(cfg.URL); err != nil {
+			return err
+		}
+	}
+	if s.hosts, err = parseRules(cfg.Hosts); err != nil {
+		return err
+	}
+	if s.sources, err = parseRules(cfg.Sources); err != nil {
+		return err
+	}
+	s.httpProxies = make(map[string]bool)
+	for _, u := range s.proxies() {
+		if u != nil && !isSOCKS(u) {
+			s.httpProxies[proxyAddr(u)] = true
+		}
+	}
+
+	mu.Lock()
+	current = s
+	mu.Unlock()
+	return nil
+}
+
+// proxies 返回全局和规则中的所有代理
+func (s *settings) proxies() []*url.URL {
+	result := []*url.URL{s.global}
+	for _, r := range s.hosts {
+		result = append(result, r.proxy)
+	}
+	for _, r := range s.sources {
+		result = append(result, r.proxy)
+	}
+	return result
+}
+
+// proxyAddr 返回代理服务器的 host:port，未指定端口时使用协议的默认端口
+func proxyAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+func parseRules(rules []core.ProxyRule) ([]rule, error) {
+	result := make([]rule, 0, len(rules))
+	for _, r := range rules {
+		if r.Match == "" {
+			return nil, fmt.Errorf("代理规则缺少 match: %s", r.Proxy)
+		}
+		var u *url.URL
+		if !strings.EqualFold(r.Proxy, Direct) {
+			var err error
+			if u, err = parseProxy(r.Proxy); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, rule{match: strings.ToLower(r.Match), proxy: u})
+	}
+	return result, nil
+}
+
+// parseProxy 解析并检查代理地址
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("无效的代理地址 %q: %v", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("不支持的代理协议 %q", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("代理地址缺少主机 %q", raw)
+	}
+	return u, nil
+}
+
+// New 创建 client，每个请求（包括重定向后的请求）按目标主机和 opts.Sources 选择代理
+// 代理配置在发起请求时读取，Configure 之前创建的 client 同样生效
+func New(opts Options) *http.Client {
+	sources := make([]string, 0, len(opts.Sources))
+	for _, source := range opts.Sources {
+		if host := hostname(source); host != "" {
+			sources = append(sources, host)
+		}
+	}
+	d := &dialer{sources: sources, dns: opts.DNS, direct: &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}}
+
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 d.httpProxy,
+			DialContext:           d.dialContext,
+			DisableKeepAlives:     opts.DisableKeepAlives,
+			ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+// dialer 根据目标主机选择代理，HTTP 代理由 Transport.Proxy 处理，SOCKS5 代理在建立连接时处理
+type dialer struct {
+	sources []string
+	dns     *DNSCache
+	direct  *net.Dialer
+}
+
+// loadSettings 返回当前的代理配置
+func loadSettings() *settings {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// resolve 返回访问 host 使用的代理，configured 为 false 表示没有任何匹配的配置
+func (d *dialer) resolve(s *settings, host string) (proxy *url.URL, configured bool) {
+	host = strings.ToLower(host)
+	for _, r := range s.hosts {
+		if matchHost(r.match, host) {
+			return r.proxy, true
+		}
+	}
+	for _, source := range d.sources {
+		for _, r := range s.sources {
+			if matchHost(r.match, source) {
+				return r.proxy, true
+			}
+		}
+	}
+	if s.global != nil {
+		return s.global, true
+	}
+	return nil, false
+}
+
+// httpProxy 实现 Transport.Proxy，没有配置时沿用环境变量中的代理
+func (d *dialer) httpProxy(req *http.Request) (*url.URL, error) {
+	u, configured := d.resolve(loadSettings(), req.URL.Hostname())
+	if !configured {
+		return http.ProxyFromEnvironment(req)
+	}
+	if u == nil || isSOCKS(u) {
+		return nil, nil
+	}
+	return u, nil
+}
+
+// dialContext 实现 Transport.DialContext，目标主机使用 SOCKS5 代理时通过代理建立连接
+// 使用 HTTP 代理时 addr 为代理服务器的地址，直接连接
+func (d *dialer) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	s := loadSettings()
+	if s.httpProxies[strings.ToLower(addr)] {
+		return d.direct.DialContext(ctx, network, addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	u, _ := d.resolve(s, host)
+	if u == nil || !isSOCKS(u) {
+		if d.dns != nil {
+			return d.dns.dial(ctx, d.direct, network, addr)
+		}
+		return d.direct.DialContext(ctx, network, addr)
+	}
+
+	socks, err := proxy.FromURL(u, d.direct)
+	if err != nil {
+		return nil, fmt.Errorf("创建 SOCKS5 代理失败: %w", err)
+	}
+	if cd, ok := socks.(proxy.ContextDialer); ok {
+		return cd.DialContext(ctx, network, addr)
+	}
+	return socks.Dial(network, addr)
+}
+
+func isSOCKS(u *url.URL) bool {
+	return u.Scheme == "socks5" || u.Scheme == "socks5h"
+}
+
+// matchHost 判断主机名是否匹配模式，*.example.com 同时匹配 example.com 本身
+func matchHost(pattern, host string) bool {
+	if pattern == host {
+		return true
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok && host == suffix {
+		return true
+	}
+	matched, _ := path.Match(pattern, host)
+	return matched
+}
+
+// hostname 返回地址中的主机名，小写
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
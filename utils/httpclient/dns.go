@@ -0,0 +1,93 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// dnsTimeout 单次域名解析的超时时间
+const dnsTimeout = 10 * time.Second
+
+// DNSCache 缓存域名解析的结果，包括解析失败的结果，用于一次验证任务内的所有请求
+// 同一主机只解析一次，并发的查询等待同一次解析的结果
+type DNSCache struct {
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+// NewDNSCache 创建空的 DNS 缓存
+func NewDNSCache() *DNSCache {
+	return &DNSCache{entries: make(map[string]*dnsEntry)}
+}
+
+// LookupHost 返回主机名对应的地址，ctx 只影响等待，不会中断其他请求共用的解析
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	if !ok {
+		e = &dnsEntry{done: make(chan struct{})}
+		c.entries[host] = e
+		go c.resolve(host, e)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return e.addrs, e.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// resolve 解析主机名，超时等临时错误不缓存，下一次查询重新解析
+func (c *DNSCache) resolve(host string, e *dnsEntry) {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+	defer cancel()
+	e.addrs, e.err = net.DefaultResolver.LookupHost(ctx, host)
+
+	var dnsErr *net.DNSError
+	if e.err != nil && (!errors.As(e.err, &dnsErr) || dnsErr.IsTimeout || dnsErr.IsTemporary) {
+		c.mu.Lock()
+		delete(c.entries, host)
+		c.mu.Unlock()
+	}
+	close(e.done)
+}
+
+// dial 使用缓存的解析结果依次连接各个地址，返回第一个成功的连接
+func (c *DNSCache) dial(ctx context.Context, d *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := c.LookupHost(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+
+	var lastErr error
+	for _, ip := range addrs {
+		conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}